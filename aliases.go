@@ -0,0 +1,122 @@
+package main
+
+// aliases.go
+
+import (
+	"fmt"
+	"strings"
+
+	// my libraries
+	tg "github.com/meinside/telegram-bot-go"
+)
+
+// aliases of times defined by each chat (eg. "eod" => "17:00", "lunch" => "12:30"), which are told to the model when parsing
+
+// return a /alias command handler
+func aliasCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "alias command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			chatID := message.Chat.ID
+			messageID := message.MessageID
+
+			// "add PHRASE HH:MM", "list", "delete PHRASE"
+			var msg string
+			fields := strings.Fields(args)
+			var subcmd string
+			if len(fields) > 0 {
+				subcmd = fields[0]
+			}
+
+			switch {
+			case subcmd == argAliasAdd && len(fields) > 2:
+				phrase := normalizeAliasPhrase(strings.Join(fields[1:len(fields)-1], " "))
+				minutes, err := parseMinutesOfDay(fields[len(fields)-1])
+				if err != nil || len(phrase) > maxAliasPhraseLength {
+					msg = fmt.Sprintf(msgAliasInvalidFormat, escapeHTML(strings.Join(fields[1:], " ")), maxAliasPhraseLength)
+				} else if aliases, err := db.ListAliases(chatID); err != nil {
+					logError(db, "failed to list aliases: %s", err)
+				} else if len(aliases) >= maxAliasesPerChat && !hasAlias(aliases, phrase) {
+					msg = fmt.Sprintf(msgTooManyAliasesFormat, maxAliasesPerChat)
+				} else if _, err := db.SaveAlias(chatID, phrase, minutesOfDayToStr(minutes)); err == nil {
+					msg = fmt.Sprintf(msgAliasSavedFormat, escapeHTML(phrase), minutesOfDayToStr(minutes))
+				} else {
+					logError(db, "failed to save alias: %s", err)
+				}
+			case subcmd == argAliasList && len(fields) == 1:
+				if aliases, err := db.ListAliases(chatID); err == nil {
+					if len(aliases) > 0 {
+						lines := []string{}
+						for _, alias := range aliases {
+							lines = append(lines, fmt.Sprintf(msgListAliasFormat, escapeHTML(alias.Phrase), alias.Time))
+						}
+						msg = strings.Join(lines, "\n")
+					} else {
+						msg = msgNoAliases
+					}
+				} else {
+					logError(db, "failed to list aliases: %s", err)
+				}
+			case subcmd == argAliasDelete && len(fields) > 1:
+				phrase := normalizeAliasPhrase(strings.Join(fields[1:], " "))
+				if deleted, err := db.DeleteAlias(chatID, phrase); err == nil {
+					if deleted {
+						msg = fmt.Sprintf(msgAliasDeletedFormat, escapeHTML(phrase))
+					} else {
+						msg = fmt.Sprintf(msgNoSuchAliasFormat, escapeHTML(phrase))
+					}
+				} else {
+					logError(db, "failed to delete alias: %s", err)
+				}
+			default:
+				msg = msgAliasUsage
+			}
+
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			send(b, conf, db, msg, chatID, &messageID)
+		}
+	}
+}
+
+// normalize given phrase of an alias (eg. " Close  of Business" => "close of business")
+func normalizeAliasPhrase(phrase string) string {
+	return strings.ToLower(collapseSpaces(phrase))
+}
+
+// check if given aliases have one with given phrase
+func hasAlias(aliases []Alias, phrase string) bool {
+	for _, alias := range aliases {
+		if alias.Phrase == phrase {
+			return true
+		}
+	}
+
+	return false
+}
+
+// get the aliases of given chat which appear in given text, for telling them to the model
+// (eg. "'lunch' is 12:30, 'eod' is 17:00"), or an empty string if there is none
+func aliasesInText(db *Database, chatID int64, text string) string {
+	aliases, err := db.ListAliases(chatID)
+	if err != nil {
+		logError(db, "failed to list aliases: %s", err)
+		return ""
+	}
+
+	text = normalizeAliasPhrase(text)
+	matched := []string{}
+	for _, alias := range aliases {
+		if strings.Contains(text, alias.Phrase) {
+			matched = append(matched, fmt.Sprintf("'%s' is %s", alias.Phrase, alias.Time))
+		}
+	}
+
+	return strings.Join(matched, ", ")
+}
@@ -0,0 +1,256 @@
+package main
+
+// api.go
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminAPIConfig is a struct for configuring the admin HTTP API
+type adminAPIConfig struct {
+	ListenAddr string  `json:"listen_addr"` // eg. "127.0.0.1:8080"
+	Token      string  `json:"token"`       // for header: `Authorization: Bearer <token>`
+	ChatIDs    []int64 `json:"chat_ids"`    // chat ids which can be managed with the API
+}
+
+// header for idempotency keys of requests for creating reminders
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	maxIdempotencyKeyLength = 255
+)
+
+// reminder in API requests/responses
+type apiReminder struct {
+	ID         int64      `json:"id,omitempty"`
+	ChatID     int64      `json:"chat_id"`
+	Message    string     `json:"message"`
+	FireOn     time.Time  `json:"fire_on"`
+	Recurrence string     `json:"recurrence,omitempty"`
+	UntilOn    *time.Time `json:"until_on,omitempty"` // end of the recurrence
+}
+
+// databases of bots which can be selected with `bot_id` of API requests
+type apiBotDatabases struct {
+	db  *Database           // unscoped database (when no bot was launched)
+	ids []int64             // ids of bots, the default one (eg. the main bot) first
+	dbs map[int64]*Database // databases (scoped to each bot, when running multiple bots)
+}
+
+// add a database of given bot
+func (b *apiBotDatabases) add(botID int64, db *Database) {
+	if b.dbs == nil {
+		b.dbs = map[int64]*Database{}
+	}
+	b.ids = append(b.ids, botID)
+	b.dbs[botID] = db
+}
+
+// error in API responses
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// serve the admin HTTP API with given config (blocks until it fails)
+func serveAdminAPI(apiConf adminAPIConfig, bots apiBotDatabases) error {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /reminders", adminAPIHandler(apiConf, bots, listRemindersAPI))
+	mux.HandleFunc("POST /reminders", adminAPIHandler(apiConf, bots, createReminderAPI))
+	mux.HandleFunc("DELETE /reminders/{id}", adminAPIHandler(apiConf, bots, cancelReminderAPI))
+
+	logInfo("serving admin API on: %s", apiConf.ListenAddr)
+
+	return http.ListenAndServe(apiConf.ListenAddr, mux)
+}
+
+// wrap given handler with authentication, and the database of the bot selected with `bot_id`
+func adminAPIHandler(apiConf adminAPIConfig, bots apiBotDatabases, handle func(w http.ResponseWriter, r *http.Request, apiConf adminAPIConfig, db *Database)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer recoverAndLog(bots.db, fmt.Sprintf("admin API: %s %s", r.Method, r.URL.Path))
+
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || apiConf.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(apiConf.Token)) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+
+		db, ok := botDatabaseForAPI(w, bots, r.URL.Query().Get("bot_id"))
+		if !ok {
+			return
+		}
+
+		handle(w, r, apiConf, db)
+	}
+}
+
+// parse given bot id and return the database of the bot (the default one's if empty), writing an error response if there is no such bot
+func botDatabaseForAPI(w http.ResponseWriter, bots apiBotDatabases, str string) (db *Database, ok bool) {
+	if str == "" {
+		if len(bots.ids) == 0 {
+			return bots.db, true
+		}
+		return bots.dbs[bots.ids[0]], true
+	}
+
+	botID, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid bot_id: '%s'", str))
+		return nil, false
+	}
+	if db, exists := bots.dbs[botID]; exists {
+		return db, true
+	}
+
+	writeAPIError(w, http.StatusNotFound, fmt.Sprintf("no such bot: %d", botID))
+	return nil, false
+}
+
+// GET /reminders?chat_id=N
+func listRemindersAPI(w http.ResponseWriter, r *http.Request, apiConf adminAPIConfig, db *Database) {
+	chatID, ok := allowedChatIDForAPI(w, apiConf, r.URL.Query().Get("chat_id"))
+	if !ok {
+		return
+	}
+
+	if items, err := db.UndeliveredQueueItems(chatID); err == nil {
+		reminders := []apiReminder{}
+		for _, item := range items {
+			reminders = append(reminders, apiReminder{
+				ID:         item.ID,
+				ChatID:     item.ChatID,
+				Message:    item.Message,
+				FireOn:     item.FireOn,
+				Recurrence: item.Recurrence,
+				UntilOn:    item.UntilOn,
+			})
+		}
+
+		writeAPIResponse(w, http.StatusOK, reminders)
+	} else {
+		logError(db, "admin API failed to list reminders: %s", err)
+
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// POST /reminders {"chat_id": N, "message": "...", "fire_on": "2024-12-25T15:00:00+09:00"}
+func createReminderAPI(w http.ResponseWriter, r *http.Request, apiConf adminAPIConfig, db *Database) {
+	var reminder apiReminder
+	if err := json.NewDecoder(r.Body).Decode(&reminder); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err))
+		return
+	}
+	if _, ok := allowedChatIDForAPI(w, apiConf, strconv.FormatInt(reminder.ChatID, 10)); !ok {
+		return
+	}
+	if strings.TrimSpace(reminder.Message) == "" {
+		writeAPIError(w, http.StatusBadRequest, "`message` is empty")
+		return
+	}
+	if !reminder.FireOn.After(time.Now()) {
+		writeAPIError(w, http.StatusBadRequest, "`fire_on` should be in the future")
+		return
+	}
+	if reminder.Recurrence != "" {
+		if _, err := parseCron(reminder.Recurrence); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid `recurrence`: %s", err))
+			return
+		}
+	}
+
+	item := QueueItem{
+		ChatID:     reminder.ChatID,
+		Message:    reminder.Message,
+		FireOn:     reminder.FireOn,
+		Recurrence: reminder.Recurrence,
+		UntilOn:    reminder.UntilOn,
+		Source:     sourceAPI,
+	}
+	if key := strings.TrimSpace(r.Header.Get(idempotencyKeyHeader)); key != "" {
+		if len(key) > maxIdempotencyKeyLength {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("`%s` is too long (max: %d)", idempotencyKeyHeader, maxIdempotencyKeyLength))
+			return
+		}
+		item.IdempotencyKey = &key
+	}
+	if saved, existed, err := db.EnqueueItemIdempotently(item); err == nil {
+		status := http.StatusCreated
+		if existed { // (retried request: respond with the existing one)
+			status = http.StatusOK
+		}
+
+		writeAPIResponse(w, status, apiReminder{
+			ID:         saved.ID,
+			ChatID:     saved.ChatID,
+			Message:    saved.Message,
+			FireOn:     saved.FireOn,
+			Recurrence: saved.Recurrence,
+			UntilOn:    saved.UntilOn,
+		})
+	} else {
+		logError(db, "admin API failed to create reminder: %s", err)
+
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// DELETE /reminders/{id}?chat_id=N
+func cancelReminderAPI(w http.ResponseWriter, r *http.Request, apiConf adminAPIConfig, db *Database) {
+	chatID, ok := allowedChatIDForAPI(w, apiConf, r.URL.Query().Get("chat_id"))
+	if !ok {
+		return
+	}
+
+	queueID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid id: %s", r.PathValue("id")))
+		return
+	}
+
+	if deleted, err := db.DeleteQueueItem(chatID, queueID); err == nil {
+		if deleted {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			writeAPIError(w, http.StatusNotFound, fmt.Sprintf("no such reminder: %d", queueID))
+		}
+	} else {
+		logError(db, "admin API failed to cancel reminder: %s", err)
+
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// parse given chat id and check if it is allowed, writing an error response if not
+func allowedChatIDForAPI(w http.ResponseWriter, apiConf adminAPIConfig, str string) (chatID int64, ok bool) {
+	chatID, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid chat_id: '%s'", str))
+		return 0, false
+	}
+	if !slices.Contains(apiConf.ChatIDs, chatID) {
+		writeAPIError(w, http.StatusForbidden, fmt.Sprintf("chat_id not allowed: %d", chatID))
+		return 0, false
+	}
+
+	return chatID, true
+}
+
+// write given value as a JSON response
+func writeAPIResponse(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// write given error message as a JSON response
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIResponse(w, status, apiError{Error: message})
+}
@@ -0,0 +1,168 @@
+package main
+
+// batch.go
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	// my libraries
+	gt "github.com/meinside/gemini-things-go"
+	tg "github.com/meinside/telegram-bot-go"
+)
+
+// reminders from numbered or bulleted lists (eg. "1. call bank\n2. email Joe\nboth tomorrow 10am")
+
+const (
+	minBatchItems = 2  // lists with less items are handled as a single message
+	maxBatchItems = 10 // lists with more items are handled as a single message (not to parse too many times)
+)
+
+// expression of items in lines of lists (eg. "1. call bank", "2) email Joe", "- buy milk", "• pay rent")
+var _listItemExpression = regexp.MustCompile(`^\s*(?:\d{1,2}[.)]|[-*•])\s+(\S.*)$`)
+
+// expression of numbers of items in a line (eg. "1. call bank 2. email Joe")
+var _inlineNumberExpression = regexp.MustCompile(`(?:^|\s)(\d{1,2})[.)]\s+`)
+
+// expression of a part shared by all items, at the end of the last item (eg. "email Joe - both tomorrow 10am")
+var _sharedSuffixExpression = regexp.MustCompile(`(?i)\s+[-–—]\s+((?:both|all|each)\b.*)$`)
+
+// split given text into the items of its list, and the part shared by all of them (eg. "tomorrow 10am:"),
+// or return false if it is not a list
+func splitListItems(text string) (items []string, shared string, ok bool) {
+	items = []string{}
+	shareds := []string{}
+
+	text = strings.TrimSpace(text)
+	if strings.Contains(text, "\n") { // one item per line
+		for _, line := range strings.Split(text, "\n") {
+			if matched := _listItemExpression.FindStringSubmatch(line); matched != nil {
+				items = append(items, strings.TrimSpace(matched[1]))
+			} else if line = strings.TrimSpace(line); line != "" {
+				shareds = append(shareds, line)
+			}
+		}
+	} else { // numbered items in a line
+		matched := _inlineNumberExpression.FindAllStringSubmatchIndex(text, -1)
+		for i, m := range matched {
+			if n, _ := strconv.Atoi(text[m[2]:m[3]]); n != i+1 { // (should be numbered from 1, in order)
+				return nil, "", false
+			}
+
+			end := len(text)
+			if i+1 < len(matched) {
+				end = matched[i+1][0]
+			}
+			items = append(items, strings.TrimSpace(text[m[1]:end]))
+		}
+		if len(matched) > 0 {
+			if before := strings.TrimSpace(text[:matched[0][0]]); before != "" {
+				shareds = append(shareds, before)
+			}
+		}
+	}
+
+	if len(items) < minBatchItems || len(items) > maxBatchItems {
+		return nil, "", false
+	}
+
+	// (eg. "email Joe - both tomorrow 10am" => "email Joe", "both tomorrow 10am")
+	last := len(items) - 1
+	if matched := _sharedSuffixExpression.FindStringSubmatchIndex(items[last]); matched != nil {
+		shareds = append(shareds, items[last][matched[2]:matched[3]])
+		items[last] = strings.TrimSpace(items[last][:matched[0]])
+	}
+
+	return items, strings.Join(shareds, " "), true
+}
+
+// parse each of given items (with the shared part) and enqueue them, then reply with a summary of them
+func handleBatch(ctx context.Context, bot *tg.Bot, conf config, db *Database, gtc *gt.Client, update tg.Update, message tg.Message, items []string, shared string) {
+	chatID := message.Chat.ID
+	loc := chatLocation(db, chatID)
+	pref := chatDatetimePreference(db, chatID)
+
+	// (number of reminders which can be created, unless the user is an admin)
+	capacity := maxBatchItems
+	if conf.MaxActiveRemindersPerChat > 0 && !isAdmin(conf, update) {
+		if active, err := db.UndeliveredQueueItems(chatID); err == nil {
+			capacity = conf.MaxActiveRemindersPerChat - len(active)
+		} else {
+			logError(db, "failed to count active reminders: %s", err)
+		}
+	}
+
+	created, failed := []string{}, []string{}
+	for _, item := range items {
+		text := item
+		if shared != "" {
+			text = fmt.Sprintf("%s %s", item, shared)
+		}
+
+		if capacity <= 0 {
+			failed = append(failed, fmt.Sprintf(msgBatchFailedItemFormat, escapeHTML(item), fmt.Sprintf(msgTooManyRemindersFormat, conf.MaxActiveRemindersPerChat)))
+			continue
+		}
+
+		parsed, errs := parse(ctx, conf, db, gtc, message, text)
+		for i := range parsed {
+			parsed[i].Message = keepTags(parsed[i].Message, text)
+		}
+		parsed = filterParsed(conf, anchorToWeekStart(parsed, text, chatWeekStart(db, chatID), time.Now().In(loc)), loc)
+		if conf.MinLeadTimeSeconds > 0 && !isAdmin(conf, update) {
+			parsed, _ = filterTooSoon(conf, parsed)
+		}
+
+		if len(parsed) <= 0 {
+			reason := msgNoClue
+			if len(errs) > 0 {
+				reason = parseFailedMessage(errs)
+			}
+			failed = append(failed, fmt.Sprintf(msgBatchFailedItemFormat, escapeHTML(item), escapeHTML(reason)))
+			continue
+		}
+
+		if _, err := db.EnqueueItem(QueueItem{
+			ChatID:            chatID,
+			MessageID:         message.MessageID,
+			MessageThreadID:   threadIDOf(message),
+			Message:           parsed[0].Message,
+			FireOn:            parsed[0].When,
+			ModelName:         parsed[0].Model,
+			Silent:            parsed[0].Silent,
+			Recurrence:        parsed[0].Recurrence,
+			UntilOn:           parsed[0].UntilOn,
+			IntervalMinutes:   parsed[0].IntervalMinutes,
+			WindowEndMinutes:  parsed[0].WindowEndMinutes,
+			Source:            sourceMessage,
+			CreatedBy:         userIDOf(message),
+			LeadOffsetSeconds: int64(parsed[0].LeadOffset.Seconds()),
+		}); err == nil {
+			capacity--
+
+			line := fmt.Sprintf(msgListItemFormat, datetimeToStr(parsed[0].When, pref), escapeHTML(firstLine(parsed[0].Message, listItemMessageLength)))
+			if parsed[0].Recurrence != "" {
+				line += fmt.Sprintf(msgListItemCronFormat, escapeHTML(parsed[0].Recurrence))
+			}
+			created = append(created, line)
+		} else {
+			logError(db, "failed to save reminder of list item: %s", err)
+
+			failed = append(failed, fmt.Sprintf(msgBatchFailedItemFormat, escapeHTML(item), msgError))
+		}
+	}
+
+	msg := fmt.Sprintf(msgBatchCreatedFormat, len(created), len(items))
+	if len(created) > 0 {
+		msg += "\n\n" + strings.Join(created, "\n")
+	}
+	if len(failed) > 0 {
+		msg += "\n\n" + msgBatchFailed + "\n" + strings.Join(failed, "\n")
+	}
+
+	send(bot, conf, db, msg, chatID, &message.MessageID)
+}
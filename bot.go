@@ -7,12 +7,26 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
+	"io"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"path"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	// infisical
 	infisical "github.com/infisical/go-sdk"
@@ -29,6 +43,7 @@ import (
 
 	// others
 	"github.com/tailscale/hujson"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -38,58 +53,525 @@ const (
 	cmdStats         = "/stats"
 	cmdHelp          = "/help"
 	cmdCancel        = "/cancel"
+	cmdCancelAll     = "/cancelall"
 	cmdLoad          = "/load" // (internal)
 	cmdListReminders = "/list"
+	cmdHistory       = "/history"
 	cmdPrivacy       = "/privacy"
-
-	msgStart                 = `This bot will reserve your messages and notify you at desired times, with ChatGPT API :-)`
-	msgCmdNotSupported       = `Not a supported bot command: %s`
+	cmdPause         = "/pause"
+	cmdResume        = "/resume"
+	cmdSnooze        = "/snooze"
+	cmdUndated       = "/undated"
+	cmdSchedule      = "/schedule" // (internal)
+	cmdMilestones    = "/milestones"
+	cmdClone         = "/clone"
+	cmdFeedback      = "/feedback" // (internal)
+	cmdCron          = "/cron"
+	cmdTimezone      = "/timezone"
+	cmdClearHistory  = "/clearhistory"
+	cmdPreset        = "/preset"
+	cmdAlias         = "/alias"
+	cmdForgetMe      = "/forgetme"
+	cmdSetKey        = "/setkey"
+	cmdClearKey      = "/clearkey"
+	cmdWhoAmI        = "/whoami"
+	cmdRemind        = "/remind"
+	cmdFixTime       = "/fixtime" // (internal)
+	cmdEmail         = "/email"
+	cmdDatetime      = "/datetime"
+	cmdPrefix        = "/prefix"
+	cmdChannels      = "/channels"
+	cmdWebhook       = "/webhook"
+	cmdWeekStart     = "/weekstart"
+	cmdTest          = "/test"
+	cmdUnsnooze      = "/unsnooze" // (internal)
+	cmdICal          = "/ical"
+	cmdSuggested     = "/suggested"  // (internal)
+	cmdChangeTime    = "/changetime" // (internal)
+	cmdEscalate      = "/escalate"
+	cmdAcknowledge   = "/ack" // (internal)
+	cmdActiveHours   = "/activehours"
+
+	msgStart               = `This bot will reserve your messages and notify you at desired times, with Gemini API :-)`
+	msgCmdNotSupported     = `Not a supported bot command: %s`
+	msgCmdSuggestionFormat = `Not a supported bot command: %s
+
+Did you mean %s?`
 	msgTypeNotSupported      = `Not a supported message type.`
 	msgDatabaseNotConfigured = `Database not configured. Set 'db_filepath' in your config file.`
 	msgDatabaseEmpty         = `Database is empty.`
 	msgHelp                  = `Help message here:
 
-<b>/list</b>: list all the active reminders.
+<b>/remind</b>: add a reminder explicitly (eg. <code>/remind tomorrow 9am call mom</code>).
+<b>/list</b>: list all the active reminders. (<code>/list #work</code> for the ones with a tag, <code>/list verbose</code> for more details, <code>/list sort=created</code> or <code>/list sort=message</code> for other orders)
+<b>/history</b>: list the latest delivered reminders with the times of their deliveries (eg. <code>/history 20</code>, <code>/history 20 2</code> for older ones).
+<b>/ical</b>: export the active reminders as an iCalendar (.ics) file, for importing them into calendar apps (<code>/ical feed</code> for a url to subscribe to, if enabled).
 <b>/cancel</b>: cancel a reminder.
-<b>/stats</b>: show stats of this bot.
-<b>/privacy</b>: show privacy policy of this bot.
+<b>/cancelall</b>: cancel all reminders, or the ones containing given text (eg. <code>/cancelall #work</code>), after confirmation.
+<b>/clone</b>: duplicate a reminder to a new time.
+<b>/test</b>: send a test reminder in 10 seconds, for checking if reminders are delivered.
+<b>/pause</b>: pause reminders of this chat.
+<b>/resume</b>: resume paused reminders of this chat.
+<b>/undated</b>: list undated reminders and schedule them.
+<b>/cron</b>: add a recurring reminder with a cron expression (eg. <code>/cron 0 9 * * 1-5 stand-up meeting</code>).
+<b>/milestones</b>: get notified before a reminder (eg. <code>/milestones 1d,1h</code>).
+<b>/escalate</b>: re-notify a reminder until it is acknowledged (eg. <code>/escalate 30m</code>).
+<b>/activehours</b>: show or set the hours of this chat for re-notifying escalated reminders (eg. <code>/activehours 09:00-18:00</code>).
+<b>/snooze</b>: show or set snooze presets (eg. <code>/snooze 10m,1h,tomorrow 9am</code>).
+<b>/timezone</b>: show or set the timezone of this chat (eg. <code>/timezone Asia/Seoul</code>), or share your location for detecting it.
+<b>/preset</b>: save and use reminder presets (eg. <code>/preset save pill take medication at 9pm</code>, <code>/preset use pill</code>, <code>/preset list</code>, <code>/preset delete pill</code>).
+<b>/forgetme</b>: delete all data of this chat from the bot, after a typed confirmation.
+<b>/alias</b>: define phrases of times for this chat (eg. <code>/alias add lunch 12:30</code>, then 'call Joe after lunch'; <code>/alias list</code>, <code>/alias delete lunch</code>).
+<b>/clearhistory</b>: delete delivered reminders of this chat.
+<b>/datetime</b>: show or set the format of datetimes in this chat (eg. <code>/datetime dmy12</code>).
+<b>/prefix</b>: show or set the prefix of delivered reminders in this chat (eg. <code>/prefix ⏰ Reminder:</code>).
+<b>/email</b>: show or set the email address for receiving reminders which cannot be delivered here (eg. <code>/email me@example.com</code>).
+<b>/weekstart</b>: show or set the first day of weeks in this chat, for understanding "next monday" or "next week" (eg. <code>/weekstart sunday</code>).
+<b>/channels</b>: show or set extra channels for delivering reminders besides here (eg. <code>/channels email,webhook</code>).
+<b>/webhook</b>: show or set the url for the webhook channel (eg. <code>/webhook https://example.com/hook</code>).
+<b>/setkey</b>: use your own Google AI API key (eg. <code>/setkey YOUR_API_KEY</code>).
+<b>/clearkey</b>: stop using your own Google AI API key.
+<b>/stats</b>: show stats of this bot (<code>/stats graph</code> for a chart of this chat's reminders).
+<b>/whoami</b>: show your user id, username, and whether you are allowed to use this bot.
+<b>/privacy</b>: show privacy policy of this bot (<code>/privacy off</code> for not saving the texts of your messages).
 <b>/help</b>: show this help message.
 
 <i>model: %s</i>
 <i>version: %s</i>
 <i>source code: <a href="%s">github</a></i>
 `
-	msgCommandCanceled        = `Command was canceled.`
-	msgReminderCanceledFormat = `Reminder '%s' was canceled.`
-	msgError                  = `An error has occurred.`
-	msgResponseFormat         = `Will notify '%s' on %s.`
-	msgSaveFailedFormat       = `Failed to save reminder '%s': %s`
-	msgSelectWhat             = `Which time do you want for message: '%s'?`
-	msgCancelWhat             = `Which one do you want to cancel?`
-	msgCancel                 = `Cancel`
-	msgParseFailedFormat      = `Failed to understand message: %s`
-	msgListItemFormat         = `☑ %s; %s`
-	msgNoReminders            = `There is no registered reminder.`
-	msgNoClue                 = `There was no clue for the desired datetime in your message.`
+	msgCommandCanceled         = `Command was canceled.`
+	msgReminderCanceledFormat  = `Reminder '%s' was canceled.`
+	msgError                   = `An error has occurred.`
+	msgResponseFormat          = `Will notify '%s' on %s.`
+	msgSaveFailedFormat        = `Failed to save reminder '%s': %s`
+	msgSelectWhat              = `Which time do you want for message: '%s'?`
+	msgCancelWhat              = `Which one do you want to cancel?`
+	msgCancel                  = `Cancel`
+	msgListCancelButtonFormat  = `✖ %s; %s`
+	msgConfirm                 = `Confirm`
+	msgChangeTime              = `Change`
+	msgConfirmScheduleFormat   = `Will notify '%s' on %s. Is it right?`
+	msgChangingTimeFormat      = `Changing the time of '%s'...`
+	msgParseFailedFormat       = `Failed to understand message: %s`
+	msgListItemFormat          = `☑ %s; %s`
+	msgListSortInvalidFormat   = `Invalid sort key: '%s' (available: %s)`
+	msgListItemModelFormat     = ` <i>(parsed by %s)</i>`
+	msgListItemSourceFormat    = ` <i>(via %s)</i>`
+	msgNoReminders             = `There is no registered reminder.`
+	msgNoTaggedRemindersFormat = `There is no registered reminder with tag: #%s`
+	msgNoClue                  = `There was no clue for the desired datetime in your message.`
+	msgSavedAsUndatedFormat    = `There was no clue for the desired datetime in your message, so '%s' was saved as an undated reminder. Schedule it with /undated.`
+	msgNoUndatedReminders      = `There is no undated reminder.`
+	msgUndated                 = `(undated)`
+	msgScheduleWhat            = `Which undated reminder do you want to schedule?`
+	msgScheduleWhenFormat      = `When do you want to be reminded of '%s'?`
+	msgSlowDown                = `Too many messages. Please slow down and try again later.`
+	msgMilestoneFormat         = `⏳ %s left: %s`
+	msgMilestonesUsage         = `Usage: <code>/milestones 1d,1h</code> for being notified 1 day and 1 hour before a reminder.`
+	msgMilestonesWhat          = `Which reminder do you want milestones for?`
+	msgMilestonesSetFormat     = `You will be notified %s before '%s'.`
+	msgMilestonesInvalidFormat = `Invalid milestones: %s`
+	msgCloneWhat               = `Which one do you want to clone?`
+	msgCloningFormat           = `Cloning '%s'...`
+	msgCloneWhenFormat         = `When do you want to be reminded of '%s' again? (eg. next monday 9am)`
+	msgHelpful                 = `👍`
+	msgNotHelpful              = `👎`
+	msgFeedbackFormat          = `%s` + feedbackSeparator + `%s)`
+	msgCronUsage               = `Usage: <code>/cron 0 9 * * 1-5 stand-up meeting</code> for being notified at 09:00 on every weekday.`
+	msgCronInvalidFormat       = `Invalid cron expression: %s`
+	msgCronResponseFormat      = `Will notify '%s' on %s, and then repeatedly with: %s`
+	msgListItemSilent          = ` 🔕`
+	msgListItemCronFormat      = ` 🔁 <code>%s</code>`
+	msgTimezoneFormat          = `Timezone of this chat: <b>%s</b>
+
+Set it with: <code>/timezone Asia/Seoul</code> (or share your location)
+Reset it with: <code>/timezone reset</code>`
+	msgTimezoneAskFormat = `Which timezone are you in? Your messages are understood in <b>%s</b> now.
+
+(You can also set it later with /timezone, or by sharing your location.)`
+	msgTimezoneDetectedFormat = `Timezone of this chat was set to <b>%s</b>. If it is not correct, set it with <code>/timezone</code> (or select one of the others below, if any).`
+	msgTimezoneSavedFormat    = `Timezone of this chat was set to %s.`
+	msgTimezoneInvalidFormat  = `Invalid timezone: %s`
+	msgAlreadyPassedFormat    = `That time has already passed. Did you mean tomorrow for message: '%s'?`
+	msgAllPassedFormat        = `That time has already passed. When do you want to be reminded of '%s'?`
+	msgClearHistoryConfirm    = `Do you really want to delete all delivered reminders of this chat? (Undelivered ones will be kept.)`
+	msgClearHistoryYes        = `Yes, delete them`
+	msgHistoryClearedFormat   = `%d delivered reminder(s) were deleted.`
+	msgCancelAllConfirmFormat = "Do you really want to cancel these %d reminder(s)?\n\n%s"
+	msgCancelAllMoreFormat    = "\n(and %d more)"
+	msgCancelAllYesFormat     = `Yes, cancel %d reminder(s)`
+	msgCancelAllNoMatchFormat = `There is no reminder matching '%s'.`
+	msgCancelAllFilterTooLong = `Filter is too long. Please make it shorter.`
+	msgCanceledAllFormat      = `%d reminder(s) were canceled.`
+	msgPresetUsage            = `Usage:
+
+<code>/preset save NAME TEXT</code>: save a preset (eg. <code>/preset save pill take medication at 9pm</code>)
+<code>/preset use NAME</code>: create a reminder with a saved preset
+<code>/preset list</code>: list saved presets
+<code>/preset delete NAME</code>: delete a preset`
+	msgPresetSavedFormat       = `Preset '%s' was saved.`
+	msgPresetDeletedFormat     = `Preset '%s' was deleted.`
+	msgNoSuchPresetFormat      = `There is no preset named '%s'.`
+	msgNoPresets               = `There is no saved preset.`
+	msgPresetInvalidNameFormat = `Invalid preset name: '%s' (only alphanumerics, '-', and '_' are allowed, up to %d characters)`
+	msgListPresetFormat        = `☑ <b>%s</b>: %s`
+	msgAliasUsage              = `Usage:
+
+<code>/alias add PHRASE HH:MM</code>: add an alias of a time (eg. <code>/alias add lunch 12:30</code>, <code>/alias add close of business 18:00</code>)
+<code>/alias list</code>: list aliases
+<code>/alias delete PHRASE</code>: delete an alias`
+	msgAliasSavedFormat     = `Alias '%s' was saved as %s.`
+	msgAliasDeletedFormat   = `Alias '%s' was deleted.`
+	msgNoSuchAliasFormat    = `There is no alias '%s'.`
+	msgNoAliases            = `There is no alias.`
+	msgAliasInvalidFormat   = `Invalid alias: '%s' (phrases up to %d characters, and times like '12:30' are allowed)`
+	msgTooManyAliasesFormat = `Cannot add more than %d aliases. Delete some of them first.`
+	msgListAliasFormat      = `☑ <b>%s</b>: %s`
+	msgSetKeyUsage          = `Usage: <code>/setkey YOUR_API_KEY</code> for using your own Google AI API key. (Your message will be deleted after it is saved.)`
+	msgKeyNotConfigured     = `Saving users' API keys is not configured. Set 'encryption_key' in the config file.`
+	msgKeySaved             = `Your API key was saved. Your messages will be handled with it from now on.`
+	msgKeyCleared           = `Your API key was deleted. Your messages will be handled with the bot's API key from now on.`
+	msgNoKey                = `You have no saved API key.`
+	msgTokenUsageFormat     = "\n\n(tokens used: %d input + %d output = %d)"
+	msgWhoAmIFormat         = `User id: <code>%d</code>
+Username: %s
+Allowed: %s`
+	msgWhoAmINoUsername             = `<i>(not set)</i>`
+	msgWhoAmIAllowed                = `yes`
+	msgWhoAmIAdmin                  = `yes (admin)`
+	msgWhoAmINotAllowed             = `no`
+	msgWhoAmISetUsername            = "\n\nSet your username in the Telegram settings, then ask the bot's owner to add it to the allowed users."
+	msgWhoAmIAskOwner               = "\n\nAsk the bot's owner to add your username to the allowed users."
+	msgRemindUsage                  = `Usage: <code>/remind tomorrow 9am call mom</code> for adding a reminder.`
+	msgDeliveryExhaustedFormat      = `I couldn't deliver this reminder after %d attempts: %s`
+	msgDeliveryExhaustedAlertFormat = `⚠ Failed to deliver a reminder to chat %d after %d attempts: %s`
+	msgTooManyRemindersFormat       = `This chat already has the maximum number (%d) of active reminders. Please /cancel some of them first.`
+	msgWrongTime                    = `Wrong time?`
+	msgFixTimeWhenFormat            = `When do you want to be reminded of '%s' instead?`
+	msgAlreadyDeliveredFormat       = `Reminder '%s' was already delivered.`
+	msgEmailFormat                  = `Email address of this chat: <b>%s</b>
+
+Set it with: <code>/email me@example.com</code>
+Reset it with: <code>/email reset</code>
+
+(Reminders which cannot be delivered here will be sent to it.)`
+	msgEmailNotSet        = `<i>(not set)</i>`
+	msgEmailSavedFormat   = `Email address of this chat was set to: %s`
+	msgEmailReset         = `Email address of this chat was reset.`
+	msgEmailInvalidFormat = `Invalid email address: %s`
+	msgEmailNotConfigured = `Email fallback is not configured. Set 'smtp' in the config file.`
+	msgEmailSubjectFormat = `Reminder: %s`
+	msgEmailBodyFormat    = "%s\n\n(This reminder was sent by email, because it could not be delivered on Telegram.)"
+	msgChannelsFormat     = `Extra channels of this chat: <b>%s</b>
+
+Set them with: <code>/channels email,webhook</code>
+Reset them with: <code>/channels none</code>
+
+(Reminders delivered here will also be sent to them, eg. to the address of /email or the url of /webhook.)`
+	msgChannelsNotSet        = `<i>(none)</i>`
+	msgChannelsSavedFormat   = `Extra channels of this chat were set to: %s`
+	msgChannelsReset         = `Extra channels of this chat were reset.`
+	msgChannelsInvalidFormat = `Invalid channels: %s (available: %s)`
+	msgWebhookFormat         = `Webhook url of this chat: <b>%s</b>
+
+Set it with: <code>/webhook https://example.com/hook</code>
+Reset it with: <code>/webhook reset</code>
+
+(Delivered reminders will be POSTed to it as JSON, if <code>webhook</code> is one of /channels.)`
+	msgWebhookNotSet          = `<i>(not set)</i>`
+	msgWebhookSavedFormat     = `Webhook url of this chat was set to: %s`
+	msgWebhookReset           = `Webhook url of this chat was reset.`
+	msgWebhookInvalidFormat   = `Invalid webhook url: %s`
+	msgStatsChartFormat       = "\n\n<i>(Reminders created per day for the last %d days, today in orange)</i>"
+	msgStatsGraphFormat       = "Reminders of this chat created per day for the last %d days (today in orange): <b>%d</b> in total"
+	msgStatsGraphFailed       = `Failed to draw the chart of reminders.`
+	msgFailedParsesFormat     = "Latest %d failed parses:\n\n%s"
+	msgFailedParseItemFormat  = "• %s <i>(%s)</i>: %s\n  ↳ <code>%s</code>"
+	msgFailedParseNotSaved    = `<i>(not saved)</i>`
+	msgNoFailedParses         = `There is no failed parse.`
+	msgAdminOnly              = `Only admin users can do this.`
+	msgUserActivitiesFormat   = "Users (%d), by their last interactions:\n\n%s\n\n* Inactive for %d days or more: <b>%d</b>"
+	msgUserActivityItemFormat = "• %s: %s"
+	msgUserActivityNever      = `<i>(never)</i>`
+	msgNoUserActivities       = `There is no user who interacted with this bot yet.`
+	msgStatsUsersUsage        = "Usage: <code>/stats users [days]</code> (eg. <code>/stats users 30</code>)"
+	msgPrivacyPromptsStored   = "\n\nTexts of messages in this chat are saved for statistics. Stop saving them with: <code>/privacy off</code>"
+	msgPrivacyPromptsNotSaved = "\n\nTexts of messages in this chat are not saved (only the numbers of tokens and the results are). Save them again with: <code>/privacy on</code>"
+	msgPrivacyPromptsDisabled = "\n\nTexts of messages are not saved by this bot (only the numbers of tokens and the results are)."
+	msgPrivacyOff             = `Texts of messages in this chat will not be saved from now on.`
+	msgPrivacyOn              = `Texts of messages in this chat will be saved for statistics from now on.`
+	msgDatetimeFormatFormat   = `Datetime format of this chat: <b>%s</b> (eg. %s)
+
+Select one of the formats below, or set it with: <code>/datetime dmy12</code>
+Reset it with: <code>/datetime reset</code>`
+	msgDatetimeFormatSavedFormat   = `Datetime format of this chat was set to: %s (eg. %s)`
+	msgDatetimeFormatInvalidFormat = `Invalid datetime format: %s (available: %s)`
+	msgStartAgain                  = `Welcome back! Send me what to be reminded of and when (eg. 'tomorrow 9am call mom'), or see /help for more.`
+	msgStartNotAllowed             = `Hi! This bot is only for allowed users. Ask the bot's owner to add your username, and see /whoami for your account.`
+	msgOnboardingAskTimezone       = `Hi! This bot will reserve your messages and notify you at desired times.
+
+First, which timezone are you in? Select one below, share your location, or set it with: <code>/timezone Asia/Seoul</code>
+(Your messages are understood in <b>%s</b> now.)`
+	msgOnboardingSkip         = `Skip`
+	msgOnboardingSkipped      = `Timezone was not set. (You can set it later with /timezone.)`
+	msgOnboardingFirstMessage = "Hi! Send me what to be reminded of and when in plain words, for example:\n\n* tomorrow 9am call mom\n* in 30 minutes take out the laundry\n\nYour first message will be handled right away, and then your timezone will be asked (you can also set it later with /timezone). See /help for more."
+	msgOnboardingDone         = "\n\nAll set! Now send me what to be reminded of and when, for example:\n\n* tomorrow 9am call mom\n* in 30 minutes take out the laundry\n* quietly remind me to water the plants at 3pm\n\nSee /help for more."
+	msgRecurrenceFormat       = "\n(repeated with: %s)"
+	msgRecurrenceUntilFormat  = "\n(repeated with: %s, until %s)"
+	msgRecurrenceEnded        = "\n\n(This was the last one of the recurring reminder.)"
+	msgListItemUntilFormat    = ` (until %s)`
+	msgListItemLeadFormat     = ` ⏳ %s before the event on %s`
+	msgListItemIntervalFormat = ` (every %s until %s)`
+	msgIntervalFormat         = "\n(every %s until %s of each day)"
+	msgLeadFormat             = "\n(%s before the event on %s)"
+	msgPrefixFormat           = `Prefix of delivered reminders in this chat: %s
+
+Set it with: <code>/prefix ⏰ Reminder:</code>
+Remove it with: <code>/prefix none</code>
+Reset it to the default with: <code>/prefix reset</code>`
+	msgPrefixNone          = `<i>(none)</i>`
+	msgPrefixSavedFormat   = `Prefix of delivered reminders in this chat was set to: %s`
+	msgPrefixRemoved       = `Prefix of delivered reminders in this chat was removed.`
+	msgPrefixReset         = `Prefix of delivered reminders in this chat was reset to the default.`
+	msgPrefixTooLongFormat = `Prefix is too long. (max: %d characters)`
+	msgICalCaptionFormat   = `%d reminder(s) of this chat, in %s.`
+	msgICalFailed          = `Failed to export reminders.`
+	msgICalFeedFormat      = "Subscribe to this url in calendar apps, for the reminders of this chat:\n\n<code>%s</code>\n\nAnyone with the url can see the reminders. Get a new url (and invalidate this one) with: <code>/ical feed reset</code>"
+	msgICalFeedDisabled    = `iCalendar feeds are not enabled on this bot.`
+	msgTestReminder        = `🧪 This is a test reminder (of /test). Reminders are delivered well.`
+	msgTestScheduledFormat = `A test reminder will be delivered on %s. (It can be delayed for up to %d seconds, depending on <code>monitor_interval_seconds</code>.)`
+	msgWeekStartFormat     = `First day of weeks in this chat: <b>%s</b>
+
+Set it with: <code>/weekstart sunday</code> (available: %s)
+Reset it with: <code>/weekstart reset</code>`
+	msgWeekStartSavedFormat   = `First day of weeks in this chat was set to %s.`
+	msgWeekStartReset         = `First day of weeks in this chat was reset to the default.`
+	msgWeekStartInvalidFormat = `Invalid first day of weeks: %s (available: %s)`
+	msgPromptTooLongFormat    = `Your message is too long. Please keep it within %d characters (eg. <code>tomorrow 9am call mom</code>).`
+	msgTooSoonFormat          = `Reminders should be at least %d second(s) later from now. Please try a later time.`
 	msgPrivacy                = "Privacy Policy:\n\n" + githubPageURL + `/raw/master/PRIVACY.md`
+	msgMissedFormat           = `%s (missed)`
+	msgQueueStalledFormat     = `⚠ Reminder queue was not processed for %s. Please check the bot.`
+	msgPaused                 = `Reminders of this chat are paused. They will be delivered after /resume.`
+	msgResumed                = `Reminders of this chat are resumed.`
+	msgStatsChatPaused        = `<i>(Reminders of this chat are paused now.)</i>`
+	msgSnoozedFormat          = `Will notify '%s' again on %s.`
+	msgUndoSnooze             = `Undo snooze`
+	msgSnoozePresetsFormat    = `Snooze presets: <b>%s</b>
+
+Set them with: <code>/snooze 10m,1h,3h,tomorrow 9am</code>
+Reset them with: <code>/snooze reset</code>`
+	msgSnoozePresetsSavedFormat   = `Snooze presets were saved: <b>%s</b>`
+	msgSnoozePresetsInvalidFormat = `Invalid snooze presets: %s`
+	msgSnoozeReplyInvalidFormat   = `Failed to snooze: %s
+
+Reply to a delivered reminder with: <code>snooze 30m</code>, <code>snooze tomorrow 9am</code>, or <code>remind again in 2h</code>`
+
+	// (for reminders from lists)
+	msgBatchCreatedFormat    = `Created %d of %d reminder(s) from the list.`
+	msgBatchFailed           = `Not created:`
+	msgBatchFailedItemFormat = `✗ %s; %s`
+
+	// (for answering callback queries with `short_callback_answers`)
+	msgCallbackAnswered = `Done`
+
+	// (for /history)
+	msgHistoryItemFormat   = `✅ %s; %s`
+	msgHistoryMoreFormat   = `(<code>%s %d %d</code> for older ones)`
+	msgHistoryUsageFormat  = `Usage: <code>%s [number of reminders] [page]</code> (eg. <code>%s 10 2</code>)`
+	msgNoHistory           = `There is no delivered reminder.`
+	msgNoHistoryPageFormat = `There is no delivered reminder on page %d.`
+
+	// (for confirming parsed items with low confidence)
+	msgNotConfident = "\n\n(Not sure about the time, so please confirm it.)"
+
+	// (for /forgetme)
+	msgForgetMeWarningFormat = `⚠️ This will delete <b>all</b> data of this chat from the bot: reminders, prompts, settings, presets, and aliases (and your own API key, in private chats). It cannot be undone.
+
+Send <code>%s %s</code> to continue.`
+	msgForgetMeDoneFormat = `All data of this chat were deleted (%d row(s)).`
+	msgForgetMeNotAllowed = `In group chats, only admin users can delete all data of the chat.`
+
+	// (for the errors of parsing)
+	msgParseFailedNoDatetime       = `Could not find when to notify in the message. Add a time to it (eg. 'tomorrow 9am call mom').`
+	msgParseFailedAmbiguous        = `Could not understand the message. Try rephrasing it with what and when (eg. 'in 30 minutes take out the laundry').`
+	msgParseFailedModelUnavailable = `The model is not available now (eg. busy, or out of quota). Try again in a while.`
+
+	// (for times of inline keyboards which passed before they were selected)
+	msgSelectedTimePassedFormat = `The selected time has already passed. Send the message again for a new time: '%s'.`
+
+	// (for re-notifications until acknowledged, and active hours)
+	msgEscalateUsage         = `Usage: <code>/escalate 30m</code> for re-notifying a reminder every 30 minutes until it is acknowledged, or <code>/escalate off</code> for stopping it.`
+	msgEscalateWhat          = `Which reminder do you want to re-notify until acknowledged?`
+	msgEscalateSetFormat     = `'%s' will be re-notified every %s until acknowledged (up to %d times).`
+	msgEscalateOffFormat     = `'%s' will not be re-notified.`
+	msgEscalateInvalidFormat = `Invalid interval of re-notifications: %s`
+	msgEscalationFormat      = `🔁 %s`
+	msgAcknowledge           = `✅ Got it`
+	msgAcknowledgedFormat    = "%s\n\n(acknowledged ✅)"
+	msgActiveHoursFormat     = `Active hours of this chat: <b>%s</b>
+
+Escalated reminders (<code>/escalate</code>) are re-notified only within them.
+Set them with: <code>/activehours 09:00-18:00</code> (or over midnight, eg. <code>/activehours 22:00-06:00</code>)
+Reset them with: <code>/activehours reset</code>`
+	msgActiveHoursAny           = `<i>(any time)</i>`
+	msgActiveHoursSavedFormat   = `Active hours of this chat were set to %s.`
+	msgActiveHoursReset         = `Active hours of this chat were reset. (any time)`
+	msgActiveHoursInvalidFormat = `Invalid active hours: %s`
+
+	promptWithTimezoneFormat = `(User's timezone is '%s', and the current datetime there is '%s'.) %s`
+	promptWithAliasesFormat  = `(User's phrases of times: %s.) %s`
 
 	systemInstruction = `You are a kind and considerate chat bot which is built for understanding user's prompt, extracting desired datetime and prompt from it, and sending the prompt at the exact datetime. Current datetime is '%s'.`
 
 	// function call
-	fnNameInferDatetime              = `infer_datetime`
-	fnDescriptionInferDatetime       = `This function infers a datetime and a message from the original prompt text.`
-	fnArgNameInferredDatetime        = `inferred_datetime`
-	fnArgDescriptionInferredDatetime = `Inferred datetime which is formatted as 'yyyy.mm.dd hh:MM TZ'(eg. 2024.12.25 15:00 KST). If the time cannot be inferred, fallback to %02d:00.`
-	fnArgNameMessageToSend           = `message_to_send`
-	fnArgDescriptionMessageToSend    = `Inferred message to be sent at 'inferred_datetime'. If it cannot be inferred, use the original prompt.`
+	fnNameInferDatetime                 = `infer_datetime`
+	fnDescriptionInferDatetime          = `This function infers a datetime and a message from the original prompt text.`
+	fnArgNameInferredDatetime           = `inferred_datetime`
+	fnArgDescriptionInferredDatetime    = `Inferred datetime which is formatted as 'yyyy.mm.dd hh:MM TZ'(eg. 2024.12.25 15:00 KST). If the time cannot be inferred, fallback to %02d:%02d.`
+	fnArgNameMessageToSend              = `message_to_send`
+	fnArgDescriptionMessageToSend       = `Inferred message to be sent at 'inferred_datetime'. If it cannot be inferred, use the original prompt. Keep the line breaks of the original prompt.`
+	fnArgNameSilent                     = `silent`
+	fnArgDescriptionSilent              = `Whether the user wants to be reminded quietly (eg. 'quietly remind me...', 'silently', 'without sound'). False if not mentioned.`
+	fnArgNameRecurrence                 = `recurrence`
+	fnArgDescriptionRecurrence          = `Cron expression ('minute hour day-of-month month day-of-week', eg. '0 9 * * *' for every day at 09:00) if the user wants to be reminded repeatedly (eg. 'every day', 'every monday'). Empty if not repeated.`
+	fnArgNameRecurrenceUntil            = `recurrence_until`
+	fnArgNameLeadMinutes                = `remind_before_minutes`
+	fnArgNameRecurrenceInterval         = `recurrence_interval_minutes`
+	fnArgDescriptionRecurrenceInterval  = `Interval in minutes if the user wants to be reminded repeatedly within a day (eg. 60 for 'every hour between 9 and 5', 90 for 'every 90 minutes from 10am to 6pm'). Then 'recurrence' should be the first time of each day (eg. '0 9 * * *'), and 'recurrence_window_end' the last one. Zero if not mentioned.`
+	fnArgNameRecurrenceWindowEnd        = `recurrence_window_end`
+	fnArgDescriptionRecurrenceWindowEnd = `End of the time window of each day for 'recurrence_interval_minutes', formatted as 'hh:MM' (eg. '17:00' for 'between 9 and 5'). Empty if not mentioned.`
+	fnArgDescriptionLeadMinutes         = `Number of minutes before 'inferred_datetime' when the user wants to be notified in advance (eg. 15 for 'remind me 15 minutes before the 3pm meeting', 1440 for 'a day before'). 'inferred_datetime' should be the time of the event itself. Zero if not mentioned.`
+	fnArgNameConfidence                 = `confidence`
+	fnArgDescriptionConfidence          = `How confident you are about 'inferred_datetime', from 0.0 (a wild guess) to 1.0 (explicitly given, eg. 'tomorrow 9am'). Lower it for vague or ambiguous times (eg. 'later', 'at 7' without am/pm, 'next weekend').`
+	fnArgDescriptionRecurrenceUntil     = `Datetime until which the recurring reminder should be repeated (eg. 'every day until friday'), formatted as 'yyyy.mm.dd hh:MM TZ'. If the time is not given, use 23:59 of the day. Empty if not mentioned.`
 
 	datetimeFormat = `2006.01.02 15:04 MST` // yyyy.mm.dd hh:MM TZ
 
 	// default configs
-	defaultMonitorIntervalSeconds  = 30
-	defaultTelegramIntervalSeconds = 60
-	defaultMaxNumTries             = 5
-	defaultGenerativeModel         = "gemini-1.5-flash-latest"
+	defaultMonitorIntervalSeconds   = 30
+	defaultTelegramIntervalSeconds  = 60
+	defaultMaxNumTries              = 5
+	defaultGenerativeModel          = "gemini-1.5-flash-latest"
+	defaultMissedRemindersInterval  = 3
+	defaultQueueStallThresholdRatio = 10
+	defaultRateLimitBurst           = 3
+	defaultChatActionDebounce       = 5
+	parseRetryBackoff               = 500 * time.Millisecond // doubled on each retry
+	sendRetryBackoff                = 500 * time.Millisecond // doubled on each retry
+	sendMaxRetryAfter               = 10 * time.Second       // not retried if telegram asks to wait longer than this
+	logsPurgeInterval               = 1 * time.Hour          // for `log_retention`
+
+	// policies for the time of reminders with a day but no time (eg. "tomorrow")
+	noTimePolicyStartOfDay = "start_of_day" // 00:00
+	noTimePolicyFixedHour  = "fixed_hour"   // `default_hour`:00 (default)
+	noTimePolicyEndOfDay   = "end_of_day"   // 23:59
+
+	// behaviors for reminders missed while the bot was down
+	missedRemindersFlood   = "flood"   // deliver all of them at once (default)
+	missedRemindersTrickle = "trickle" // deliver them one by one, with a '(missed)' marker
+	missedRemindersSkip    = "skip"    // do not deliver them at all
+
+	// snooze presets
+	defaultSnoozePresets = "10m,1h,3h,tomorrow 9am"
+	maxSnoozePresets     = 6
+
+	// other limits
+	maxMilestones         = 5
+	maxTimezoneCandidates = 4
+	maxPresetNameLength   = 20
+	maxAliasPhraseLength  = 30
+	maxAliasesPerChat     = 30
+	maxPrefixLength       = 20
+	maxCaptionLength      = 1024 // of photos
+	maxCallbackDataLength = 64   // bytes, of inline keyboard buttons
+
+	// steps of onboarding (`ChatSetting.OnboardingStep`, 0 if not started)
+	onboardingAskedTimezone = 1
+	onboardingDone          = 2
+
+	// number of reminders shown for confirming /cancelall
+	maxCancelAllPreviews = 10
+
+	// number of failed parses in `/stats failed`, and the maximum length of their texts
+	failedParsesLimit     = 10
+	failedParseTextLength = 100
+
+	// maximum length of messages in lists (eg. /list, /cancel), only their first lines are shown
+	listItemMessageLength = 100
+
+	// lists with more reminders than this are sent without cancel buttons (not to exceed the limits of inline keyboards)
+	maxListCancelButtons = 50
+
+	// maximum length of messages in the cancel buttons of /list
+	listButtonMessageLength = 30
+
+	// days of the chart in /stats
+	statsChartDays = 30
+
+	// number of reminders in a page of /history (by default, and at most)
+	historyItemsPerPage    = 10
+	maxHistoryItemsPerPage = 50
+
+	// users who did not interact with the bot for these days are counted as inactive in `/stats users` (by default)
+	inactiveUserDays = 30
+
+	// delay of the test reminder of /test
+	testReminderDelay = 10 * time.Second
+
+	// rate limit of /whoami for each user (applied to everyone, even when not allowed)
+	whoAmIRatePerMinute = 2
+	whoAmIRateBurst     = 2
+
+	// interval of replies to each not-allowed user (`unauthorized_reply`)
+	unauthorizedReplyInterval = 10 * time.Minute
+
+	feedbackSeparator = "\n\n(feedback: "
+
+	// arguments of commands
+	argListVerbose      = "verbose"
+	argListSort         = "sort="
+	argSnoozeReset      = "reset"
+	argTimezoneReset    = "reset"
+	argEmailReset       = "reset"
+	argDatetimeReset    = "reset"
+	argHelpful          = "up"
+	argConfirm          = "confirm"
+	argPresetSave       = "save"
+	argPresetUse        = "use"
+	argPresetList       = "list"
+	argPresetDelete     = "delete"
+	argAliasAdd         = "add"
+	argAliasList        = "list"
+	argAliasDelete      = "delete"
+	argNotHelpful       = "down"
+	argPrivacyOff       = "off"
+	argPrivacyOn        = "on"
+	argSkip             = "skip"
+	argPrefixReset      = "reset"
+	argPrefixNone       = "none"
+	argChannelsNone     = "none"
+	argWebhookReset     = "reset"
+	argWeekStartReset   = "reset"
+	argICalFeed         = "feed"
+	argICalFeedReset    = "reset"
+	argStatsGraph       = "graph"
+	argStatsFailed      = "failed"
+	argStatsUsers       = "users"
+	argEscalateOff      = "off"
+	argActiveHoursReset = "reset"
+
+	// sort keys of /list
+	listSortFireOn  = "fire"    // by fire time ascending (default)
+	listSortCreated = "created" // by created time descending (newest first)
+	listSortMessage = "message" // by message alphabetically
+
+	// environment variables
+	envTelegramBotToken     = "TELEGRAM_BOT_TOKEN"
+	envGoogleAIAPIKey       = "GOOGLE_AI_API_KEY"
+	envDBFilepath           = "DB_FILEPATH"
+	envAllowedTelegramUsers = "ALLOWED_TELEGRAM_USERS"
 
 	githubPageURL = `https://github.com/meinside/telegram-reminder-bot`
 )
@@ -100,6 +582,11 @@ var _location *time.Location
 type config struct {
 	GoogleGenerativeModel string `json:"google_generative_model,omitempty"`
 
+	// parameters of generation (defaults of the model if not given)
+	Temperature     *float32 `json:"temperature,omitempty"` // lower for more deterministic results (0.0 ~ 2.0)
+	TopP            *float32 `json:"top_p,omitempty"`       // (0.0 ~ 1.0)
+	MaxOutputTokens int32    `json:"max_output_tokens,omitempty"`
+
 	MonitorIntervalSeconds  int    `json:"monitor_interval_seconds"`
 	TelegramIntervalSeconds int    `json:"telegram_interval_seconds"`
 	MaxNumTries             int    `json:"max_num_tries"`
@@ -107,8 +594,123 @@ type config struct {
 
 	// other optional configurations
 	AllowedTelegramUsers []string `json:"allowed_telegram_users"`
+	AdminTelegramUsers   []string `json:"admin_telegram_users,omitempty"`
+	AllowedChatIDs       []int64  `json:"allowed_chat_ids,omitempty"` // chats (eg. groups) in which everyone can use this bot, regardless of `allowed_telegram_users`
 	DefaultHour          int      `json:"default_hour,omitempty"`
+	NoTimePolicy         string   `json:"no_time_policy,omitempty"` // "start_of_day", "fixed_hour" (default, with `default_hour`), or "end_of_day"
 	Verbose              bool     `json:"verbose,omitempty"`
+	LogFormat            string   `json:"log_format,omitempty"`    // "text" (default) or "json"
+	LogRetention         string   `json:"log_retention,omitempty"` // logs in the database older than this (eg. "30d", "72h") are purged (kept forever if empty)
+
+	// behavior for reminders missed while the bot was down: "flood" (default), "trickle", or "skip"
+	MissedReminders                string `json:"missed_reminders,omitempty"`
+	MissedRemindersIntervalSeconds int    `json:"missed_reminders_interval_seconds,omitempty"`
+
+	// retry parsing on transient errors of the API (eg. network errors, timeouts, or 5xx errors)
+	ParseMaxRetries int `json:"parse_max_retries,omitempty"`
+
+	// retry sending messages (eg. confirmations and reminders) on transient errors of telegram (eg. network errors, 5xx errors, or too many requests)
+	SendMaxRetries int `json:"send_max_retries,omitempty"`
+
+	// show the understood time with buttons for confirming (or changing) it, before saving each reminder
+	ConfirmBeforeSchedule bool `json:"confirm_before_schedule,omitempty"`
+
+	// confirm single parsed items (like `confirm_before_schedule`) when the model is less confident than this about their times (0.0 ~ 1.0, 0 for never)
+	MinConfidenceToSchedule float64 `json:"min_confidence_to_schedule,omitempty"`
+
+	// cache results of parsing identical texts (in the same chat timezone, on the same day) for this many seconds
+	ParseCacheTTLSeconds int `json:"parse_cache_ttl_seconds,omitempty"` // 0 for no cache
+
+	// types of unsupported messages (eg. "sticker", "photo", "voice", "other") which will be replied with 'not supported'
+	// (all of them if not set, none if empty)
+	UnsupportedTypesToReply []string `json:"unsupported_types_to_reply,omitempty"`
+
+	// remove tags (eg. "#work") from delivered reminders
+	StripTags bool `json:"strip_tags,omitempty"`
+
+	// chat actions (eg. 'is typing...') are not sent again to the same chat within this interval
+	ChatActionDebounceSeconds int `json:"chat_action_debounce_seconds,omitempty"`
+
+	// save messages without any clue for datetime as undated reminders
+	SaveUndatedReminders bool `json:"save_undated_reminders,omitempty"`
+
+	// rate limit of messages for each user (except for admin users)
+	RateLimitPerMinute int `json:"rate_limit_per_minute,omitempty"` // 0 for no limit
+	RateLimitBurst     int `json:"rate_limit_burst,omitempty"`
+
+	// when the requested time has already passed (eg. "at 9am" at 10am), roll it to the next day instead of asking
+	RollPastRemindersToNextDay bool `json:"roll_past_reminders_to_next_day,omitempty"`
+
+	// maximum number of active reminders of each chat (except for admin users)
+	MaxActiveRemindersPerChat int `json:"max_active_reminders_per_chat,omitempty"` // 0 for no limit
+
+	// messages longer than this (in characters) will be rejected without parsing (except for admin users)
+	MaxPromptChars int `json:"max_prompt_chars,omitempty"` // 0 for no limit
+
+	// reminders sooner than this will be rejected (except for admin users)
+	MinLeadTimeSeconds int `json:"min_lead_time_seconds,omitempty"`
+
+	// alert when the queue was not processed for this long (default: 10 times of `monitor_interval_seconds`)
+	QueueStallThresholdSeconds int   `json:"queue_stall_threshold_seconds,omitempty"`
+	AlertChatID                int64 `json:"alert_chat_id,omitempty"` // (eg. admin's chat id) for receiving alerts
+
+	// restart polling updates when no updates (nor errors) were received for this long (0 for never)
+	PollingIdleRestartSeconds int `json:"polling_idle_restart_seconds,omitempty"`
+
+	// when a chat becomes unreachable (eg. bot was blocked), mark all of its reminders as failed
+	FailAllRemindersOfUnreachableChat bool `json:"fail_all_reminders_of_unreachable_chat,omitempty"`
+
+	// in group chats, handle only messages with /remind command (and replies to the bot's questions)
+	RemindCommandOnlyInGroups bool `json:"remind_command_only_in_groups,omitempty"`
+
+	// do not send a new message when editing a message (eg. in callback queries) fails
+	DisableEditFallback bool `json:"disable_edit_fallback,omitempty"`
+
+	// answer callback queries with a short toast, and show the full results only in the edited messages
+	ShortCallbackAnswers bool `json:"short_callback_answers,omitempty"`
+
+	// handle numbered or bulleted lists as single messages, not as reminders of each item
+	DisableListReminders bool `json:"disable_list_reminders,omitempty"`
+
+	// SMTP server for sending reminders by email, when they cannot be delivered on telegram (disabled if not set)
+	SMTP *smtpConfig `json:"smtp,omitempty"`
+
+	// admin HTTP API (disabled if not set)
+	AdminAPI *adminAPIConfig `json:"admin_api,omitempty"`
+
+	// HTTP server of iCalendar feeds which calendar apps can subscribe to (disabled if not set)
+	ICalFeed *icalFeedConfig `json:"ical_feed,omitempty"`
+
+	// save the texts (and senders) of prompts in the database for statistics (default: true, can be turned off for each chat with /privacy)
+	StorePrompts *bool `json:"store_prompts,omitempty"`
+
+	// append the number of tokens used for parsing to the confirmation messages
+	ShowTokenUsage bool `json:"show_token_usage,omitempty"`
+
+	// do not guide new users through the onboarding steps (eg. setting timezone) on /start, or on their first messages
+	SkipOnboarding bool `json:"skip_onboarding,omitempty"`
+
+	// guide (in HTML) shown to new users before handling their first messages (default one if empty)
+	OnboardingMessage string `json:"onboarding_message,omitempty"`
+
+	// reply to users who are not allowed (eg. "This bot is private, contact @admin for access"), silent if empty
+	UnauthorizedReply string `json:"unauthorized_reply,omitempty"`
+
+	// default prefix of delivered reminders (eg. "⏰ Reminder:"), which can be changed for each chat with /prefix
+	ReminderPrefix string `json:"reminder_prefix,omitempty"`
+
+	// commands which are not shown in the command menu of telegram (eg. ["/setkey", "/clearkey"])
+	HiddenCommands []string `json:"hidden_commands,omitempty"`
+
+	// send /stats with a chart image of reminders created per day (text only if not set)
+	StatsChart bool `json:"stats_chart,omitempty"`
+
+	// additional bots which run in the same process (sharing the Gemini client, and also the database if `db_filepath` is not given)
+	Bots []botConfig `json:"bots,omitempty"`
+
+	// key for encrypting sensitive data (eg. users' own API keys) in the database
+	EncryptionKey   string `json:"encryption_key,omitempty"`
+	EncryptMessages bool   `json:"encrypt_messages,omitempty"` // also encrypt messages of reminders with `encryption_key`
 
 	// token and api key
 	TelegramBotToken *string `json:"telegram_bot_token,omitempty"`
@@ -134,6 +736,12 @@ func loadConfig(fpath string) (conf config, err error) {
 	if bytes, err = os.ReadFile(fpath); err == nil {
 		if bytes, err = standardizeJSON(bytes); err == nil {
 			if err = json.Unmarshal(bytes, &conf); err == nil {
+				// override values with environment variables
+				// (precedence: environment variables > config > Infisical)
+				if err = applyEnvOverrides(&conf); err != nil {
+					return config{}, err
+				}
+
 				if (conf.TelegramBotToken == nil || conf.GoogleAIAPIKey == nil) &&
 					conf.Infisical != nil {
 					// read token and api key from infisical
@@ -150,35 +758,39 @@ func loadConfig(fpath string) (conf config, err error) {
 					var secret models.Secret
 
 					// telegram bot token
-					keyPath = conf.Infisical.TelegramBotTokenKeyPath
-					secret, err = client.Secrets().Retrieve(infisical.RetrieveSecretOptions{
-						ProjectID:   conf.Infisical.ProjectID,
-						Type:        conf.Infisical.SecretType,
-						Environment: conf.Infisical.Environment,
-						SecretPath:  path.Dir(keyPath),
-						SecretKey:   path.Base(keyPath),
-					})
-					if err == nil {
-						val := secret.SecretValue
-						conf.TelegramBotToken = &val
-					} else {
-						return config{}, fmt.Errorf("failed to retrieve `telegram_bot_token` from Infisical: %s", err)
+					if conf.TelegramBotToken == nil {
+						keyPath = conf.Infisical.TelegramBotTokenKeyPath
+						secret, err = client.Secrets().Retrieve(infisical.RetrieveSecretOptions{
+							ProjectID:   conf.Infisical.ProjectID,
+							Type:        conf.Infisical.SecretType,
+							Environment: conf.Infisical.Environment,
+							SecretPath:  path.Dir(keyPath),
+							SecretKey:   path.Base(keyPath),
+						})
+						if err == nil {
+							val := secret.SecretValue
+							conf.TelegramBotToken = &val
+						} else {
+							return config{}, fmt.Errorf("failed to retrieve `telegram_bot_token` from Infisical: %s", err)
+						}
 					}
 
 					// google ai api key
-					keyPath = conf.Infisical.GoogleAIAPIKeyKeyPath
-					secret, err = client.Secrets().Retrieve(infisical.RetrieveSecretOptions{
-						ProjectID:   conf.Infisical.ProjectID,
-						Type:        conf.Infisical.SecretType,
-						Environment: conf.Infisical.Environment,
-						SecretPath:  path.Dir(keyPath),
-						SecretKey:   path.Base(keyPath),
-					})
-					if err == nil {
-						val := secret.SecretValue
-						conf.GoogleAIAPIKey = &val
-					} else {
-						return config{}, fmt.Errorf("failed to retrieve `google_ai_api_key` from Infisical: %s", err)
+					if conf.GoogleAIAPIKey == nil {
+						keyPath = conf.Infisical.GoogleAIAPIKeyKeyPath
+						secret, err = client.Secrets().Retrieve(infisical.RetrieveSecretOptions{
+							ProjectID:   conf.Infisical.ProjectID,
+							Type:        conf.Infisical.SecretType,
+							Environment: conf.Infisical.Environment,
+							SecretPath:  path.Dir(keyPath),
+							SecretKey:   path.Base(keyPath),
+						})
+						if err == nil {
+							val := secret.SecretValue
+							conf.GoogleAIAPIKey = &val
+						} else {
+							return config{}, fmt.Errorf("failed to retrieve `google_ai_api_key` from Infisical: %s", err)
+						}
 					}
 				}
 
@@ -198,6 +810,39 @@ func loadConfig(fpath string) (conf config, err error) {
 				if conf.DefaultHour < 0 || conf.DefaultHour >= 24 {
 					conf.DefaultHour = 0
 				}
+				switch conf.MissedReminders {
+				case missedRemindersFlood, missedRemindersTrickle, missedRemindersSkip:
+					// do nothing
+				default:
+					conf.MissedReminders = missedRemindersFlood
+				}
+				switch conf.NoTimePolicy {
+				case noTimePolicyStartOfDay, noTimePolicyFixedHour, noTimePolicyEndOfDay:
+					// do nothing
+				default:
+					conf.NoTimePolicy = noTimePolicyFixedHour
+				}
+				if conf.QueueStallThresholdSeconds <= conf.MonitorIntervalSeconds {
+					conf.QueueStallThresholdSeconds = conf.MonitorIntervalSeconds * defaultQueueStallThresholdRatio
+				}
+				if conf.RateLimitBurst <= 0 {
+					conf.RateLimitBurst = defaultRateLimitBurst
+				}
+				if conf.MissedRemindersIntervalSeconds <= 0 {
+					conf.MissedRemindersIntervalSeconds = defaultMissedRemindersInterval
+				}
+				if conf.ChatActionDebounceSeconds <= 0 {
+					conf.ChatActionDebounceSeconds = defaultChatActionDebounce
+				}
+				if conf.StorePrompts == nil {
+					storePrompts := true
+					conf.StorePrompts = &storePrompts
+				}
+				if conf.LogRetention != "" {
+					if _, err := parseDuration(conf.LogRetention); err != nil {
+						return config{}, fmt.Errorf("invalid `log_retention`: %s", err)
+					}
+				}
 			}
 		}
 	}
@@ -205,6 +850,137 @@ func loadConfig(fpath string) (conf config, err error) {
 	return conf, err
 }
 
+// override values of given config with environment variables (if they exist)
+func applyEnvOverrides(conf *config) error {
+	if val, exists := os.LookupEnv(envTelegramBotToken); exists && val != "" {
+		conf.TelegramBotToken = &val
+	}
+	if val, exists := os.LookupEnv(envGoogleAIAPIKey); exists && val != "" {
+		conf.GoogleAIAPIKey = &val
+	}
+	if val, exists := os.LookupEnv(envDBFilepath); exists && val != "" {
+		conf.DBFilepath = val
+	}
+	if val, exists := os.LookupEnv(envAllowedTelegramUsers); exists && strings.TrimSpace(val) != "" {
+		val = strings.TrimSpace(val)
+
+		if strings.HasPrefix(val, "[") { // JSON array: replaces the ones from the config file
+			var users []string
+			if err := json.Unmarshal([]byte(val), &users); err != nil {
+				return fmt.Errorf("failed to parse `%s` as a JSON array: %s", envAllowedTelegramUsers, err)
+			}
+			conf.AllowedTelegramUsers = users
+		} else { // comma or space separated: merged with the ones from the config file
+			for _, user := range strings.FieldsFunc(val, func(r rune) bool {
+				return r == ',' || unicode.IsSpace(r)
+			}) {
+				if !slices.Contains(conf.AllowedTelegramUsers, user) {
+					conf.AllowedTelegramUsers = append(conf.AllowedTelegramUsers, user)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validate given config, and return warnings and (fatal) errors
+func validateConfig(conf config) (warnings []string, errs []error) {
+	warnings, errs = []string{}, []error{}
+
+	// fatal errors
+	if conf.TelegramBotToken == nil || *conf.TelegramBotToken == "" {
+		errs = append(errs, fmt.Errorf("`telegram_bot_token` is missing"))
+	}
+	if conf.GoogleAIAPIKey == nil || *conf.GoogleAIAPIKey == "" {
+		errs = append(errs, fmt.Errorf("`google_ai_api_key` is missing"))
+	}
+
+	// warnings
+	if len(conf.AllowedTelegramUsers) <= 0 && len(conf.AllowedChatIDs) <= 0 {
+		warnings = append(warnings, "`allowed_telegram_users` and `allowed_chat_ids` are empty, so nobody can use this bot")
+	}
+	for _, user := range conf.AllowedTelegramUsers {
+		if strings.HasPrefix(user, "@") {
+			warnings = append(warnings, fmt.Sprintf("username '%s' in `allowed_telegram_users` should not start with '@'", user))
+		}
+	}
+	for _, admin := range conf.AdminTelegramUsers {
+		if !slices.Contains(conf.AllowedTelegramUsers, admin) {
+			warnings = append(warnings, fmt.Sprintf("admin user '%s' is not in `allowed_telegram_users`", admin))
+		}
+	}
+	if conf.DBFilepath == "" {
+		warnings = append(warnings, "`db_filepath` is missing, so reminders will be lost on restart")
+	}
+	if !strings.HasPrefix(conf.GoogleGenerativeModel, "gemini-") {
+		warnings = append(warnings, fmt.Sprintf("`google_generative_model` '%s' does not look like a known model", conf.GoogleGenerativeModel))
+	}
+	if conf.MinConfidenceToSchedule < 0 || conf.MinConfidenceToSchedule > 1 {
+		errs = append(errs, fmt.Errorf("`min_confidence_to_schedule` (%g) should be between 0.0 and 1.0", conf.MinConfidenceToSchedule))
+	}
+	if conf.Temperature != nil && (*conf.Temperature < 0 || *conf.Temperature > 2) {
+		errs = append(errs, fmt.Errorf("`temperature` (%g) should be between 0.0 and 2.0", *conf.Temperature))
+	}
+	if conf.TopP != nil && (*conf.TopP < 0 || *conf.TopP > 1) {
+		errs = append(errs, fmt.Errorf("`top_p` (%g) should be between 0.0 and 1.0", *conf.TopP))
+	}
+	if conf.MaxOutputTokens < 0 {
+		errs = append(errs, fmt.Errorf("`max_output_tokens` (%d) should not be negative", conf.MaxOutputTokens))
+	}
+	if !slices.Contains([]string{"", logFormatText, logFormatJSON}, conf.LogFormat) {
+		warnings = append(warnings, fmt.Sprintf("`log_format` '%s' is not supported, so '%s' will be used", conf.LogFormat, logFormatText))
+	}
+	if conf.AdminAPI != nil {
+		if conf.AdminAPI.Token == "" {
+			errs = append(errs, fmt.Errorf("`admin_api.token` is missing"))
+		}
+		if conf.AdminAPI.ListenAddr == "" {
+			errs = append(errs, fmt.Errorf("`admin_api.listen_addr` is missing"))
+		}
+		if len(conf.AdminAPI.ChatIDs) <= 0 {
+			warnings = append(warnings, "`admin_api.chat_ids` is empty, so no chat can be managed with the admin API")
+		}
+	}
+	if conf.ICalFeed != nil {
+		if conf.ICalFeed.ListenAddr == "" {
+			errs = append(errs, fmt.Errorf("`ical_feed.listen_addr` is missing"))
+		}
+		if conf.ICalFeed.BaseURL == "" {
+			errs = append(errs, fmt.Errorf("`ical_feed.base_url` is missing"))
+		} else if !isValidWebhookURL(conf.ICalFeed.BaseURL) { // (same rule as webhook urls)
+			errs = append(errs, fmt.Errorf("`ical_feed.base_url` '%s' is not a valid http(s) url", conf.ICalFeed.BaseURL))
+		}
+	}
+	for i, bot := range conf.Bots {
+		if bot.TelegramBotToken == "" {
+			errs = append(errs, fmt.Errorf("`bots[%d].telegram_bot_token` is missing", i))
+		}
+		if len(bot.AllowedTelegramUsers) <= 0 && len(bot.AllowedChatIDs) <= 0 {
+			warnings = append(warnings, fmt.Sprintf("`bots[%d].allowed_telegram_users` and `bots[%d].allowed_chat_ids` are empty, so nobody can use the bot", i, i))
+		}
+	}
+	if conf.SMTP != nil && (conf.SMTP.Host == "" || conf.SMTP.Port <= 0 || conf.SMTP.From == "") {
+		errs = append(errs, fmt.Errorf("`smtp.host`, `smtp.port`, and `smtp.from` are needed for email fallback"))
+	}
+	if conf.EncryptMessages && conf.EncryptionKey == "" {
+		errs = append(errs, fmt.Errorf("`encryption_key` is missing, but `encrypt_messages` is set"))
+	}
+	if conf.MinLeadTimeSeconds >= 60*60*24 {
+		warnings = append(warnings, fmt.Sprintf("`min_lead_time_seconds` (%d) is longer than a day", conf.MinLeadTimeSeconds))
+	}
+	if conf.PollingIdleRestartSeconds > 0 && conf.PollingIdleRestartSeconds < 60 {
+		warnings = append(warnings, fmt.Sprintf("`polling_idle_restart_seconds` (%d) is too short, polling will be restarted too often", conf.PollingIdleRestartSeconds))
+	}
+	for _, typ := range conf.UnsupportedTypesToReply {
+		if !slices.Contains(_unsupportedMessageTypes, typ) {
+			warnings = append(warnings, fmt.Sprintf("`unsupported_types_to_reply` has an unknown type '%s' (available: %s)", typ, strings.Join(_unsupportedMessageTypes, ", ")))
+		}
+	}
+
+	return warnings, errs
+}
+
 // standardize given JSON (JWCC) bytes
 func standardizeJSON(b []byte) ([]byte, error) {
 	ast, err := hujson.Parse(b)
@@ -217,686 +993,4747 @@ func standardizeJSON(b []byte) ([]byte, error) {
 }
 
 // launch bot with given parameters
-func runBot(conf config) {
+func runBot(conf config, confFilepath string) {
 	var err error
 
 	_location, _ = time.LoadLocation("Local")
 
-	token := conf.TelegramBotToken
-	apiKey := conf.GoogleAIAPIKey
+	setLogFormat(conf.LogFormat)
 
-	if token == nil || apiKey == nil {
-		logErrorAndDie(nil, "`telegram_bot_token` and/or `google_ai_api_key` missing")
+	// validate config
+	warnings, errs := validateConfig(conf)
+	for _, warning := range warnings {
+		logInfo("[warning] config: %s", warning)
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			logError(nil, "[error] config: %s", err)
+		}
+		logErrorAndDie(nil, "refusing to start with invalid config")
 	}
 
-	// telegram bot client
-	bot := tg.NewClient(*token)
-
-	// gemini things client
-	gtc, err := gt.NewClient(*conf.GoogleAIAPIKey, conf.GoogleGenerativeModel)
+	// gemini things client (shared by all bots)
+	gtc, err := newGeminiClient(*conf.GoogleAIAPIKey, conf.GoogleGenerativeModel)
 	if err != nil {
 		logErrorAndDie(nil, "error initializing gemini-things client: %s", err)
 	}
 	defer gtc.Close()
-	gtc.SetSystemInstructionFunc(func() string {
-		return fmt.Sprintf(systemInstruction, datetimeToStr(time.Now()))
-	})
 
 	// background context
 	ctx := context.Background()
 
-	// open database
-	var db *Database
-	if db, err = OpenDatabase(conf.DBFilepath); err != nil {
-		logErrorAndDie(nil, "failed to open database: %s", err)
+	// configs which can be reloaded (of the main bot, and additional ones)
+	confs := []*configHolder{}
+	for _, botConf := range botConfigs(conf) {
+		confs = append(confs, newConfigHolder(botConf))
+	}
+
+	// open databases (bots with the same `db_filepath` share one)
+	dbs := map[string]*Database{}
+	for _, holder := range confs {
+		botConf := holder.Load()
+		if _, exists := dbs[botConf.DBFilepath]; exists {
+			continue
+		}
+
+		var db *Database
+		if db, err = OpenDatabase(botConf.DBFilepath); err != nil {
+			logErrorAndDie(nil, "failed to open database: %s", err)
+		}
+
+		// encrypt/decrypt messages at rest
+		if conf.EncryptionKey != "" {
+			if migrated, err := db.SetEncryption(conf.EncryptionKey, conf.EncryptMessages); err == nil {
+				if migrated > 0 {
+					logInfo("encrypted %d existing value(s) in the database", migrated)
+				}
+			} else {
+				logErrorAndDie(nil, "failed to encrypt existing values in the database: %s", err)
+			}
+		}
+
+		dbs[botConf.DBFilepath] = db
 	}
 
-	_ = bot.DeleteWebhook(false) // delete webhook before polling updates
-	if b := bot.GetMe(); b.Ok {
+	go reloadConfigOnSignal(confFilepath, confs, dbs[conf.DBFilepath])
+
+	// launch bots
+	var wg sync.WaitGroup
+	claimed := map[string]bool{}
+	apiBots := apiBotDatabases{db: dbs[conf.DBFilepath]} // bots which share the main bot's database
+	for _, holder := range confs {
+		botConf := holder.Load()
+
+		// telegram bot client
+		bot := tg.NewClient(*botConf.TelegramBotToken)
+
+		_ = bot.DeleteWebhook(false) // delete webhook before polling updates
+		b := bot.GetMe()
+		if !b.Ok {
+			logInfo("failed to get bot info: %s", *b.Description)
+			continue
+		}
 		logInfo("launching bot: %s", userName(b.Result))
 
-		// monitor queue
-		logInfo("starting monitoring queue...")
-		go monitorQueue(
+		db := dbs[botConf.DBFilepath]
+		if len(confs) > 1 {
+			// rows created before running multiple bots (eg. reminders, chat settings) will belong to the first bot of each database
+			if !claimed[botConf.DBFilepath] {
+				if count, err := db.ClaimUnscopedRows(b.Result.ID); err == nil {
+					if count > 0 {
+						logInfo("%d existing reminder(s) (and settings of chats) will belong to bot: %s", count, userName(b.Result))
+					}
+				} else {
+					logErrorAndDie(nil, "failed to assign existing reminders to bot: %s", err)
+				}
+				claimed[botConf.DBFilepath] = true
+			}
+
+			// scope rows to each bot, so that a reminder created on a bot will be delivered by the bot (with the chat's settings on the bot)
+			db = db.ForBot(b.Result.ID)
+		}
+
+		if botConf.DBFilepath == conf.DBFilepath {
+			apiBots.add(b.Result.ID, db)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			launchBot(ctx, bot, holder, db, gtc)
+		}()
+	}
+
+	// admin HTTP API (for the bots which share the main bot's database)
+	if conf.AdminAPI != nil {
+		go func() {
+			if err := serveAdminAPI(*conf.AdminAPI, apiBots); err != nil {
+				logError(apiBots.db, "admin API stopped: %s", err)
+			}
+		}()
+	}
+
+	// iCalendar feeds (of the chats in the main bot's database)
+	if conf.ICalFeed != nil {
+		go func() {
+			db := dbs[conf.DBFilepath]
+			if err := serveICalFeed(*conf.ICalFeed, db); err != nil {
+				logError(db, "iCalendar feed server stopped: %s", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// set up handlers of given bot, monitor its queue, and poll updates (blocks)
+func launchBot(ctx context.Context, bot *tg.Bot, confs *configHolder, db *Database, gtc *gt.Client) {
+	conf := confs.Load()
+
+	// monitor queue (after handling reminders missed while the bot was down, or while trickling them)
+	logInfo("starting monitoring queue...")
+	go func(launchedAt time.Time) {
+		reconcileMissedReminders(bot, conf, db, launchedAt)
+
+		monitorQueue(
 			time.NewTicker(time.Duration(conf.MonitorIntervalSeconds)*time.Second),
 			bot,
-			conf,
+			confs,
 			db,
 		)
+	}(time.Now())
 
-		// set message handler
-		bot.SetMessageHandler(func(b *tg.Bot, update tg.Update, message tg.Message, edited bool) {
-			if !isAllowed(conf, update) {
-				logDebug(conf, "message not allowed: %s", userNameFromUpdate(update))
-				return
-			}
+	// watch queue for stalls
+	go watchQueue(
+		time.NewTicker(time.Duration(conf.MonitorIntervalSeconds)*time.Second),
+		bot,
+		confs,
+		db,
+	)
 
-			handleMessage(ctx, b, conf, db, gtc, update, message)
-		})
+	// watch updates for idle polling
+	go watchUpdates(
+		time.NewTicker(time.Duration(conf.MonitorIntervalSeconds)*time.Second),
+		bot,
+		confs,
+	)
 
-		// set callback query handler
-		bot.SetCallbackQueryHandler(func(b *tg.Bot, update tg.Update, callbackQuery tg.CallbackQuery) {
-			if !isAllowed(conf, update) {
-				logDebug(conf, "callback query not allowed: %s", userNameFromUpdate(update))
-				return
-			}
+	// set message handler
+	bot.SetMessageHandler(func(b *tg.Bot, update tg.Update, message tg.Message, edited bool) {
+		conf := confs.Load()
 
-			handleCallbackQuery(b, db, callbackQuery)
-		})
+		markUpdateReceived(b)
+
+		defer recoverInHandler(b, conf, db, update, "message handler")
+
+		if !isAllowed(conf, update) {
+			logDebugForUpdate(conf, update, "message not allowed: %s", userNameFromUpdate(update))
+
+			replyUnauthorized(b, conf, db, update)
+			return
+		}
+
+		unblockChatOfUpdate(db, update)
+		touchUserOfUpdate(db, update)
 
-		// set command handlers
-		bot.AddCommandHandler(cmdStart, startCommandHandler(conf, db))
-		bot.AddCommandHandler(cmdListReminders, listRemindersCommandHandler(conf, db))
-		bot.AddCommandHandler(cmdStats, statsCommandHandler(conf, db))
-		bot.AddCommandHandler(cmdHelp, helpCommandHandler(conf, db))
-		bot.AddCommandHandler(cmdCancel, cancelCommandHandler(conf, db))
-		bot.AddCommandHandler(cmdPrivacy, privacyCommandHandler(conf, db))
-		bot.SetNoMatchingCommandHandler(noSuchCommandHandler(conf, db))
+		// in group chats, ignore messages which are not for the bot
+		if conf.RemindCommandOnlyInGroups && message.Chat.Type != tg.ChatTypePrivate && !isAwaitedMessage(db, message) {
+			logDebugForUpdate(conf, update, "ignoring message without %s command in group chat", cmdRemind)
+			return
+		}
+
+		handleMessage(ctx, b, conf, db, gtc, update, message)
+	})
+
+	// set callback query handler
+	bot.SetCallbackQueryHandler(func(b *tg.Bot, update tg.Update, callbackQuery tg.CallbackQuery) {
+		conf := confs.Load()
+
+		markUpdateReceived(b)
+
+		defer recoverInHandler(b, conf, db, update, "callback query handler")
+
+		if !isAllowed(conf, update) {
+			logDebugForUpdate(conf, update, "callback query not allowed: %s", userNameFromUpdate(update))
+
+			replyUnauthorized(b, conf, db, update)
+			return
+		}
+
+		touchUserOfUpdate(db, update)
+
+		handleCallbackQuery(b, conf, db, callbackQuery)
+	})
+
+	// set command handlers
+	bot.AddCommandHandler(cmdStart, commandHandler(confs, db, cmdStart, startCommandHandler))
+	bot.AddCommandHandler(cmdListReminders, commandHandler(confs, db, cmdListReminders, listRemindersCommandHandler))
+	bot.AddCommandHandler(cmdHistory, commandHandler(confs, db, cmdHistory, historyCommandHandler))
+	bot.AddCommandHandler(cmdStats, commandHandler(confs, db, cmdStats, statsCommandHandler))
+	bot.AddCommandHandler(cmdHelp, commandHandler(confs, db, cmdHelp, helpCommandHandler))
+	bot.AddCommandHandler(cmdCancel, commandHandler(confs, db, cmdCancel, cancelCommandHandler))
+	bot.AddCommandHandler(cmdCancelAll, commandHandler(confs, db, cmdCancelAll, cancelAllCommandHandler))
+	bot.AddCommandHandler(cmdClone, commandHandler(confs, db, cmdClone, cloneCommandHandler))
+	bot.AddCommandHandler(cmdPrivacy, commandHandler(confs, db, cmdPrivacy, privacyCommandHandler))
+	bot.AddCommandHandler(cmdPause, commandHandler(confs, db, cmdPause, pauseCommandHandler))
+	bot.AddCommandHandler(cmdResume, commandHandler(confs, db, cmdResume, resumeCommandHandler))
+	bot.AddCommandHandler(cmdSnooze, commandHandler(confs, db, cmdSnooze, snoozeCommandHandler))
+	bot.AddCommandHandler(cmdUndated, commandHandler(confs, db, cmdUndated, undatedCommandHandler))
+	bot.AddCommandHandler(cmdMilestones, commandHandler(confs, db, cmdMilestones, milestonesCommandHandler))
+	bot.AddCommandHandler(cmdEscalate, commandHandler(confs, db, cmdEscalate, escalateCommandHandler))
+	bot.AddCommandHandler(cmdActiveHours, commandHandler(confs, db, cmdActiveHours, activeHoursCommandHandler))
+	bot.AddCommandHandler(cmdCron, commandHandler(confs, db, cmdCron, cronCommandHandler))
+	bot.AddCommandHandler(cmdICal, commandHandler(confs, db, cmdICal, icalCommandHandler))
+	bot.AddCommandHandler(cmdTest, commandHandler(confs, db, cmdTest, testCommandHandler))
+	bot.AddCommandHandler(cmdTimezone, commandHandler(confs, db, cmdTimezone, timezoneCommandHandler))
+	bot.AddCommandHandler(cmdClearHistory, commandHandler(confs, db, cmdClearHistory, clearHistoryCommandHandler))
+	bot.AddCommandHandler(cmdEmail, commandHandler(confs, db, cmdEmail, emailCommandHandler))
+	bot.AddCommandHandler(cmdDatetime, commandHandler(confs, db, cmdDatetime, datetimeCommandHandler))
+	bot.AddCommandHandler(cmdPrefix, commandHandler(confs, db, cmdPrefix, prefixCommandHandler))
+	bot.AddCommandHandler(cmdChannels, commandHandler(confs, db, cmdChannels, channelsCommandHandler))
+	bot.AddCommandHandler(cmdWebhook, commandHandler(confs, db, cmdWebhook, webhookCommandHandler))
+	bot.AddCommandHandler(cmdWeekStart, commandHandler(confs, db, cmdWeekStart, weekStartCommandHandler))
+	bot.AddCommandHandler(cmdWhoAmI, commandHandler(confs, db, cmdWhoAmI, whoAmICommandHandler))
+	bot.AddCommandHandler(cmdAlias, commandHandler(confs, db, cmdAlias, aliasCommandHandler))
+	bot.AddCommandHandler(cmdForgetMe, commandHandler(confs, db, cmdForgetMe, forgetMeCommandHandler))
+	bot.AddCommandHandler(cmdSetKey, commandHandler(confs, db, cmdSetKey, setKeyCommandHandler))
+	bot.AddCommandHandler(cmdClearKey, commandHandler(confs, db, cmdClearKey, clearKeyCommandHandler))
+	bot.AddCommandHandler(cmdRemind, commandHandler(confs, db, cmdRemind, func(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+		return remindCommandHandler(ctx, conf, db, gtc)
+	}))
+	bot.AddCommandHandler(cmdPreset, commandHandler(confs, db, cmdPreset, func(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+		return presetCommandHandler(ctx, conf, db, gtc)
+	}))
+	bot.SetNoMatchingCommandHandler(func(b *tg.Bot, update tg.Update, cmd, args string) {
+		conf := confs.Load()
+
+		markUpdateReceived(b)
+
+		defer recoverInHandler(b, conf, db, update, "no matching command handler")
+
+		noSuchCommandHandler(conf, db)(b, update, cmd, args)
+	})
+
+	// register commands for the command menu
+	if err := registerCommands(bot, conf); err != nil {
+		logError(db, "failed to register commands: %s", err)
+	}
+
+	// poll updates (restarted by `watchUpdates` when stopped)
+	for {
+		markUpdateReceived(bot)
 
-		// poll updates
 		bot.StartPollingUpdates(0, intervalSeconds, func(b *tg.Bot, update tg.Update, err error) {
+			conf := confs.Load()
+
+			markUpdateReceived(b)
+
 			if err == nil {
 				if !isAllowed(conf, update) {
-					logDebug(conf, "not allowed: %s", userNameFromUpdate(update))
+					logDebugForUpdate(conf, update, "not allowed: %s", userNameFromUpdate(update))
+
+					replyUnauthorized(b, conf, db, update)
 					return
 				}
 
 				// type not supported
-				if message := messageFromUpdate(update); message != nil {
+				if message := messageFromUpdate(update); message != nil && repliesToUnsupportedType(conf, *message) {
 					send(b, conf, db, msgTypeNotSupported, message.Chat.ID, &message.MessageID)
 				}
 			} else {
 				logError(db, "failed to fetch updates: %s", err)
 			}
 		})
-	} else {
-		logInfo("failed to get bot info: %s", *b.Description)
+
+		logInfo("restarting polling updates...")
 	}
 }
 
-// checks if given update is allowed or not
-func isAllowed(conf config, update tg.Update) bool {
-	var username string
-	if update.HasMessage() && update.Message.From.Username != nil {
-		username = *update.Message.From.Username
-	} else if update.HasEditedMessage() && update.EditedMessage.From.Username != nil {
-		username = *update.EditedMessage.From.Username
-	} else if update.HasCallbackQuery() && update.CallbackQuery.From.Username != nil {
-		username = *update.CallbackQuery.From.Username
-	}
+// botConfig is a struct for configuring an additional bot
+type botConfig struct {
+	TelegramBotToken     string   `json:"telegram_bot_token"`
+	AllowedTelegramUsers []string `json:"allowed_telegram_users"`
+	AdminTelegramUsers   []string `json:"admin_telegram_users,omitempty"`
+	AllowedChatIDs       []int64  `json:"allowed_chat_ids,omitempty"`
+	DBFilepath           string   `json:"db_filepath,omitempty"` // (the main bot's database is shared if not given)
+}
 
-	for _, allowedUser := range conf.AllowedTelegramUsers {
-		if allowedUser == username {
-			return true
+// generate configs of each bot (the main one first, and then additional ones in `bots`) from given config
+func botConfigs(conf config) (confs []config) {
+	mainConf := conf
+	mainConf.Bots = nil
+
+	confs = []config{mainConf}
+	for _, bot := range conf.Bots {
+		token := bot.TelegramBotToken
+
+		botConf := mainConf
+		botConf.TelegramBotToken = &token
+		botConf.AllowedTelegramUsers = bot.AllowedTelegramUsers
+		botConf.AdminTelegramUsers = bot.AdminTelegramUsers
+		botConf.AllowedChatIDs = bot.AllowedChatIDs
+		if bot.DBFilepath != "" {
+			botConf.DBFilepath = bot.DBFilepath
 		}
+		botConf.AdminAPI = nil // (for the main bot only)
+
+		confs = append(confs, botConf)
 	}
 
-	return false
+	return confs
 }
 
-// poll queue items periodically
-func monitorQueue(monitor *time.Ticker, client *tg.Bot, conf config, db *Database) {
-	for range monitor.C {
-		processQueue(client, conf, db)
-	}
+// configHolder holds the current config, which can be swapped atomically on reload
+type configHolder struct {
+	conf atomic.Pointer[config]
 }
 
-// process queue item
-func processQueue(client *tg.Bot, conf config, db *Database) {
-	if queue, err := db.DeliverableQueueItems(conf.MaxNumTries); err == nil {
-		logDebug(conf, "checking queue: %d items...", len(queue))
+// create a new config holder with given config
+func newConfigHolder(conf config) *configHolder {
+	holder := &configHolder{}
+	holder.Store(conf)
 
-		for _, q := range queue {
-			go func(q QueueItem) {
-				message := q.Message
-
-				// send it
-				sent := client.SendMessage(
-					q.ChatID,
-					message,
-					tg.OptionsSendMessage{}.
-						SetReplyMarkup(defaultReplyMarkup()).
-						SetReplyParameters(tg.NewReplyParameters(q.MessageID)))
-
-				if sent.Ok {
-					// mark as delivered
-					if _, err := db.MarkQueueItemAsDelivered(q.ChatID, q.ID); err != nil {
-						logError(db, "failed to mark chat id: %d, queue id: %d (%s)", q.ChatID, q.ID, err)
-					}
-				} else {
-					logError(db, "failed to send reminder: %s", *sent.Description)
-				}
+	return holder
+}
+
+// Load returns the current config
+func (h *configHolder) Load() config {
+	return *h.conf.Load()
+}
+
+// Store swaps the current config with given one
+func (h *configHolder) Store(conf config) {
+	h.conf.Store(&conf)
+}
+
+// reload config from given filepath on SIGHUP
+//
+// NOTE: changes of token, api key, model, database, and bots require restart
+func reloadConfigOnSignal(confFilepath string, confs []*configHolder, db *Database) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		logInfo("reloading config from: %s", confFilepath)
+
+		if reloaded, err := loadConfig(confFilepath); err == nil {
+			warnings, errs := validateConfig(reloaded)
+			for _, warning := range warnings {
+				logInfo("[warning] config: %s", warning)
+			}
+			if len(errs) > 0 {
+				logError(db, "not reloading invalid config: %s", errors.Join(errs...))
+				continue
+			}
+
+			reloadedConfs := botConfigs(reloaded)
+			if len(reloadedConfs) != len(confs) {
+				logInfo("[warning] config: changes of `bots` will be applied after restart")
+			}
 
-				// increase num tries
-				if _, err := db.IncreaseNumTries(q.ChatID, q.ID); err != nil {
-					logError(db, "failed to increase num tries for chat id: %d, queue id: %d (%s)", q.ChatID, q.ID, err)
+			for i, holder := range confs {
+				if i >= len(reloadedConfs) {
+					break
 				}
-			}(q)
+				current, botConf := holder.Load(), reloadedConfs[i]
+
+				// keep the ones which cannot be applied without restart
+				botConf.TelegramBotToken = current.TelegramBotToken
+				botConf.GoogleAIAPIKey = current.GoogleAIAPIKey
+				botConf.GoogleGenerativeModel = current.GoogleGenerativeModel
+				botConf.DBFilepath = current.DBFilepath
+				botConf.Infisical = current.Infisical
+				botConf.LogFormat = current.LogFormat
+				botConf.AdminAPI = current.AdminAPI
+				botConf.EncryptionKey = current.EncryptionKey
+				botConf.EncryptMessages = current.EncryptMessages
+				botConf.HiddenCommands = current.HiddenCommands
+
+				holder.Store(botConf)
+			}
+
+			// rate limiters will be recreated with the new config
+			resetRateLimiters()
+
+			logInfo("config was reloaded")
+		} else {
+			logError(db, "failed to reload config: %s", err)
 		}
-	} else {
-		logError(db, "failed to process queue: %s", err)
 	}
 }
 
-// handle allowed message update from telegram bot api
-func handleMessage(ctx context.Context, bot *tg.Bot, conf config, db *Database, gtc *gt.Client, update tg.Update, message tg.Message) {
-	var msg string
+// checks if given update is allowed or not
+func isAllowed(conf config, update tg.Update) bool {
+	username := telegramUsernameFromUpdate(update)
 
-	chatID := message.Chat.ID
+	for _, allowedUser := range conf.AllowedTelegramUsers {
+		if allowedUser == username {
+			return true
+		}
+	}
 
-	options := tg.OptionsSendMessage{}.
-		SetReplyMarkup(defaultReplyMarkup())
+	// (everyone in the allowed chats)
+	if chatID, exists := chatIDFromUpdate(update); exists && slices.Contains(conf.AllowedChatIDs, chatID) {
+		return true
+	}
 
-	// 'is typing...'
-	bot.SendChatAction(chatID, tg.ChatActionTyping, tg.OptionsSendChatAction{})
+	return false
+}
 
-	if message := messageFromUpdate(update); message != nil {
-		options.SetReplyParameters(tg.NewReplyParameters(message.MessageID))
+// checks if given update is from an admin user
+func isAdmin(conf config, update tg.Update) bool {
+	username := telegramUsernameFromUpdate(update)
 
-		if message.HasText() {
-			txt := *message.Text
-			if parsed, errs := parse(ctx, conf, db, gtc, *message, txt); len(parsed) > 0 {
-				parsed = filterParsed(conf, parsed)
+	for _, adminUser := range conf.AdminTelegramUsers {
+		if adminUser == username {
+			return true
+		}
+	}
 
-				if len(parsed) == 1 {
-					what := parsed[0].Message
-					when := parsed[0].When
+	return false
+}
 
-					if _, err := db.Enqueue(chatID, message.MessageID, what, when); err == nil {
-						msg = fmt.Sprintf(msgResponseFormat,
-							what,
-							datetimeToStr(when),
-						)
-					} else {
-						msg = fmt.Sprintf(msgSaveFailedFormat, what, err)
-					}
-				} else if len(parsed) > 0 {
-					if _, err := db.SaveTemporaryMessage(chatID, message.MessageID, parsed[0].Message); err == nil {
-						msg = fmt.Sprintf(msgSelectWhat, parsed[0].Message)
+// get telegram username (without '@') from given update
+func telegramUsernameFromUpdate(update tg.Update) (username string) {
+	if update.HasMessage() && update.Message.From.Username != nil {
+		username = *update.Message.From.Username
+	} else if update.HasEditedMessage() && update.EditedMessage.From.Username != nil {
+		username = *update.EditedMessage.From.Username
+	} else if update.HasCallbackQuery() && update.CallbackQuery.From.Username != nil {
+		username = *update.CallbackQuery.From.Username
+	}
 
-						// options for inline keyboards
-						options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(
-							datetimeButtonsForCallbackQuery(parsed, chatID, message.MessageID),
-						))
-					} else {
-						msg = msgError
-					}
-				} else {
-					msg = msgNoClue
-				}
-			} else {
-				msg = fmt.Sprintf(msgParseFailedFormat, errors.Join(errs...))
-			}
-		} else {
-			logInfo("no text in usable message from update.")
+	return username
+}
 
-			msg = msgTypeNotSupported
+// poll queue items periodically
+func monitorQueue(monitor *time.Ticker, client *tg.Bot, confs *configHolder, db *Database) {
+	interval := confs.Load().MonitorIntervalSeconds
+
+	var logsPurgedAt time.Time
+	for range monitor.C {
+		conf := confs.Load()
+
+		processQueue(client, conf, db)
+
+		// purge old logs (not that frequently)
+		if time.Since(logsPurgedAt) >= logsPurgeInterval {
+			purgeLogs(conf, db)
+			logsPurgedAt = time.Now()
 		}
-	} else {
-		logInfo("no usable message from update.")
 
-		msg = msgTypeNotSupported
+		// apply reloaded interval
+		if conf.MonitorIntervalSeconds != interval {
+			interval = conf.MonitorIntervalSeconds
+			monitor.Reset(time.Duration(interval) * time.Second)
+		}
 	}
+}
 
-	// fallback message
-	if len(msg) <= 0 {
-		msg = msgError
+// purge logs in the database which are older than `log_retention`
+func purgeLogs(conf config, db *Database) {
+	if conf.LogRetention == "" {
+		return
 	}
 
-	// send message
-	if sent := bot.SendMessage(chatID, msg, options); !sent.Ok {
-		logError(db, "failed to send message: %s", *sent.Description)
+	retention, err := parseDuration(conf.LogRetention)
+	if err != nil {
+		logError(db, "invalid log retention: %s", err)
+		return
+	}
+
+	if count, err := db.PurgeLogs(time.Now().Add(-retention)); err == nil {
+		if count > 0 {
+			logInfo("purged %d log(s) older than %s", count, conf.LogRetention)
+		}
+	} else {
+		logError(db, "failed to purge logs: %s", err)
 	}
 }
 
-// handle allowed callback query from telegram bot api
-func handleCallbackQuery(b *tg.Bot, db *Database, query tg.CallbackQuery) {
-	data := *query.Data
+// times of the latest successful runs of `processQueue` of each bot (in unix seconds)
+var _queueProcessedAt sync.Map // *tg.Bot => int64
 
-	msg := msgError
+// mark that the queue of given bot was processed successfully just now
+func markQueueProcessed(client *tg.Bot) {
+	_queueProcessedAt.Store(client, time.Now().Unix())
+}
 
-	if strings.HasPrefix(data, cmdCancel) {
-		if data == cmdCancel {
-			msg = msgCommandCanceled
-		} else {
-			cancelParam := strings.TrimSpace(strings.Replace(data, cmdCancel, "", 1))
-			if queueID, err := strconv.Atoi(cancelParam); err == nil {
-				if item, err := db.GetQueueItem(query.Message.Chat.ID, int64(queueID)); err == nil {
-					if _, err := db.DeleteQueueItem(query.Message.Chat.ID, int64(queueID)); err == nil {
-						msg = fmt.Sprintf(msgReminderCanceledFormat, item.Message)
-					} else {
-						logError(db, "failed to delete reminder: %s", err)
-					}
-				} else {
-					logError(db, "failed to get reminder: %s", err)
-				}
-			} else {
-				logError(db, "unprocessable callback query: %s", data)
-			}
-		}
-	} else if strings.HasPrefix(data, cmdLoad) {
-		params := strings.Split(strings.TrimSpace(strings.Replace(data, cmdLoad, "", 1)), "/")
+// check periodically if the queue of given bot was processed recently, and alert if it was not
+func watchQueue(watchdog *time.Ticker, client *tg.Bot, confs *configHolder, db *Database) {
+	markQueueProcessed(client)
 
-		if len(params) >= 3 {
-			if chatID, err := strconv.ParseInt(params[0], 10, 64); err == nil {
-				if messageID, err := strconv.ParseInt(params[1], 10, 64); err == nil {
-					if saved, err := db.LoadTemporaryMessage(chatID, messageID); err == nil {
-						if when, err := time.ParseInLocation(datetimeFormat, params[2], _location); err == nil {
-							if _, err := db.Enqueue(chatID, messageID, saved.Message, when); err == nil {
-								msg = fmt.Sprintf(msgResponseFormat,
-									saved.Message,
-									datetimeToStr(when),
-								)
-
-								// delete temporary message
-								if _, err := db.DeleteTemporaryMessage(chatID, messageID); err != nil {
-									logError(db, "failed to delete temporary message: %s", err)
-								}
-							} else {
-								msg = fmt.Sprintf(msgSaveFailedFormat, saved.Message, err)
-							}
-						} else {
-							logError(db, "failed to parse time: %s", err)
-						}
-					} else {
-						logError(db, "failed to load temporary message with chat id: %d, message id: %d", chatID, messageID)
-					}
-				} else {
-					logError(db, "failed to convert message id: %s", err)
+	alerted := false
+	for range watchdog.C {
+		conf := confs.Load()
+		threshold := time.Duration(conf.QueueStallThresholdSeconds) * time.Second
+
+		processedAt, _ := _queueProcessedAt.Load(client)
+		at, _ := processedAt.(int64)
+		elapsed := time.Since(time.Unix(at, 0))
+
+		if elapsed > threshold {
+			if !alerted {
+				logError(db, "queue was not processed for %s", elapsed.Truncate(time.Second))
+
+				if conf.AlertChatID != 0 {
+					send(client, conf, db, fmt.Sprintf(msgQueueStalledFormat, elapsed.Truncate(time.Second)), conf.AlertChatID, nil)
 				}
-			} else {
-				logError(db, "failed to convert chat id: %s", err)
+
+				alerted = true
 			}
 		} else {
-			logError(db, "malformed inline keyboard data: %s", data)
+			if alerted {
+				logInfo("queue is being processed again")
+			}
+
+			alerted = false
 		}
-	} else {
-		logError(db, "unprocessable callback query: %s", data)
 	}
+}
 
-	// answer callback query
-	if apiResult := b.AnswerCallbackQuery(
-		query.ID,
-		tg.OptionsAnswerCallbackQuery{}.
-			SetText(msg),
-	); apiResult.Ok {
-		// edit message and remove inline keyboards
-		options := tg.OptionsEditMessageText{}.
-			SetIDs(query.Message.Chat.ID, query.Message.MessageID)
-		if apiResult := b.EditMessageText(msg, options); !apiResult.Ok {
-			logError(db, "failed to edit message text: %s", *apiResult.Description)
+// times of the latest updates (or errors) received by each bot (in unix seconds)
+var _updatesReceivedAt sync.Map // *tg.Bot => int64
+
+// mark that given bot received an update (or an error) just now
+func markUpdateReceived(client *tg.Bot) {
+	_updatesReceivedAt.Store(client, time.Now().Unix())
+}
+
+// check periodically if given bot received updates recently, and restart its polling if it did not
+//
+// (long polling can get stuck without any error after running for days)
+func watchUpdates(watchdog *time.Ticker, client *tg.Bot, confs *configHolder) {
+	for range watchdog.C {
+		conf := confs.Load()
+		if conf.PollingIdleRestartSeconds <= 0 {
+			continue
+		}
+		threshold := time.Duration(conf.PollingIdleRestartSeconds) * time.Second
+
+		receivedAt, _ := _updatesReceivedAt.Load(client)
+		if at, ok := receivedAt.(int64); ok {
+			if elapsed := time.Since(time.Unix(at, 0)); elapsed > threshold {
+				logInfo("no updates were received for %s, restarting polling updates...", elapsed.Truncate(time.Second))
+
+				// (not to restart again until the polling is restarted)
+				markUpdateReceived(client)
+
+				client.StopPollingUpdates()
+			}
 		}
-	} else {
-		logError(db, "failed to answer callback query: %s", prettify(query))
 	}
 }
 
-// get usable message from given update
-func messageFromUpdate(update tg.Update) (message *tg.Message) {
-	if update.HasMessage() && update.Message.HasText() {
-		message = update.Message
-	} else if update.HasMessage() && update.Message.HasDocument() {
-		message = update.Message
-	} else if update.HasEditedMessage() && update.EditedMessage.HasText() {
-		message = update.EditedMessage
-	}
+// build a command handler which uses the current config, and recovers from panics
+func commandHandler(confs *configHolder, db *Database, cmd string, newHandler func(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string)) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		conf := confs.Load()
 
-	if message == nil {
-		logInfo("no usable message from update.")
-	}
+		markUpdateReceived(b)
 
-	return message
+		defer recoverInHandler(b, conf, db, update, fmt.Sprintf("%s command handler", cmd))
+
+		unblockChatOfUpdate(db, update)
+
+		if isAllowed(conf, update) {
+			touchUserOfUpdate(db, update)
+		} else if !slices.Contains([]string{cmdStart, cmdWhoAmI, cmdPrivacy}, cmd) { // (/start, /whoami, and /privacy handle not-allowed users by themselves)
+			replyUnauthorized(b, conf, db, update)
+		}
+
+		newHandler(conf, db)(b, update, args)
+	}
 }
 
-// send given message to the chat
-func send(bot *tg.Bot, conf config, db *Database, message string, chatID int64, messageID *int64) {
-	_ = bot.SendChatAction(chatID, tg.ChatActionTyping, nil)
+// save the last interaction time of given update's user
+func touchUserOfUpdate(db *Database, update tg.Update) {
+	if db == nil {
+		return
+	}
 
-	logDebug(conf, "[verbose] sending message to chat(%d): '%s'", chatID, message)
+	if user := update.GetFrom(); user != nil {
+		username := ""
+		if user.Username != nil {
+			username = *user.Username
+		}
 
-	options := tg.OptionsSendMessage{}.
-		SetReplyMarkup(defaultReplyMarkup()).
-		SetParseMode(tg.ParseModeHTML)
-	if messageID != nil {
-		options.SetReplyParameters(tg.NewReplyParameters(*messageID))
+		if _, err := db.TouchUserActivity(user.ID, username, user.FirstName, time.Now()); err != nil {
+			logError(db, "failed to save activity of user id: %d (%s)", user.ID, err)
+		}
 	}
-	if res := bot.SendMessage(chatID, message, options); !res.Ok {
-		logError(db, "failed to send message: %s", *res.Description)
+}
+
+// reset the blocked state of given update's chat (if it was blocked), so that its reminders will be delivered again
+func unblockChatOfUpdate(db *Database, update tg.Update) {
+	if db == nil {
+		return
+	}
+
+	if chatID, exists := chatIDFromUpdate(update); exists {
+		if unblocked, err := db.UnblockChat(chatID); err == nil {
+			if unblocked {
+				logInfo("chat id: %d was unblocked", chatID)
+			}
+		} else {
+			logError(db, "failed to unblock chat id: %d (%s)", chatID, err)
+		}
 	}
 }
 
-// type for parsed items
-type parsedItem struct {
-	Message   string
-	When      time.Time
-	Generated bool // if this item was generated by the bot (due to vague request)
+// recover from a panic (if any) in handlers, log it with the stack trace, and reply with an error message
+func recoverInHandler(b *tg.Bot, conf config, db *Database, update tg.Update, where string) {
+	if r := recover(); r != nil {
+		logErrorForUpdate(db, update, "recovered from panic in %s: %v\n%s", where, r, debug.Stack())
+
+		if chatID, exists := chatIDFromUpdate(update); exists {
+			send(b, conf, db, msgError, chatID, nil)
+		}
+	}
 }
 
-// function declarations for genai model
-func fnDeclarations(conf config) []*genai.FunctionDeclaration {
-	return []*genai.FunctionDeclaration{
-		{
-			Name:        fnNameInferDatetime,
-			Description: fnDescriptionInferDatetime,
-			Parameters: &genai.Schema{
-				Type: genai.TypeObject,
-				Properties: map[string]*genai.Schema{
-					fnArgNameInferredDatetime: {
-						Type:        genai.TypeString,
-						Description: fmt.Sprintf(fnArgDescriptionInferredDatetime, conf.DefaultHour),
-						Nullable:    false,
-					},
-					fnArgNameMessageToSend: {
-						Type:        genai.TypeString,
-						Description: fnArgDescriptionMessageToSend,
-						Nullable:    false,
-					},
-				},
-				Nullable: false,
-			},
-		},
+// recover from a panic (if any) and log it with the stack trace
+func recoverAndLog(db *Database, where string) {
+	if r := recover(); r != nil {
+		logError(db, "recovered from panic in %s: %v\n%s", where, r, debug.Stack())
 	}
 }
 
-// handle function call
-func handleFnCall(conf config, fn genai.FunctionCall) (result []parsedItem, err error) {
-	logDebug(conf, "[verbose] handling function call: %s", prettify(fn))
+// handle reminders which were due while the bot was down, with configured behavior
+func reconcileMissedReminders(client *tg.Bot, conf config, db *Database, launchedAt time.Time) {
+	if conf.MissedReminders == missedRemindersFlood {
+		return // will be delivered at once by `processQueue`
+	}
 
-	result = []parsedItem{}
+	if missed, err := db.MissedQueueItems(conf.MaxNumTries, launchedAt); err == nil {
+		if len(missed) <= 0 {
+			return
+		}
 
-	if fn.Name == fnNameInferDatetime {
-		datetime := val[string](fn.Args, fnArgNameInferredDatetime)
-		message := val[string](fn.Args, fnArgNameMessageToSend)
+		logInfo("handling %d missed reminder(s) with behavior: %s", len(missed), conf.MissedReminders)
 
-		if message != "" && datetime != "" {
-			if t, e := time.ParseInLocation(datetimeFormat, datetime, _location); e == nil {
-				result = append(result, parsedItem{
-					Message:   message,
-					When:      t,
-					Generated: false,
-				})
-			} else {
-				err = fmt.Errorf("failed to parse '%s' (%s) in function call: %s", fnArgNameInferredDatetime, e, prettify(fn.Args))
+		switch conf.MissedReminders {
+		case missedRemindersTrickle:
+			// (in the background, not to delay the delivery of the others)
+			_tricklingBefore.Store(db, launchedAt)
+
+			go trickleMissedReminders(client, conf, db, missed)
+		case missedRemindersSkip:
+			for _, q := range missed {
+				enqueueNextRecurrence(db, q)
+
+				if _, err := db.DeleteQueueItem(q.ChatID, q.ID); err != nil {
+					logError(db, "failed to skip missed reminder with chat id: %d, queue id: %d (%s)", q.ChatID, q.ID, err)
+				}
 			}
-		} else {
-			err = fmt.Errorf("invalid `%s` and/or `%s` in function call: %s", fnArgNameInferredDatetime, fnArgNameMessageToSend, prettify(fn.Args))
 		}
 	} else {
-		err = fmt.Errorf("no function declaration for name: %s", fn.Name)
+		logError(db, "failed to fetch missed reminders: %s", err)
 	}
-
-	if err != nil {
-		logDebug(conf, "[verbose] there was an error with returned function call: %s", err)
-	}
-
-	return result, err
 }
 
-// get value for given `key` from `m`, return the zero value if it has no such key
-func val[T any](m map[string]any, key string) T {
-	var r T
+var _tricklingBefore sync.Map // *Database => time.Time
 
-	if v, exists := m[key]; exists {
-		if v, ok := v.(T); ok {
-			r = v
+// deliver given missed reminders one by one, with intervals
+func trickleMissedReminders(client *tg.Bot, conf config, db *Database, missed []QueueItem) {
+	defer _tricklingBefore.Delete(db)
+	defer recoverAndLog(db, "trickleMissedReminders")
+
+	for i, q := range missed {
+		if i > 0 {
+			time.Sleep(time.Duration(conf.MissedRemindersIntervalSeconds) * time.Second)
 		}
-	}
 
-	return r
+		deliver(client, conf, db, q, fmt.Sprintf(msgMissedFormat, messageForDelivery(conf, db, q)))
+
+		markQueueProcessed(client)
+	}
 }
 
-// prettify given value in indented JSON format (for debugging purporse)
-func prettify(v any) string {
-	if bytes, err := json.MarshalIndent(v, "", "  "); err == nil {
-		return string(bytes)
+// check if given queue item is one of the missed reminders which are being trickled
+func isTrickling(db *Database, q QueueItem) bool {
+	if before, ok := _tricklingBefore.Load(db); ok {
+		return q.FireOn.Before(before.(time.Time))
 	}
 
-	return fmt.Sprintf("%+v", v)
+	return false
 }
 
-// parse given string, generate items from the parsed ones, and return them
-func parse(ctx context.Context, conf config, db *Database, gtc *gt.Client, message tg.Message, text string) (result []parsedItem, errs []error) {
-	result = []parsedItem{}
-	errs = []error{}
+// process queue item
+func processQueue(client *tg.Bot, conf config, db *Database) {
+	defer recoverAndLog(db, "processQueue")
 
-	chatID := message.Chat.ID
-	userID := message.From.ID
-	username := userName(message.From)
+	if queue, err := db.DeliverableQueueItems(conf.MaxNumTries); err == nil {
+		logDebug(conf, "checking queue: %d items...", len(queue))
 
-	// options for generation
-	opts := &gt.GenerationOptions{
-		// set function declarations
-		Tools: []*genai.Tool{
-			{
-				FunctionDeclarations: fnDeclarations(conf),
-			},
-		},
-		// function call config
-		ToolConfig: &genai.ToolConfig{
-			// https://cloud.google.com/vertex-ai/generative-ai/docs/model-reference/function-calling
-			FunctionCallingConfig: &genai.FunctionCallingConfig{
-				Mode: genai.FunctionCallingAny,
-				AllowedFunctionNames: []string{
+		markQueueProcessed(client)
+
+		for _, q := range queue {
+			// (missed ones are delivered by `trickleMissedReminders`)
+			if isTrickling(db, q) {
+				continue
+			}
+
+			// (re-notifications out of the active hours of the chat are postponed)
+			if postponed, ok := postponedEscalation(db, q, time.Now()); ok {
+				if _, err := db.ScheduleQueueItem(q.ChatID, q.ID, postponed); err != nil {
+					logError(db, "failed to postpone the re-notification of chat id: %d, queue id: %d (%s)", q.ChatID, q.ID, err)
+				}
+				continue
+			}
+
+			go deliver(client, conf, db, q, messageForDelivery(conf, db, q))
+		}
+	} else {
+		logError(db, "failed to process queue: %s", err)
+	}
+
+	// give up the ones which reached the maximum number of tries
+	if exhausted, err := db.ExhaustedQueueItems(conf.MaxNumTries); err == nil {
+		for _, q := range exhausted {
+			giveUpDelivery(client, conf, db, q)
+		}
+	} else {
+		logError(db, "failed to fetch exhausted queue items: %s", err)
+	}
+
+	// deliver to extra channels
+	if deliveries, err := db.PendingChannelDeliveries(conf.MaxNumTries); err == nil {
+		for _, d := range deliveries {
+			go deliverToChannel(conf, db, d)
+		}
+	} else {
+		logError(db, "failed to fetch pending channel deliveries: %s", err)
+	}
+}
+
+// enqueue deliveries of given (delivered) queue item to the extra channels of its chat
+func enqueueChannelDeliveries(db *Database, q QueueItem) {
+	setting, err := db.GetChatSetting(q.ChatID)
+	if err != nil {
+		logError(db, "failed to get chat setting: %s", err)
+		return
+	}
+
+	if channels := channelsOf(setting); len(channels) > 0 {
+		if err := db.EnqueueChannelDeliveries(q.ChatID, q.ID, channels); err != nil {
+			logError(db, "failed to enqueue channel deliveries of chat id: %d, queue id: %d (%s)", q.ChatID, q.ID, err)
+		}
+	}
+}
+
+// deliver given channel delivery, and mark the result
+func deliverToChannel(conf config, db *Database, d ChannelDelivery) {
+	defer recoverAndLog(db, fmt.Sprintf("delivering channel delivery %d", d.ID))
+
+	// not retried if the reminder, the chat setting, or the channel is not available anymore
+	giveUp := func(reason string) {
+		logError(db, "giving up delivering chat id: %d, queue id: %d to channel: %s (%s)", d.ChatID, d.QueueItemID, d.Channel, reason)
+
+		if _, err := db.MarkChannelDeliveryAsFailed(d.ID, reason); err != nil {
+			logError(db, "failed to mark channel delivery: %d as failed (%s)", d.ID, err)
+		}
+	}
+
+	q, err := db.GetQueueItem(d.ChatID, d.QueueItemID)
+	if err != nil {
+		giveUp(fmt.Sprintf("failed to get reminder: %s", err))
+		return
+	}
+	setting, err := db.GetChatSetting(d.ChatID)
+	if err != nil {
+		giveUp(fmt.Sprintf("failed to get chat setting: %s", err))
+		return
+	}
+	channel, exists := _notificationChannels[d.Channel]
+	if !exists {
+		giveUp("no such channel")
+		return
+	}
+	if err := channel.check(conf, setting); err != nil {
+		giveUp(err.Error())
+		return
+	}
+
+	if err := channel.deliver(conf, setting, q); err == nil {
+		logInfo("sent chat id: %d, queue id: %d to channel: %s", d.ChatID, d.QueueItemID, d.Channel)
+
+		if _, err := db.MarkChannelDeliveryAsDelivered(d.ID); err != nil {
+			logError(db, "failed to mark channel delivery: %d as delivered (%s)", d.ID, err)
+		}
+	} else {
+		logError(db, "failed to send chat id: %d, queue id: %d to channel: %s (%s)", d.ChatID, d.QueueItemID, d.Channel, err)
+
+		if _, err := db.IncreaseChannelDeliveryNumTries(d.ID, err.Error()); err != nil {
+			logError(db, "failed to increase num tries for channel delivery: %d (%s)", d.ID, err)
+		}
+	}
+}
+
+// mark given queue item as failed after too many tries, and notify the user (or the admin, if the chat is not reachable)
+func giveUpDelivery(client *tg.Bot, conf config, db *Database, q QueueItem) {
+	logError(db, "giving up delivering chat id: %d, queue id: %d after %d tries", q.ChatID, q.ID, q.NumTries)
+
+	if err := failOccurrence(db, q, fmt.Sprintf("failed after %d tries", q.NumTries)); err != nil {
+		logError(db, "failed to mark chat id: %d, queue id: %d as failed (%s)", q.ChatID, q.ID, err)
+		return
+	}
+
+	msg := fmt.Sprintf(msgDeliveryExhaustedFormat, q.NumTries, q.Message)
+
+	options := tg.OptionsSendMessage{}.
+		SetReplyMarkup(defaultReplyMarkup())
+	if q.MessageThreadID != 0 {
+		options.SetMessageThreadID(q.MessageThreadID)
+	}
+	if sent := client.SendMessage(q.ChatID, msg, options); !sent.Ok {
+		logError(db, "failed to notify failed delivery to chat id: %d (%s)", q.ChatID, *sent.Description)
+
+		if conf.AlertChatID != 0 {
+			send(client, conf, db, fmt.Sprintf(msgDeliveryExhaustedAlertFormat, q.ChatID, q.NumTries, escapeHTML(q.Message)), conf.AlertChatID, nil)
+		}
+	}
+}
+
+// mark given queue item as failed with given reason, and enqueue its next occurrence (if it is a recurring one),
+// so that a failed occurrence does not end the whole recurrence
+func failOccurrence(db *Database, q QueueItem, reason string) error {
+	if _, err := db.MarkQueueItemAsFailed(q.ChatID, q.ID, reason); err != nil {
+		return err
+	}
+
+	enqueueNextRecurrence(db, q)
+
+	return nil
+}
+
+// get the next occurrence of given queue item (if it is a recurring one), and whether its recurrence has ended
+func nextRecurrence(db *Database, q QueueItem) (next time.Time, ended bool, err error) {
+	if q.Recurrence == "" {
+		return next, true, nil
+	}
+
+	// (not to flood with the missed ones)
+	after := q.FireOn
+	if now := time.Now(); after.Before(now) {
+		after = now
+	}
+
+	// (occurrences are of the events, which are notified earlier by the lead offset)
+	lead := time.Duration(q.LeadOffsetSeconds) * time.Second
+	loc := chatLocation(db, q.ChatID)
+
+	// within the window of the day (eg. "every hour between 9 and 5"), or the start of the next window with the cron expression
+	if next, ok := nextInWindow(q.FireOn.Add(lead).In(loc), after.Add(lead).In(loc), q.IntervalMinutes, q.WindowEndMinutes); ok {
+		return next.Add(-lead), q.UntilOn != nil && next.After(*q.UntilOn), nil
+	}
+
+	if next, err = nextCronTime(q.Recurrence, after.Add(lead).In(loc)); err != nil {
+		return next, false, err
+	}
+
+	return next.Add(-lead), q.UntilOn != nil && next.After(*q.UntilOn), nil
+}
+
+// enqueue the next occurrence of given queue item (if it is a recurring one, and not ended yet)
+func enqueueNextRecurrence(db *Database, q QueueItem) {
+	if q.Recurrence == "" {
+		return
+	}
+
+	if next, ended, err := nextRecurrence(db, q); err == nil {
+		if ended {
+			logInfo("recurrence of chat id: %d, queue id: %d has ended", q.ChatID, q.ID)
+			return
+		}
+
+		if _, err := db.EnqueueItem(QueueItem{
+			ChatID:            q.ChatID,
+			MessageID:         q.MessageID,
+			MessageThreadID:   q.MessageThreadID,
+			Message:           q.Message,
+			FireOn:            next,
+			ModelName:         q.ModelName,
+			Recurrence:        q.Recurrence,
+			UntilOn:           q.UntilOn,
+			Silent:            q.Silent,
+			IntervalMinutes:   q.IntervalMinutes,
+			WindowEndMinutes:  q.WindowEndMinutes,
+			Source:            sourceRecurrence,
+			CreatedBy:         q.CreatedBy,
+			LeadOffsetSeconds: q.LeadOffsetSeconds,
+			EscalateMinutes:   q.EscalateMinutes,
+		}); err != nil {
+			logError(db, "failed to enqueue the next recurrence of chat id: %d, queue id: %d (%s)", q.ChatID, q.ID, err)
+		}
+	} else {
+		logError(db, "failed to get the next recurrence of chat id: %d, queue id: %d (%s)", q.ChatID, q.ID, err)
+	}
+}
+
+// generate the message for delivering given queue item
+func messageForDelivery(conf config, db *Database, q QueueItem) string {
+	message := q.Message
+	if conf.StripTags {
+		message = stripTags(message)
+	}
+	if q.MilestoneOf != 0 {
+		message = fmt.Sprintf(msgMilestoneFormat, durationToStr(time.Duration(q.MilestoneOffsetSeconds)*time.Second), message)
+	}
+	if q.EscalationOf != 0 {
+		message = fmt.Sprintf(msgEscalationFormat, message)
+	}
+
+	if prefix := reminderPrefix(conf, db, q.ChatID); prefix != "" {
+		message = prefix + " " + message
+	}
+
+	return message
+}
+
+// get the prefix of delivered reminders of given chat (or the default one)
+func reminderPrefix(conf config, db *Database, chatID int64) string {
+	if setting, err := db.GetChatSetting(chatID); err == nil && setting.ReminderPrefix != nil {
+		return *setting.ReminderPrefix
+	}
+
+	return conf.ReminderPrefix
+}
+
+// deliver given queue item with `message`
+func deliver(client *tg.Bot, conf config, db *Database, q QueueItem, message string) {
+	defer recoverAndLog(db, fmt.Sprintf("delivering queue item %d", q.ID))
+
+	options := tg.OptionsSendMessage{}.
+		SetReplyMarkup(defaultReplyMarkup())
+	if q.MessageID != 0 { // (not for the ones without original messages, eg. created with the admin API)
+		options.SetReplyParameters(tg.NewReplyParameters(q.MessageID))
+	}
+	if q.Silent {
+		options.SetDisableNotification(true)
+	}
+	if q.MessageThreadID != 0 { // (for topics in forum groups)
+		options.SetMessageThreadID(q.MessageThreadID)
+	}
+
+	// mark the last one of a recurring reminder
+	if q.Recurrence != "" && q.UntilOn != nil {
+		if _, ended, err := nextRecurrence(db, q); err == nil && ended {
+			message += msgRecurrenceEnded
+		}
+	}
+
+	// snooze and feedback buttons (not for milestones)
+	if q.MilestoneOf == 0 {
+		options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(deliveredButtonsForCallbackQuery(db, q)))
+	}
+
+	// send it
+	sent := sendMessageWithRetries(client, conf, q.ChatID, message, options)
+
+	if sent.Ok {
+		// mark as delivered
+		if _, err := db.MarkQueueItemAsDelivered(q.ChatID, q.ID, sent.Result.MessageID); err != nil {
+			logError(db, "failed to mark chat id: %d, queue id: %d (%s)", q.ChatID, q.ID, err)
+		}
+
+		// deliver it to the extra channels of the chat too (retried independently)
+		enqueueChannelDeliveries(db, q)
+
+		// enqueue the next one (if recurring)
+		enqueueNextRecurrence(db, q)
+
+		// and the next re-notification (if escalated)
+		enqueueEscalation(db, q)
+	} else {
+		logError(db, "failed to send reminder: %s", *sent.Description)
+
+		// the chat is not reachable anymore, so don't retry
+		if isChatUnreachable(sent.Description) {
+			deliverByEmail(conf, db, q)
+
+			// (other reminders of the chat will be deferred until the next message from it)
+			if _, err := db.UpdateChatSetting(q.ChatID, "blocked", true); err == nil {
+				logInfo("chat id: %d was marked as blocked", q.ChatID)
+			} else {
+				logError(db, "failed to mark chat id: %d as blocked (%s)", q.ChatID, err)
+			}
+
+			if conf.FailAllRemindersOfUnreachableChat {
+				if _, err := db.MarkUndeliveredQueueItemsAsFailed(q.ChatID, *sent.Description); err != nil {
+					logError(db, "failed to mark reminders of unreachable chat id: %d as failed (%s)", q.ChatID, err)
+				}
+			} else {
+				// (next occurrences will be deferred until the chat is unblocked)
+				if err := failOccurrence(db, q, *sent.Description); err != nil {
+					logError(db, "failed to mark chat id: %d, queue id: %d as failed (%s)", q.ChatID, q.ID, err)
+				}
+			}
+
+			return
+		}
+	}
+
+	// increase num tries
+	if _, err := db.IncreaseNumTries(q.ChatID, q.ID); err != nil {
+		logError(db, "failed to increase num tries for chat id: %d, queue id: %d (%s)", q.ChatID, q.ID, err)
+	}
+
+	// send it by email too, if it is about to be given up
+	if !sent.Ok && q.NumTries+1 >= conf.MaxNumTries-1 {
+		deliverByEmail(conf, db, q)
+	}
+}
+
+// send given queue item to the chat's email address (if configured), when it cannot be delivered on telegram
+func deliverByEmail(conf config, db *Database, q QueueItem) {
+	if conf.SMTP == nil || q.EmailedOn != nil {
+		return
+	}
+
+	setting, err := db.GetChatSetting(q.ChatID)
+	if err != nil || setting.Email == "" {
+		return
+	}
+
+	if err := sendEmail(*conf.SMTP, setting.Email, fmt.Sprintf(msgEmailSubjectFormat, firstLine(q.Message, listItemMessageLength)), fmt.Sprintf(msgEmailBodyFormat, q.Message)); err == nil {
+		logInfo("sent chat id: %d, queue id: %d by email", q.ChatID, q.ID)
+
+		if _, err := db.MarkQueueItemAsEmailed(q.ChatID, q.ID); err != nil {
+			logError(db, "failed to mark chat id: %d, queue id: %d as emailed (%s)", q.ChatID, q.ID, err)
+		}
+	} else {
+		logError(db, "failed to send chat id: %d, queue id: %d by email (%s)", q.ChatID, q.ID, err)
+	}
+}
+
+// check if given chat has reached the maximum number of active reminders (admins are not limited)
+func reachedActiveRemindersLimit(conf config, db *Database, update tg.Update, chatID int64) bool {
+	if conf.MaxActiveRemindersPerChat <= 0 || isAdmin(conf, update) {
+		return false
+	}
+
+	if items, err := db.UndeliveredQueueItems(chatID); err == nil {
+		return len(items) >= conf.MaxActiveRemindersPerChat
+	} else {
+		logError(db, "failed to count active reminders: %s", err)
+	}
+
+	return false
+}
+
+// rate limiters for each user
+var _rateLimiters = map[int64]*rate.Limiter{}
+var _rateLimitersLock sync.Mutex
+
+// reset all rate limiters
+func resetRateLimiters() {
+	_rateLimitersLock.Lock()
+	defer _rateLimitersLock.Unlock()
+
+	_rateLimiters = map[int64]*rate.Limiter{}
+}
+
+// checks if a message from given user is allowed by the rate limit
+func allowRate(conf config, userID int64) bool {
+	if conf.RateLimitPerMinute <= 0 {
+		return true
+	}
+
+	_rateLimitersLock.Lock()
+	defer _rateLimitersLock.Unlock()
+
+	limiter, exists := _rateLimiters[userID]
+	if !exists {
+		limiter = rate.NewLimiter(rate.Limit(float64(conf.RateLimitPerMinute)/60.0), conf.RateLimitBurst)
+		_rateLimiters[userID] = limiter
+	}
+
+	return limiter.Allow()
+}
+
+// rate limiters of /whoami for each user
+var _whoAmIRateLimiters = map[int64]*rate.Limiter{}
+var _whoAmIRateLimitersLock sync.Mutex
+
+// checks if a /whoami command from given user is allowed by its rate limit
+func allowWhoAmIRate(userID int64) bool {
+	_whoAmIRateLimitersLock.Lock()
+	defer _whoAmIRateLimitersLock.Unlock()
+
+	limiter, exists := _whoAmIRateLimiters[userID]
+	if !exists {
+		limiter = rate.NewLimiter(rate.Limit(float64(whoAmIRatePerMinute)/60.0), whoAmIRateBurst)
+		_whoAmIRateLimiters[userID] = limiter
+	}
+
+	return limiter.Allow()
+}
+
+// rate limiters of replies to not-allowed users
+var _unauthorizedRateLimiters = map[int64]*rate.Limiter{}
+var _unauthorizedRateLimitersLock sync.Mutex
+
+// checks if a reply to given not-allowed user is allowed by its rate limit
+func allowUnauthorizedReplyRate(userID int64) bool {
+	_unauthorizedRateLimitersLock.Lock()
+	defer _unauthorizedRateLimitersLock.Unlock()
+
+	limiter, exists := _unauthorizedRateLimiters[userID]
+	if !exists {
+		limiter = rate.NewLimiter(rate.Every(unauthorizedReplyInterval), 1)
+		_unauthorizedRateLimiters[userID] = limiter
+	}
+
+	return limiter.Allow()
+}
+
+// reply to a not-allowed user with `unauthorized_reply` (if set)
+//
+// (only in private chats, for not bothering others in group chats; callback queries are answered with a toast)
+func replyUnauthorized(b *tg.Bot, conf config, db *Database, update tg.Update) {
+	if conf.UnauthorizedReply == "" {
+		return
+	}
+
+	if update.CallbackQuery != nil {
+		if allowUnauthorizedReplyRate(update.CallbackQuery.From.ID) {
+			_ = b.AnswerCallbackQuery(update.CallbackQuery.ID, tg.OptionsAnswerCallbackQuery{}.SetText(conf.UnauthorizedReply))
+		}
+	} else if message := messageFromUpdate(update); message != nil && message.From != nil && message.Chat.Type == tg.ChatTypePrivate {
+		if allowUnauthorizedReplyRate(message.From.ID) {
+			send(b, conf, db, conf.UnauthorizedReply, message.Chat.ID, nil)
+		}
+	}
+}
+
+// checks if given error description of telegram bot api means that the chat is not reachable anymore
+// (eg. bot was blocked by the user, chat was deleted, ...)
+func isChatUnreachable(description *string) bool {
+	if description == nil {
+		return false
+	}
+
+	desc := strings.ToLower(*description)
+	for _, reason := range []string{
+		"bot was blocked by the user",
+		"bot was kicked",
+		"chat not found",
+		"user is deactivated",
+	} {
+		if strings.Contains(desc, reason) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// send a message, and retry (up to `send_max_retries` times) if it fails with a transient error
+func sendMessageWithRetries(bot *tg.Bot, conf config, chatID int64, message string, options tg.OptionsSendMessage) (res tg.APIResponse[tg.Message]) {
+	res = bot.SendMessage(chatID, message, options)
+	for retries := 1; !res.Ok && retries <= conf.SendMaxRetries; retries++ {
+		if !isTransientSendFailure(res) {
+			break
+		}
+
+		backoff := sendRetryBackoff * time.Duration(1<<(retries-1))
+		if res.Parameters != nil && res.Parameters.RetryAfter != nil {
+			backoff = time.Duration(*res.Parameters.RetryAfter) * time.Second
+			if backoff > sendMaxRetryAfter {
+				break
+			}
+		}
+		logInfo("retrying sending message to chat(%d) (%d/%d) in %s after a transient error: %s", chatID, retries, conf.SendMaxRetries, backoff, *res.Description)
+
+		time.Sleep(backoff)
+
+		res = bot.SendMessage(chatID, message, options)
+	}
+
+	return res
+}
+
+// check if given failed response of telegram is transient (eg. network errors, 5xx errors, or too many requests), so it is worth retrying
+func isTransientSendFailure(res tg.APIResponse[tg.Message]) bool {
+	if res.Description == nil || isChatUnreachable(res.Description) {
+		return false
+	}
+	if res.Parameters != nil && res.Parameters.RetryAfter != nil {
+		return true
+	}
+
+	desc := strings.ToLower(*res.Description)
+	for _, reason := range []string{
+		"failed with error", // (network errors)
+		"failed to parse json",
+		"too many requests",
+		"internal server error",
+		"bad gateway",
+		"service unavailable",
+		"gateway timeout",
+	} {
+		if strings.Contains(desc, reason) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handle allowed message update from telegram bot api
+func handleMessage(ctx context.Context, bot *tg.Bot, conf config, db *Database, gtc *gt.Client, update tg.Update, message tg.Message) {
+	var msg string
+
+	chatID := message.Chat.ID
+
+	options := tg.OptionsSendMessage{}.
+		SetReplyMarkup(defaultReplyMarkup())
+
+	// check rate limit (unless the user is an admin)
+	if message.From != nil && !isAdmin(conf, update) && !allowRate(conf, message.From.ID) {
+		logDebug(conf, "rate limit exceeded: %s", userNameFromUpdate(update))
+
+		send(bot, conf, db, msgSlowDown, chatID, &message.MessageID)
+		return
+	}
+
+	// shared location: detect timezone from it
+	if message.Location != nil {
+		handleLocation(bot, db, message)
+		return
+	}
+
+	// reply to a delivered reminder (eg. "snooze 30m"): snooze it
+	if handleSnoozeReply(bot, conf, db, message) {
+		return
+	}
+
+	// check the number of active reminders (unless the user is an admin)
+	if reachedActiveRemindersLimit(conf, db, update, chatID) {
+		send(bot, conf, db, fmt.Sprintf(msgTooManyRemindersFormat, conf.MaxActiveRemindersPerChat), chatID, &message.MessageID)
+		return
+	}
+
+	// (for guiding a new chat, and asking its timezone after handling its first message)
+	isNewChat, err := db.IsNewChat(chatID)
+	if err != nil {
+		logError(db, "failed to check if chat id: %d is new: %s", chatID, err)
+	}
+
+	// guide a new chat before handling its first message
+	if isNewChat && !conf.SkipOnboarding {
+		guideFirstMessage(bot, conf, db, chatID)
+	}
+
+	// 'is typing...'
+	sendTyping(bot, conf, chatID)
+
+	// (whether to reply to it, if its type is not supported)
+	replyUnsupported := repliesToUnsupportedType(conf, message)
+
+	if message := messageFromUpdate(update); message != nil {
+		options.SetReplyParameters(tg.NewReplyParameters(message.MessageID))
+
+		if message.HasText() {
+			txt := *message.Text
+
+			// reject too long texts (unless the user is an admin)
+			if conf.MaxPromptChars > 0 && !isAdmin(conf, update) && utf8.RuneCountInString(txt) > conf.MaxPromptChars {
+				send(bot, conf, db, fmt.Sprintf(msgPromptTooLongFormat, conf.MaxPromptChars), chatID, &message.MessageID)
+				return
+			}
+
+			// check if it is a reply to (or the next message after) the bot's question for a time (eg. of /clone or clarification)
+			pending := pendingTemporaryMessage(db, *message)
+
+			// body of the reminder which is given apart from the text (eg. of a cloned, clarified, or forwarded message)
+			var body string
+			if pending != nil {
+				body = pending.Message
+			} else {
+				body = repliedContent(*message)
+			}
+
+			// numbered or bulleted list (eg. "1. call bank 2. email Joe - both tomorrow 10am"): a reminder for each item
+			if pending == nil && body == "" && !conf.DisableListReminders {
+				if items, shared, ok := splitListItems(txt); ok {
+					handleBatch(ctx, bot, conf, db, gtc, update, *message, items, shared)
+					return
+				}
+			}
+
+			// parse exact datetimes (eg. ISO 8601, epoch) and solar events (eg. "at sunset") directly, or with the model
+			var parsed []parsedItem
+			var errs []error
+			if exact, ok := parseExactDatetime(txt, chatLocation(db, chatID), time.Now()); ok {
+				parsed = []parsedItem{exact}
+			} else if solar, ok := parseSolarDatetimeOfChat(db, chatID, txt); ok && body == "" {
+				parsed = []parsedItem{solar}
+			} else if body != "" {
+				parsed, errs = parse(ctx, conf, db, gtc, *message, fmt.Sprintf("%s %s", body, txt))
+			} else {
+				parsed, errs = parse(ctx, conf, db, gtc, *message, txt)
+			}
+
+			// keep tags of the original text (eg. "#work"), even if the model dropped them
+			for i := range parsed {
+				parsed[i].Message = keepTags(parsed[i].Message, body+" "+txt)
+			}
+
+			// adjust week-relative days (eg. "next monday") to the chat's first day of weeks
+			parsed = anchorToWeekStart(parsed, txt, chatWeekStart(db, chatID), time.Now().In(chatLocation(db, chatID)))
+
+			// keep the original body (and silence of the pending one)
+			if body != "" {
+				for i := range parsed {
+					parsed[i].Message = body
+					if pending != nil && pending.Silent {
+						parsed[i].Silent = true
+					}
+				}
+			}
+
+			if len(parsed) > 0 {
+				inferred := parsed[0].Message
+
+				rolled := rollPastToNextDay(parsed, time.Now())
+				parsed = filterParsed(conf, parsed, chatLocation(db, chatID))
+
+				// all of them have already passed today: roll them to the next day, or ask
+				askRolled := false
+				if len(parsed) <= 0 && len(rolled) > 0 {
+					if conf.RollPastRemindersToNextDay {
+						parsed = filterParsed(conf, rolled, chatLocation(db, chatID))
+					} else {
+						askRolled = true
+					}
+				}
+
+				// remove too-soon ones (unless the user is an admin)
+				tooSoon := false
+				if conf.MinLeadTimeSeconds > 0 && !isAdmin(conf, update) {
+					if parsed, tooSoon = filterTooSoon(conf, parsed); tooSoon {
+						msg = fmt.Sprintf(msgTooSoonFormat, conf.MinLeadTimeSeconds)
+					}
+				}
+
+				if tooSoon {
+					// do nothing
+				} else if askRolled {
+					if _, err := db.SaveTemporaryItem(temporaryItemOf(chatID, message.MessageID, rolled[0])); err == nil {
+						msg = fmt.Sprintf(msgAlreadyPassedFormat, rolled[0].Message)
+
+						// options for inline keyboards
+						options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(
+							datetimeButtonsForCallbackQuery(rolled, chatID, message.MessageID, chatDatetimePreference(db, chatID)),
+						))
+					} else {
+						msg = msgError
+					}
+				} else if len(parsed) == 1 && (conf.ConfirmBeforeSchedule || !isConfident(conf, parsed[0])) {
+					// save it temporarily, and enqueue it when confirmed
+					if _, err := db.SaveTemporaryItem(temporaryItemOf(chatID, message.MessageID, parsed[0])); err == nil {
+						pref := chatDatetimePreference(db, chatID)
+						msg = fmt.Sprintf(msgConfirmScheduleFormat,
+							parsed[0].Message,
+							datetimeToStr(parsed[0].When, pref),
+						) + leadStr(parsed[0].LeadOffset, parsed[0].When, pref) + recurrenceStr(parsed[0].Recurrence, parsed[0].UntilOn, pref) + intervalStr(parsed[0].IntervalMinutes, parsed[0].WindowEndMinutes) + tokenUsageStr(conf, parsed[0])
+						if !isConfident(conf, parsed[0]) {
+							msg += msgNotConfident
+						}
+
+						// options for inline keyboards
+						options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(
+							confirmButtonsForCallbackQuery(parsed[0], chatID, message.MessageID),
+						))
+					} else {
+						msg = msgError
+					}
+				} else if len(parsed) == 1 {
+					what := parsed[0].Message
+					when := parsed[0].When
+
+					if queueID, err := db.EnqueueItem(QueueItem{
+						ChatID:          chatID,
+						MessageID:       message.MessageID,
+						MessageThreadID: threadIDOf(*message),
+						Message:         what,
+						FireOn:          when,
+						ModelName:       parsed[0].Model,
+						Silent:          parsed[0].Silent,
+						Recurrence:      parsed[0].Recurrence,
+						UntilOn:         parsed[0].UntilOn,
+						Source:          sourceMessage,
+						CreatedBy:       userIDOf(*message),
+
+						IntervalMinutes:  parsed[0].IntervalMinutes,
+						WindowEndMinutes: parsed[0].WindowEndMinutes,
+
+						LeadOffsetSeconds: int64(parsed[0].LeadOffset.Seconds()),
+					}); err == nil {
+						pref := chatDatetimePreference(db, chatID)
+						msg = fmt.Sprintf(msgResponseFormat,
+							what,
+							datetimeToStr(when, pref),
+						) + leadStr(parsed[0].LeadOffset, when, pref) + recurrenceStr(parsed[0].Recurrence, parsed[0].UntilOn, pref) + intervalStr(parsed[0].IntervalMinutes, parsed[0].WindowEndMinutes) + tokenUsageStr(conf, parsed[0])
+
+						// for fixing the time (if it was parsed wrong)
+						options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(
+							fixTimeButtonsForCallbackQuery(queueID),
+						))
+					} else {
+						msg = fmt.Sprintf(msgSaveFailedFormat, what, err)
+					}
+				} else if len(parsed) > 0 {
+					if _, err := db.SaveTemporaryItem(temporaryItemOf(chatID, message.MessageID, parsed[0])); err == nil {
+						msg = fmt.Sprintf(msgSelectWhat, parsed[0].Message) + tokenUsageStr(conf, parsed[0])
+
+						// options for inline keyboards
+						options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(
+							datetimeButtonsForCallbackQuery(parsed, chatID, message.MessageID, chatDatetimePreference(db, chatID)),
+						))
+					} else {
+						msg = msgError
+					}
+				} else {
+					// (all of them have already passed, and not rolled to the next day)
+					msg = fmt.Sprintf(msgAllPassedFormat, inferred)
+
+					if pending == nil {
+						// ask for a later time, and treat the next message as the time for it
+						if err := askForTime(bot, db, chatID, threadIDOf(*message), msg, inferred, false); err == nil {
+							return
+						} else {
+							logError(db, "failed to ask for the time: %s", err)
+						}
+					}
+				}
+
+				// delete the temporary message of the question
+				if pending != nil && !tooSoon {
+					if _, err := db.DeleteTemporaryMessage(pending.ChatID, pending.MessageID); err != nil {
+						logError(db, "failed to delete temporary message: %s", err)
+					}
+				}
+			} else if isNoDatetime(errs) && pending == nil {
+				msg = msgNoClue
+
+				if conf.SaveUndatedReminders {
+					// save it as an undated reminder
+					if _, err := db.EnqueueUndated(chatID, message.MessageID, threadIDOf(*message), txt, userIDOf(*message)); err == nil {
+						msg = fmt.Sprintf(msgSavedAsUndatedFormat, txt)
+					} else {
+						logError(db, "failed to save undated reminder: %s", err)
+					}
+				} else {
+					// ask for the time, and treat the next message as the time for it
+					if err := askForTime(bot, db, chatID, threadIDOf(*message), fmt.Sprintf(msgScheduleWhenFormat, txt), txt, false); err == nil {
+						return
+					} else {
+						logError(db, "failed to ask for the time: %s", err)
+					}
+				}
+			} else {
+				msg = parseFailedMessage(errs)
+			}
+		} else {
+			logInfo("no text in usable message from update.")
+
+			if !replyUnsupported {
+				return
+			}
+			msg = msgTypeNotSupported
+		}
+	} else {
+		logInfo("no usable message from update.")
+
+		if !replyUnsupported {
+			return
+		}
+		msg = msgTypeNotSupported
+	}
+
+	// fallback message
+	if len(msg) <= 0 {
+		msg = msgError
+	}
+
+	// send message
+	if sent := bot.SendMessage(chatID, msg, options); !sent.Ok {
+		logError(db, "failed to send message: %s", *sent.Description)
+	}
+
+	// ask the timezone of a new chat
+	if isNewChat {
+		askTimezone(bot, db, message)
+	}
+}
+
+// ask the timezone of given message's chat with the guessed (from the user's language) and common ones,
+// and create the chat's settings so that it will not be asked again
+func askTimezone(bot *tg.Bot, db *Database, message tg.Message) {
+	chatID := message.Chat.ID
+
+	if _, err := db.UpdateChatSetting(chatID, "timezone", ""); err != nil {
+		logError(db, "failed to create chat setting: %s", err)
+		return
+	}
+
+	options := tg.OptionsSendMessage{}.
+		SetReplyMarkup(tg.NewInlineKeyboardMarkup(timezoneButtonsForCallbackQuery(message))).
+		SetParseMode(tg.ParseModeHTML)
+	if sent := bot.SendMessage(chatID, fmt.Sprintf(msgTimezoneAskFormat, time.Now().In(_location).Format("MST")), options); !sent.Ok {
+		logError(db, "failed to send message: %s", *sent.Description)
+	}
+}
+
+// generate inline keyboard buttons of timezones for given message's chat: the guessed one (from the user's language) and common ones
+func timezoneButtonsForCallbackQuery(message tg.Message) [][]tg.InlineKeyboardButton {
+	var guessed string
+	if message.From != nil && message.From.LanguageCode != nil {
+		guessed = timezoneFromLanguageCode(*message.From.LanguageCode)
+	}
+
+	buttons := [][]tg.InlineKeyboardButton{}
+	for _, zone := range timezoneCandidates(guessed) {
+		buttons = append(buttons, []tg.InlineKeyboardButton{
+			tg.NewInlineKeyboardButton(zone).
+				SetCallbackData(fmt.Sprintf("%s %s", cmdTimezone, zone)),
+		})
+	}
+
+	return buttons
+}
+
+// guide given (new) chat before handling its first message, and mark its onboarding as done
+// (its timezone will be asked after the message is handled)
+func guideFirstMessage(bot *tg.Bot, conf config, db *Database, chatID int64) {
+	msg := msgOnboardingFirstMessage
+	if conf.OnboardingMessage != "" {
+		msg = conf.OnboardingMessage
+	}
+	send(bot, conf, db, msg, chatID, nil)
+
+	if _, err := db.UpdateChatSetting(chatID, "onboarding_step", onboardingDone); err != nil {
+		logError(db, "failed to save onboarding step: %s", err)
+	}
+}
+
+// start onboarding of given message's chat: ask the timezone first (and show examples after it is set or skipped)
+func startOnboarding(bot *tg.Bot, db *Database, message tg.Message) {
+	chatID := message.Chat.ID
+
+	if _, err := db.UpdateChatSetting(chatID, "onboarding_step", onboardingAskedTimezone); err != nil {
+		logError(db, "failed to save onboarding step: %s", err)
+		return
+	}
+
+	buttons := append(timezoneButtonsForCallbackQuery(message), []tg.InlineKeyboardButton{
+		tg.NewInlineKeyboardButton(msgOnboardingSkip).
+			SetCallbackData(fmt.Sprintf("%s %s", cmdStart, argSkip)),
+	})
+
+	options := tg.OptionsSendMessage{}.
+		SetReplyMarkup(tg.NewInlineKeyboardMarkup(buttons)).
+		SetParseMode(tg.ParseModeHTML)
+	if sent := bot.SendMessage(chatID, fmt.Sprintf(msgOnboardingAskTimezone, time.Now().In(_location).Format("MST")), options); !sent.Ok {
+		logError(db, "failed to send message: %s", *sent.Description)
+	}
+}
+
+// finish onboarding of given chat (if it is in progress), and return the message for it (or an empty one)
+func finishOnboarding(db *Database, chatID int64) string {
+	if setting, err := db.GetChatSetting(chatID); err != nil || setting.OnboardingStep != onboardingAskedTimezone {
+		return ""
+	}
+
+	if _, err := db.UpdateChatSetting(chatID, "onboarding_step", onboardingDone); err != nil {
+		logError(db, "failed to save onboarding step: %s", err)
+	}
+
+	return msgOnboardingDone
+}
+
+// generate a string of recurrence (with its end, if any), or an empty one if it is not recurring
+func recurrenceStr(recurrence string, until *time.Time, pref datetimePreference) string {
+	if recurrence == "" {
+		return ""
+	}
+
+	if until != nil {
+		return fmt.Sprintf(msgRecurrenceUntilFormat, recurrence, datetimeToStr(*until, pref))
+	}
+
+	return fmt.Sprintf(msgRecurrenceFormat, recurrence)
+}
+
+// generate a string of given interval within a window of each day, or an empty one if there is none
+func intervalStr(intervalMinutes, windowEndMinutes int) string {
+	if intervalMinutes <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(msgIntervalFormat, durationToStr(time.Duration(intervalMinutes)*time.Minute), windowEndStr(windowEndMinutes))
+}
+
+// generate a string of given end of a window (eg. "17:00"), in minutes of the day (end of the day if 0)
+func windowEndStr(windowEndMinutes int) string {
+	if windowEndMinutes <= 0 {
+		return minutesOfDayToStr(minutesInDay - 1)
+	}
+
+	return minutesOfDayToStr(windowEndMinutes)
+}
+
+// generate a string of given lead offset with the time of its event, or an empty one if there is none
+func leadStr(lead time.Duration, fireOn time.Time, pref datetimePreference) string {
+	if lead <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(msgLeadFormat, durationToStr(lead), datetimeToStr(fireOn.Add(lead), pref))
+}
+
+// generate a string of token usage for given parsed item, or an empty one if it is not needed
+func tokenUsageStr(conf config, item parsedItem) string {
+	if !conf.ShowTokenUsage || item.TokensInput+item.TokensOutput <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(msgTokenUsageFormat, item.TokensInput, item.TokensOutput, item.TokensInput+item.TokensOutput)
+}
+
+// ask for the time of given reminder body with a forced reply,
+// and keep the body until the reply (or the next message) arrives
+func askForTime(bot *tg.Bot, db *Database, chatID, threadID int64, question, body string, silent bool) error {
+	options := tg.OptionsSendMessage{}.
+		SetReplyMarkup(tg.ForceReply{ForceReply: true})
+	if threadID != 0 {
+		options.SetMessageThreadID(threadID)
+	}
+
+	sent := bot.SendMessage(chatID, question, options)
+	if !sent.Ok {
+		return fmt.Errorf("failed to send message: %s", *sent.Description)
+	}
+
+	if _, err := db.SaveTemporaryMessage(chatID, sent.Result.MessageID, body, silent); err != nil {
+		return fmt.Errorf("failed to save temporary message: %w", err)
+	}
+	if _, err := db.UpdateChatSetting(chatID, "pending_message_id", sent.Result.MessageID); err != nil {
+		return fmt.Errorf("failed to save pending message id: %w", err)
+	}
+
+	return nil
+}
+
+// get the temporary message for which the bot asked a time, if given message is the answer to it
+// (a reply to the question, or the next message after it), and stop waiting for another answer
+func pendingTemporaryMessage(db *Database, message tg.Message) (pending *TemporaryMessage) {
+	chatID := message.Chat.ID
+
+	if replied := message.ReplyToMessage; replied != nil {
+		if replied.From != nil && replied.From.IsBot {
+			if saved, err := db.LoadTemporaryMessage(chatID, replied.MessageID); err == nil {
+				pending = &saved
+			}
+		}
+	} else if setting, err := db.GetChatSetting(chatID); err == nil && setting.PendingMessageID != 0 {
+		if saved, err := db.LoadTemporaryMessage(chatID, setting.PendingMessageID); err == nil {
+			pending = &saved
+		}
+	}
+
+	if pending != nil {
+		if _, err := db.UpdateChatSetting(chatID, "pending_message_id", 0); err != nil {
+			logError(db, "failed to clear pending message id: %s", err)
+		}
+	}
+
+	return pending
+}
+
+// get the content of a quoted part, or of a replied forwarded message, from given message
+// (eg. "remind me about this tomorrow" as a reply to a forwarded message)
+func repliedContent(message tg.Message) string {
+	if message.Quote != nil && strings.TrimSpace(message.Quote.Text) != "" {
+		return strings.TrimSpace(message.Quote.Text)
+	}
+
+	if replied := message.ReplyToMessage; replied != nil && replied.ForwardOrigin != nil {
+		if replied.Text != nil {
+			return strings.TrimSpace(*replied.Text)
+		} else if replied.Caption != nil {
+			return strings.TrimSpace(*replied.Caption)
+		}
+	}
+
+	return ""
+}
+
+// handle shared location: detect and save the timezone of the chat
+func handleLocation(bot *tg.Bot, db *Database, message tg.Message) {
+	chatID := message.Chat.ID
+
+	var msg string
+	options := tg.OptionsSendMessage{}.
+		SetReplyMarkup(defaultReplyMarkup()).
+		SetReplyParameters(tg.NewReplyParameters(message.MessageID)).
+		SetParseMode(tg.ParseModeHTML)
+
+	lat, lon := float64(message.Location.Latitude), float64(message.Location.Longitude)
+
+	// save the location for times relative to the sun (eg. "at sunset")
+	if _, err := db.UpdateChatSetting(chatID, "latitude", lat); err != nil {
+		logError(db, "failed to save latitude: %s", err)
+	}
+	if _, err := db.UpdateChatSetting(chatID, "longitude", lon); err != nil {
+		logError(db, "failed to save longitude: %s", err)
+	}
+
+	zones, err := timezonesAt(lat, lon, maxTimezoneCandidates)
+	if err != nil {
+		logError(db, "failed to find timezone of location: %s", err)
+	}
+	if len(zones) > 0 {
+		if _, err := db.UpdateChatSetting(chatID, "timezone", zones[0]); err == nil {
+			msg = fmt.Sprintf(msgTimezoneDetectedFormat, zones[0]) + finishOnboarding(db, chatID)
+
+			// other candidates for correction
+			buttons := [][]tg.InlineKeyboardButton{}
+			for _, zone := range zones[1:] {
+				buttons = append(buttons, []tg.InlineKeyboardButton{
+					tg.NewInlineKeyboardButton(zone).
+						SetCallbackData(fmt.Sprintf("%s %s", cmdTimezone, zone)),
+				})
+			}
+			if len(buttons) > 0 {
+				options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(buttons))
+			}
+		} else {
+			logError(db, "failed to save timezone: %s", err)
+		}
+	}
+
+	// send message
+	if len(msg) <= 0 {
+		msg = msgError
+	}
+	if sent := bot.SendMessage(chatID, msg, options); !sent.Ok {
+		logError(db, "failed to send message: %s", *sent.Description)
+	}
+}
+
+// handle allowed callback query from telegram bot api
+func handleCallbackQuery(b *tg.Bot, conf config, db *Database, query tg.CallbackQuery) {
+	data := *query.Data
+
+	msg := msgError
+	var markup *tg.InlineKeyboardMarkup // inline keyboards for the edited message (if any)
+
+	if strings.HasPrefix(data, cmdCancelAll) { // (before /cancel, which is a prefix of it)
+		if filter, found := strings.CutPrefix(strings.TrimSpace(strings.Replace(data, cmdCancelAll, "", 1)), argConfirm); found {
+			if count, err := db.DeleteQueueItemsMatching(query.Message.Chat.ID, strings.TrimSpace(filter)); err == nil {
+				msg = fmt.Sprintf(msgCanceledAllFormat, count)
+			} else {
+				logError(db, "failed to cancel reminders: %s", err)
+			}
+		} else {
+			logError(db, "malformed inline keyboard data: %s", data)
+		}
+	} else if strings.HasPrefix(data, cmdCancel) {
+		if data == cmdCancel {
+			msg = msgCommandCanceled
+		} else {
+			cancelParam := strings.TrimSpace(strings.Replace(data, cmdCancel, "", 1))
+			if queueID, err := strconv.Atoi(cancelParam); err == nil {
+				if item, err := db.GetQueueItem(query.Message.Chat.ID, int64(queueID)); err == nil {
+					if _, err := db.DeleteQueueItem(query.Message.Chat.ID, int64(queueID)); err == nil {
+						msg = fmt.Sprintf(msgReminderCanceledFormat, item.Message)
+					} else {
+						logError(db, "failed to delete reminder: %s", err)
+					}
+				} else {
+					logError(db, "failed to get reminder: %s", err)
+				}
+			} else {
+				logError(db, "unprocessable callback query: %s", data)
+			}
+		}
+	} else if strings.HasPrefix(data, cmdSnooze) {
+		params := strings.SplitN(strings.TrimSpace(strings.Replace(data, cmdSnooze, "", 1)), "/", 2)
+
+		if len(params) >= 2 {
+			if queueID, err := strconv.ParseInt(params[0], 10, 64); err == nil {
+				if item, err := db.GetQueueItem(query.Message.Chat.ID, queueID); err == nil {
+					if when, err := snoozeUntil(params[1], time.Now()); err == nil {
+						if snoozedID, err := enqueueSnoozed(db, item, when, query.From.ID); err == nil {
+							// (snoozing acknowledges it too)
+							if _, err := db.AcknowledgeQueueItem(item.ChatID, item.ID); err != nil {
+								logError(db, "failed to cancel re-notifications: %s", err)
+							}
+
+							msg = fmt.Sprintf(msgSnoozedFormat,
+								item.Message,
+								datetimeToStr(when, chatDatetimePreference(db, item.ChatID)),
+							)
+
+							// for undoing it (if snoozed by accident)
+							keyboard := tg.NewInlineKeyboardMarkup(undoSnoozeButtonsForCallbackQuery(snoozedID, item.ID))
+							markup = &keyboard
+						} else {
+							msg = fmt.Sprintf(msgSaveFailedFormat, item.Message, err)
+						}
+					} else {
+						logError(db, "failed to parse snooze preset: %s", err)
+					}
+				} else {
+					logError(db, "failed to get reminder: %s", err)
+				}
+			} else {
+				logError(db, "failed to convert queue id: %s", err)
+			}
+		} else {
+			logError(db, "malformed inline keyboard data: %s", data)
+		}
+	} else if strings.HasPrefix(data, cmdUnsnooze) {
+		params := strings.SplitN(strings.TrimSpace(strings.Replace(data, cmdUnsnooze, "", 1)), "/", 2)
+
+		if len(params) >= 2 {
+			chatID := query.Message.Chat.ID
+
+			if snoozedID, err := strconv.ParseInt(params[0], 10, 64); err == nil {
+				if originalID, err := strconv.ParseInt(params[1], 10, 64); err == nil {
+					if snoozed, err := db.GetQueueItem(chatID, snoozedID); err == nil {
+						if snoozed.DeliveredOn != nil {
+							msg = fmt.Sprintf(msgAlreadyDeliveredFormat, snoozed.Message)
+						} else if _, err := db.DeleteQueueItem(chatID, snoozedID); err == nil {
+							// restore the delivered reminder (and its buttons, for snoozing it again)
+							if original, err := db.GetQueueItem(chatID, originalID); err == nil {
+								msg = messageForDelivery(conf, db, original)
+								keyboard := tg.NewInlineKeyboardMarkup(deliveredButtonsForCallbackQuery(db, original))
+								markup = &keyboard
+							} else {
+								logError(db, "failed to get reminder: %s", err)
+							}
+						} else {
+							logError(db, "failed to delete snoozed reminder: %s", err)
+						}
+					} else {
+						logError(db, "failed to get snoozed reminder: %s", err)
+					}
+				} else {
+					logError(db, "failed to convert queue id: %s", err)
+				}
+			} else {
+				logError(db, "failed to convert queue id: %s", err)
+			}
+		} else {
+			logError(db, "malformed inline keyboard data: %s", data)
+		}
+	} else if strings.HasPrefix(data, cmdUndated) {
+		if queueID, err := strconv.ParseInt(strings.TrimSpace(strings.Replace(data, cmdUndated, "", 1)), 10, 64); err == nil {
+			if item, err := db.GetQueueItem(query.Message.Chat.ID, queueID); err == nil {
+				setting, _ := db.GetChatSetting(item.ChatID)
+
+				msg = fmt.Sprintf(msgScheduleWhenFormat, item.Message)
+				keyboard := tg.NewInlineKeyboardMarkup(
+					append(
+						scheduleButtonsForCallbackQuery(item.ID, snoozePresetsOf(setting)),
+						[]tg.InlineKeyboardButton{
+							tg.NewInlineKeyboardButton(msgCancel).
+								SetCallbackData(cmdCancel),
+						},
+					),
+				)
+				markup = &keyboard
+			} else {
+				logError(db, "failed to get reminder: %s", err)
+			}
+		} else {
+			logError(db, "failed to convert queue id: %s", err)
+		}
+	} else if strings.HasPrefix(data, cmdChangeTime) {
+		params := strings.Split(strings.TrimSpace(strings.Replace(data, cmdChangeTime, "", 1)), "/")
+
+		if len(params) >= 2 {
+			if chatID, err := strconv.ParseInt(params[0], 10, 64); err == nil {
+				if messageID, err := strconv.ParseInt(params[1], 10, 64); err == nil {
+					if saved, err := db.LoadTemporaryMessage(chatID, messageID); err == nil {
+						// ask for a new time
+						if err := askForTime(b, db, chatID, threadIDOf(tg.Message(*query.Message)), fmt.Sprintf(msgScheduleWhenFormat, saved.Message), saved.Message, saved.Silent); err == nil {
+							msg = fmt.Sprintf(msgChangingTimeFormat, saved.Message)
+
+							// delete temporary message (not to be confirmed anymore)
+							if _, err := db.DeleteTemporaryMessage(chatID, messageID); err != nil {
+								logError(db, "failed to delete temporary message: %s", err)
+							}
+						} else {
+							logError(db, "failed to ask for the time: %s", err)
+						}
+					} else {
+						logError(db, "failed to load temporary message with chat id: %d, message id: %d", chatID, messageID)
+					}
+				} else {
+					logError(db, "failed to convert message id: %s", err)
+				}
+			} else {
+				logError(db, "failed to convert chat id: %s", err)
+			}
+		} else {
+			logError(db, "malformed inline keyboard data: %s", data)
+		}
+	} else if strings.HasPrefix(data, cmdFixTime) {
+		if queueID, err := strconv.ParseInt(strings.TrimSpace(strings.Replace(data, cmdFixTime, "", 1)), 10, 64); err == nil {
+			if item, err := db.GetQueueItem(query.Message.Chat.ID, queueID); err == nil {
+				if item.DeliveredOn != nil {
+					msg = fmt.Sprintf(msgAlreadyDeliveredFormat, item.Message)
+				} else {
+					setting, _ := db.GetChatSetting(item.ChatID)
+
+					// (will be rescheduled in the same way as undated ones)
+					msg = fmt.Sprintf(msgFixTimeWhenFormat, item.Message)
+					keyboard := tg.NewInlineKeyboardMarkup(
+						append(
+							scheduleButtonsForCallbackQuery(item.ID, snoozePresetsOf(setting)),
+							[]tg.InlineKeyboardButton{
+								tg.NewInlineKeyboardButton(msgCancel).
+									SetCallbackData(cmdCancel),
+							},
+						),
+					)
+					markup = &keyboard
+				}
+			} else {
+				logError(db, "failed to get reminder: %s", err)
+			}
+		} else {
+			logError(db, "failed to convert queue id: %s", err)
+		}
+	} else if strings.HasPrefix(data, cmdSchedule) {
+		params := strings.SplitN(strings.TrimSpace(strings.Replace(data, cmdSchedule, "", 1)), "/", 2)
+
+		if len(params) >= 2 {
+			if queueID, err := strconv.ParseInt(params[0], 10, 64); err == nil {
+				msg = scheduleUndated(db, query.Message.Chat.ID, queueID, params[1])
+			} else {
+				logError(db, "failed to convert queue id: %s", err)
+			}
+		} else {
+			logError(db, "malformed inline keyboard data: %s", data)
+		}
+	} else if strings.HasPrefix(data, cmdMilestones) {
+		params := strings.SplitN(strings.TrimSpace(strings.Replace(data, cmdMilestones, "", 1)), "/", 2)
+
+		if len(params) >= 2 {
+			if queueID, err := strconv.ParseInt(params[0], 10, 64); err == nil {
+				if offsets, err := parseMilestones(params[1]); err == nil {
+					if item, err := db.GetQueueItem(query.Message.Chat.ID, queueID); err == nil {
+						if _, err := db.SetMilestones(item.ChatID, item.ID, offsets); err == nil {
+							msg = fmt.Sprintf(msgMilestonesSetFormat, milestonesToStr(offsets), item.Message)
+						} else {
+							logError(db, "failed to set milestones: %s", err)
+						}
+					} else {
+						logError(db, "failed to get reminder: %s", err)
+					}
+				} else {
+					msg = fmt.Sprintf(msgMilestonesInvalidFormat, err)
+				}
+			} else {
+				logError(db, "failed to convert queue id: %s", err)
+			}
+		} else {
+			logError(db, "malformed inline keyboard data: %s", data)
+		}
+	} else if strings.HasPrefix(data, cmdEscalate) {
+		params := strings.SplitN(strings.TrimSpace(strings.Replace(data, cmdEscalate, "", 1)), "/", 2)
+
+		if len(params) >= 2 {
+			if queueID, err := strconv.ParseInt(params[0], 10, 64); err == nil {
+				if minutes, err := strconv.Atoi(params[1]); err == nil {
+					if item, err := db.GetQueueItem(query.Message.Chat.ID, queueID); err == nil {
+						if _, err := db.SetEscalation(item.ChatID, item.ID, minutes); err == nil {
+							if minutes > 0 {
+								msg = fmt.Sprintf(msgEscalateSetFormat, item.Message, durationToStr(time.Duration(minutes)*time.Minute), maxEscalations)
+							} else {
+								msg = fmt.Sprintf(msgEscalateOffFormat, item.Message)
+							}
+						} else {
+							logError(db, "failed to set escalation: %s", err)
+						}
+					} else {
+						logError(db, "failed to get reminder: %s", err)
+					}
+				} else {
+					logError(db, "failed to convert minutes: %s", err)
+				}
+			} else {
+				logError(db, "failed to convert queue id: %s", err)
+			}
+		} else {
+			logError(db, "malformed inline keyboard data: %s", data)
+		}
+	} else if strings.HasPrefix(data, cmdAcknowledge) {
+		if queueID, err := strconv.ParseInt(strings.TrimSpace(strings.Replace(data, cmdAcknowledge, "", 1)), 10, 64); err == nil {
+			if _, err := db.AcknowledgeQueueItem(query.Message.Chat.ID, queueID); err == nil {
+				// keep the delivered message and its snooze and feedback buttons
+				var original string
+				if query.Message.Text != nil {
+					original = *query.Message.Text
+				}
+				msg = fmt.Sprintf(msgAcknowledgedFormat, original)
+
+				buttons := [][]tg.InlineKeyboardButton{}
+				if setting, err := db.GetChatSetting(query.Message.Chat.ID); err == nil {
+					buttons = append(buttons, snoozeButtonsForCallbackQuery(queueID, snoozePresetsOf(setting))...)
+				}
+				keyboard := tg.NewInlineKeyboardMarkup(append(buttons, feedbackButtonsForCallbackQuery(queueID)...))
+				markup = &keyboard
+			} else {
+				logError(db, "failed to acknowledge reminder: %s", err)
+			}
+		} else {
+			logError(db, "failed to convert queue id: %s", err)
+		}
+	} else if strings.HasPrefix(data, cmdClone) {
+		if queueID, err := strconv.ParseInt(strings.TrimSpace(strings.Replace(data, cmdClone, "", 1)), 10, 64); err == nil {
+			if item, err := db.GetQueueItem(query.Message.Chat.ID, queueID); err == nil {
+				// ask for a new time
+				if err := askForTime(b, db, item.ChatID, threadIDOf(tg.Message(*query.Message)), fmt.Sprintf(msgCloneWhenFormat, item.Message), item.Message, item.Silent); err == nil {
+					msg = fmt.Sprintf(msgCloningFormat, item.Message)
+				} else {
+					logError(db, "failed to ask for the time: %s", err)
+				}
+			} else {
+				logError(db, "failed to get reminder: %s", err)
+			}
+		} else {
+			logError(db, "failed to convert queue id: %s", err)
+		}
+	} else if strings.HasPrefix(data, cmdFeedback) {
+		params := strings.SplitN(strings.TrimSpace(strings.Replace(data, cmdFeedback, "", 1)), "/", 2)
+
+		if len(params) >= 2 {
+			if queueID, err := strconv.ParseInt(params[0], 10, 64); err == nil {
+				helpful := params[1] == argHelpful
+
+				if _, err := db.SaveDeliveryFeedback(query.Message.Chat.ID, queueID, query.From.ID, helpful); err == nil {
+					reaction := msgNotHelpful
+					if helpful {
+						reaction = msgHelpful
+					}
+
+					// keep the delivered message and its snooze buttons
+					var original string
+					if query.Message.Text != nil {
+						original, _, _ = strings.Cut(*query.Message.Text, feedbackSeparator)
+					}
+					msg = fmt.Sprintf(msgFeedbackFormat, original, reaction)
+					if setting, err := db.GetChatSetting(query.Message.Chat.ID); err == nil {
+						keyboard := tg.NewInlineKeyboardMarkup(snoozeButtonsForCallbackQuery(queueID, snoozePresetsOf(setting)))
+						markup = &keyboard
+					}
+				} else {
+					logError(db, "failed to save delivery feedback: %s", err)
+				}
+			} else {
+				logError(db, "failed to convert queue id: %s", err)
+			}
+		} else {
+			logError(db, "malformed inline keyboard data: %s", data)
+		}
+	} else if strings.HasPrefix(data, cmdStart) {
+		if strings.TrimSpace(strings.Replace(data, cmdStart, "", 1)) == argSkip {
+			msg = msgOnboardingSkipped + finishOnboarding(db, query.Message.Chat.ID)
+		} else {
+			logError(db, "malformed inline keyboard data: %s", data)
+		}
+	} else if strings.HasPrefix(data, cmdSuggested) {
+		cmd, args, _ := strings.Cut(strings.TrimSpace(strings.Replace(data, cmdSuggested, "", 1)), " ")
+
+		if newHandler := suggestableCommandHandler(cmd); newHandler != nil {
+			// run the suggested command as if the user sent it
+			text := strings.TrimSpace(cmd + " " + args)
+			message := tg.Message(*query.Message)
+			message.From = &query.From
+			message.Text = &text
+
+			newHandler(conf, db)(b, tg.Update{Message: &message}, args)
+
+			msg = text
+		} else {
+			logError(db, "malformed inline keyboard data: %s", data)
+		}
+	} else if strings.HasPrefix(data, cmdDatetime) {
+		msg = setDatetimeFormat(db, query.Message.Chat.ID, strings.TrimSpace(strings.Replace(data, cmdDatetime, "", 1)))
+	} else if strings.HasPrefix(data, cmdTimezone) {
+		msg = setTimezone(db, query.Message.Chat.ID, strings.TrimSpace(strings.Replace(data, cmdTimezone, "", 1)))
+	} else if strings.HasPrefix(data, cmdClearHistory) {
+		if strings.TrimSpace(strings.Replace(data, cmdClearHistory, "", 1)) == argConfirm {
+			if count, err := db.DeleteDeliveredItems(query.Message.Chat.ID); err == nil {
+				msg = fmt.Sprintf(msgHistoryClearedFormat, count)
+			} else {
+				logError(db, "failed to delete delivered reminders: %s", err)
+			}
+		} else {
+			logError(db, "malformed inline keyboard data: %s", data)
+		}
+	} else if strings.HasPrefix(data, cmdLoad) {
+		params := strings.Split(strings.TrimSpace(strings.Replace(data, cmdLoad, "", 1)), "/")
+
+		if len(params) >= 3 {
+			if chatID, err := strconv.ParseInt(params[0], 10, 64); err == nil {
+				if messageID, err := strconv.ParseInt(params[1], 10, 64); err == nil {
+					if saved, err := db.LoadTemporaryMessage(chatID, messageID); err == nil {
+						if when, err := time.ParseInLocation(datetimeFormat, params[2], _location); err != nil {
+							logError(db, "failed to parse time: %s", err)
+						} else if !when.After(time.Now()) { // (eg. a button pressed long after it was sent)
+							msg = fmt.Sprintf(msgSelectedTimePassedFormat, saved.Message)
+
+							// delete temporary message
+							if _, err := db.DeleteTemporaryMessage(chatID, messageID); err != nil {
+								logError(db, "failed to delete temporary message: %s", err)
+							}
+						} else if _, tooSoon := filterTooSoon(conf, []parsedItem{{Message: saved.Message, When: when}}); tooSoon && conf.MinLeadTimeSeconds > 0 && !isAdmin(conf, tg.Update{CallbackQuery: &query}) { // (same as the ones in messages, unless the user is an admin)
+							msg = fmt.Sprintf(msgTooSoonFormat, conf.MinLeadTimeSeconds)
+
+							// delete temporary message
+							if _, err := db.DeleteTemporaryMessage(chatID, messageID); err != nil {
+								logError(db, "failed to delete temporary message: %s", err)
+							}
+						} else if queueID, err := db.EnqueueItem(QueueItem{
+							ChatID:          chatID,
+							MessageID:       messageID,
+							MessageThreadID: threadIDOf(tg.Message(*query.Message)),
+							Message:         saved.Message,
+							FireOn:          when,
+							ModelName:       conf.GoogleGenerativeModel,
+							Silent:          saved.Silent,
+							Recurrence:      saved.Recurrence,
+							UntilOn:         saved.UntilOn,
+							Source:          sourceMessage,
+							CreatedBy:       query.From.ID,
+
+							IntervalMinutes:  saved.IntervalMinutes,
+							WindowEndMinutes: saved.WindowEndMinutes,
+
+							LeadOffsetSeconds: saved.LeadOffsetSeconds,
+						}); err == nil {
+							pref := chatDatetimePreference(db, chatID)
+							msg = fmt.Sprintf(msgResponseFormat,
+								saved.Message,
+								datetimeToStr(when, pref),
+							) + leadStr(time.Duration(saved.LeadOffsetSeconds)*time.Second, when, pref) + recurrenceStr(saved.Recurrence, saved.UntilOn, pref) + intervalStr(saved.IntervalMinutes, saved.WindowEndMinutes)
+
+							// for fixing the time (if it was parsed wrong)
+							keyboard := tg.NewInlineKeyboardMarkup(fixTimeButtonsForCallbackQuery(queueID))
+							markup = &keyboard
+
+							// delete temporary message
+							if _, err := db.DeleteTemporaryMessage(chatID, messageID); err != nil {
+								logError(db, "failed to delete temporary message: %s", err)
+							}
+						} else {
+							msg = fmt.Sprintf(msgSaveFailedFormat, saved.Message, err)
+						}
+					} else {
+						logError(db, "failed to load temporary message with chat id: %d, message id: %d", chatID, messageID)
+					}
+				} else {
+					logError(db, "failed to convert message id: %s", err)
+				}
+			} else {
+				logError(db, "failed to convert chat id: %s", err)
+			}
+		} else {
+			logError(db, "malformed inline keyboard data: %s", data)
+		}
+	} else {
+		logError(db, "unprocessable callback query: %s", data)
+	}
+
+	// answer callback query (with a short toast, if configured so)
+	answer := msg
+	if conf.ShortCallbackAnswers {
+		answer = msgCallbackAnswered
+	}
+	if apiResult := b.AnswerCallbackQuery(
+		query.ID,
+		tg.OptionsAnswerCallbackQuery{}.
+			SetText(answer),
+	); apiResult.Ok {
+		// edit message and remove (or replace) inline keyboards
+		options := tg.OptionsEditMessageText{}.
+			SetIDs(query.Message.Chat.ID, query.Message.MessageID)
+		if markup != nil {
+			options.SetReplyMarkup(*markup)
+		}
+		if apiResult := b.EditMessageText(msg, options); !apiResult.Ok {
+			logError(db, "failed to edit message text: %s", *apiResult.Description)
+
+			// send the result as a new message instead
+			// (edited texts are not parsed as HTML, so escape them here)
+			if !conf.DisableEditFallback {
+				send(b, conf, db, escapeHTML(msg), query.Message.Chat.ID, nil)
+			}
+		}
+	} else {
+		logError(db, "failed to answer callback query: %s", prettify(query))
+	}
+}
+
+// get chat id from given update
+func chatIDFromUpdate(update tg.Update) (chatID int64, exists bool) {
+	if message, _ := update.GetMessage(); message != nil {
+		return message.Chat.ID, true
+	} else if update.HasCallbackQuery() && update.CallbackQuery.Message != nil {
+		return update.CallbackQuery.Message.Chat.ID, true
+	}
+
+	return 0, false
+}
+
+// get the thread (topic) id of given message, or 0 if it has none
+func threadIDOf(message tg.Message) int64 {
+	if message.MessageThreadID != nil {
+		return *message.MessageThreadID
+	}
+
+	return 0
+}
+
+// get the id of the user who sent given message, or 0 if unknown (eg. in channels)
+func userIDOf(message tg.Message) int64 {
+	if message.From != nil {
+		return message.From.ID
+	}
+
+	return 0
+}
+
+// get usable message from given update
+func messageFromUpdate(update tg.Update) (message *tg.Message) {
+	if update.HasMessage() && update.Message.HasText() {
+		message = update.Message
+	} else if update.HasMessage() && update.Message.HasDocument() {
+		message = update.Message
+	} else if update.HasEditedMessage() && update.EditedMessage.HasText() {
+		message = update.EditedMessage
+	}
+
+	if message == nil {
+		logInfo("no usable message from update.")
+	}
+
+	return message
+}
+
+// types of unsupported messages (for `unsupported_types_to_reply`)
+var _unsupportedMessageTypes = []string{"sticker", "photo", "animation", "video", "video_note", "voice", "audio", "document", "contact", "poll", "dice", "venue", "other"}
+
+// get the type of given message (eg. "sticker", "photo"), for replying to unsupported ones
+func messageTypeOf(message tg.Message) string {
+	switch {
+	case message.Text != nil:
+		return "text"
+	case message.Sticker != nil:
+		return "sticker"
+	case len(message.Photo) > 0:
+		return "photo"
+	case message.Animation != nil: // (before document, as animations have documents too)
+		return "animation"
+	case message.Video != nil:
+		return "video"
+	case message.VideoNote != nil:
+		return "video_note"
+	case message.Voice != nil:
+		return "voice"
+	case message.Audio != nil:
+		return "audio"
+	case message.Document != nil:
+		return "document"
+	case message.Contact != nil:
+		return "contact"
+	case message.Poll != nil:
+		return "poll"
+	case message.Dice != nil:
+		return "dice"
+	case message.Venue != nil:
+		return "venue"
+	}
+
+	return "other" // (eg. service messages in groups)
+}
+
+// check if given unsupported message should be replied with 'not supported' (`unsupported_types_to_reply`)
+func repliesToUnsupportedType(conf config, message tg.Message) bool {
+	if conf.UnsupportedTypesToReply == nil {
+		return true
+	}
+
+	return slices.Contains(conf.UnsupportedTypesToReply, messageTypeOf(message))
+}
+
+// escape given user-derived text (eg. messages of reminders) for interpolating it into messages in HTML parse mode
+//
+// (only `<`, `>`, `&`, and quotes need to be escaped in HTML parse mode, so intended markups of formats are preserved,
+// and markdown characters like `_` or `*` are kept as they are)
+func escapeHTML(text string) string {
+	return html.EscapeString(text)
+}
+
+// times of the last chat actions sent to each chat
+var _chatActionsSentOn = map[int64]time.Time{}
+var _chatActionsSentOnLock sync.Mutex
+
+// send 'is typing...' to given chat, unless it was sent within `chat_action_debounce_seconds`
+func sendTyping(bot *tg.Bot, conf config, chatID int64) {
+	_chatActionsSentOnLock.Lock()
+	now := time.Now()
+	if sentOn, exists := _chatActionsSentOn[chatID]; exists && now.Sub(sentOn) < time.Duration(conf.ChatActionDebounceSeconds)*time.Second {
+		_chatActionsSentOnLock.Unlock()
+		return
+	}
+	_chatActionsSentOn[chatID] = now
+
+	// (remove stale ones, not to grow indefinitely)
+	for id, sentOn := range _chatActionsSentOn {
+		if now.Sub(sentOn) >= time.Duration(conf.ChatActionDebounceSeconds)*time.Second {
+			delete(_chatActionsSentOn, id)
+		}
+	}
+	_chatActionsSentOnLock.Unlock()
+
+	_ = bot.SendChatAction(chatID, tg.ChatActionTyping, nil)
+}
+
+// send given message to the chat, and return the id of the sent message (0 if it failed)
+func send(bot *tg.Bot, conf config, db *Database, message string, chatID int64, messageID *int64) (sentMessageID int64) {
+	sendTyping(bot, conf, chatID)
+
+	logDebug(conf, "[verbose] sending message to chat(%d): '%s'", chatID, message)
+
+	options := tg.OptionsSendMessage{}.
+		SetReplyMarkup(defaultReplyMarkup()).
+		SetParseMode(tg.ParseModeHTML)
+	if messageID != nil {
+		options.SetReplyParameters(tg.NewReplyParameters(*messageID))
+	}
+	if res := sendMessageWithRetries(bot, conf, chatID, message, options); res.Ok {
+		sentMessageID = res.Result.MessageID
+	} else {
+		logError(db, "failed to send message: %s", *res.Description)
+	}
+
+	return sentMessageID
+}
+
+// type for parsed items
+type parsedItem struct {
+	Message   string
+	When      time.Time
+	Generated bool   // if this item was generated by the bot (due to vague request)
+	Exact     bool   // if this item was parsed from an exact datetime (without the model)
+	Model     string // name of the model which parsed this item
+	Silent    bool   // if this item should be delivered without notification sound
+
+	Recurrence string     // cron expression (if this item should be repeated)
+	UntilOn    *time.Time // end of the recurrence (if any)
+
+	IntervalMinutes  int // interval of repeating within a window of each day (0 if none)
+	WindowEndMinutes int // end of the window, in minutes of the day
+
+	LeadOffset time.Duration // notified this much before the event (`When` is already moved earlier by it)
+
+	Confidence *float64 // confidence of the model about `When` (0.0 ~ 1.0), nil if not scored (eg. exact datetimes)
+
+	// token counts of the generation which parsed this item
+	TokensInput, TokensOutput int
+}
+
+// check if the model was confident enough about the time of given parsed item, for scheduling it without confirmation
+func isConfident(conf config, item parsedItem) bool {
+	if conf.MinConfidenceToSchedule <= 0 || item.Exact || item.Confidence == nil {
+		return true
+	}
+
+	return *item.Confidence >= conf.MinConfidenceToSchedule
+}
+
+// get the hour and minute for reminders with a day but no time, with the policy of given config
+func noTimeFallback(conf config) (hour, minute int) {
+	switch conf.NoTimePolicy {
+	case noTimePolicyStartOfDay:
+		return 0, 0
+	case noTimePolicyEndOfDay:
+		return 23, 59
+	default: // noTimePolicyFixedHour
+		return conf.DefaultHour, 0
+	}
+}
+
+// function declarations for genai model
+func fnDeclarations(conf config) []*genai.FunctionDeclaration {
+	fallbackHour, fallbackMinute := noTimeFallback(conf)
+
+	return []*genai.FunctionDeclaration{
+		{
+			Name:        fnNameInferDatetime,
+			Description: fnDescriptionInferDatetime,
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					fnArgNameInferredDatetime: {
+						Type:        genai.TypeString,
+						Description: fmt.Sprintf(fnArgDescriptionInferredDatetime, fallbackHour, fallbackMinute),
+						Nullable:    false,
+					},
+					fnArgNameMessageToSend: {
+						Type:        genai.TypeString,
+						Description: fnArgDescriptionMessageToSend,
+						Nullable:    false,
+					},
+					fnArgNameSilent: {
+						Type:        genai.TypeBoolean,
+						Description: fnArgDescriptionSilent,
+						Nullable:    true,
+					},
+					fnArgNameRecurrence: {
+						Type:        genai.TypeString,
+						Description: fnArgDescriptionRecurrence,
+						Nullable:    true,
+					},
+					fnArgNameRecurrenceUntil: {
+						Type:        genai.TypeString,
+						Description: fnArgDescriptionRecurrenceUntil,
+						Nullable:    true,
+					},
+					fnArgNameRecurrenceInterval: {
+						Type:        genai.TypeInteger,
+						Description: fnArgDescriptionRecurrenceInterval,
+						Nullable:    true,
+					},
+					fnArgNameRecurrenceWindowEnd: {
+						Type:        genai.TypeString,
+						Description: fnArgDescriptionRecurrenceWindowEnd,
+						Nullable:    true,
+					},
+					fnArgNameLeadMinutes: {
+						Type:        genai.TypeInteger,
+						Description: fnArgDescriptionLeadMinutes,
+						Nullable:    true,
+					},
+					fnArgNameConfidence: {
+						Type:        genai.TypeNumber,
+						Description: fnArgDescriptionConfidence,
+						Nullable:    true,
+					},
+				},
+				Nullable: false,
+			},
+		},
+	}
+}
+
+// handle function call
+func handleFnCall(conf config, fn genai.FunctionCall, loc *time.Location) (result []parsedItem, err error) {
+	logDebug(conf, "[verbose] handling function call: %s", prettify(fn))
+
+	result = []parsedItem{}
+
+	if fn.Name == fnNameInferDatetime {
+		datetime := val[string](fn.Args, fnArgNameInferredDatetime)
+		message := val[string](fn.Args, fnArgNameMessageToSend)
+		silent := val[bool](fn.Args, fnArgNameSilent)
+		recurrence := val[string](fn.Args, fnArgNameRecurrence)
+		until := val[string](fn.Args, fnArgNameRecurrenceUntil)
+		intervalMinutes := val[float64](fn.Args, fnArgNameRecurrenceInterval) // (numbers are float64 in function calls)
+		windowEnd := val[string](fn.Args, fnArgNameRecurrenceWindowEnd)
+		leadMinutes := val[float64](fn.Args, fnArgNameLeadMinutes)
+
+		if message != "" && datetime != "" {
+			if t, e := time.ParseInLocation(datetimeFormat, datetime, loc); e == nil {
+				item := parsedItem{
+					Message:   message,
+					When:      t,
+					Generated: false,
+					Silent:    silent,
+				}
+
+				// (ignore invalid recurrences, and save it as a one-time reminder)
+				if recurrence != "" {
+					if _, e := parseCron(recurrence); e == nil {
+						item.Recurrence = recurrence
+
+						if until != "" {
+							if u, e := time.ParseInLocation(datetimeFormat, until, loc); e == nil {
+								item.UntilOn = &u
+							} else {
+								logDebug(conf, "[verbose] ignoring invalid '%s' in function call: %s", fnArgNameRecurrenceUntil, until)
+							}
+						}
+
+						// (repeated within a window of each day)
+						if intervalMinutes > 0 && intervalMinutes < minutesInDay {
+							item.IntervalMinutes = int(intervalMinutes)
+
+							if windowEnd != "" {
+								if minutes, e := parseMinutesOfDay(windowEnd); e == nil {
+									item.WindowEndMinutes = minutes
+								} else {
+									logDebug(conf, "[verbose] ignoring invalid '%s' in function call: %s", fnArgNameRecurrenceWindowEnd, windowEnd)
+								}
+							}
+						}
+					} else {
+						logDebug(conf, "[verbose] ignoring invalid '%s' in function call: %s", fnArgNameRecurrence, recurrence)
+					}
+				}
+
+				// notify before the event
+				if leadMinutes > 0 {
+					item.LeadOffset = time.Duration(leadMinutes) * time.Minute
+					item.When = item.When.Add(-item.LeadOffset)
+				}
+
+				// (not scored if not given)
+				if confidence, ok := fn.Args[fnArgNameConfidence].(float64); ok {
+					item.Confidence = &confidence
+				}
+
+				result = append(result, item)
+			} else {
+				err = fmt.Errorf("%w: failed to parse '%s' (%s) in function call: %s", ErrNoDatetime, fnArgNameInferredDatetime, e, prettify(fn.Args))
+			}
+		} else {
+			err = fmt.Errorf("%w: invalid `%s` and/or `%s` in function call: %s", ErrNoDatetime, fnArgNameInferredDatetime, fnArgNameMessageToSend, prettify(fn.Args))
+		}
+	} else {
+		err = fmt.Errorf("%w: no function declaration for name: %s", ErrAmbiguous, fn.Name)
+	}
+
+	if err != nil {
+		logDebug(conf, "[verbose] there was an error with returned function call: %s", err)
+	}
+
+	return result, err
+}
+
+// get value for given `key` from `m`, return the zero value if it has no such key
+func val[T any](m map[string]any, key string) T {
+	var r T
+
+	if v, exists := m[key]; exists {
+		if v, ok := v.(T); ok {
+			r = v
+		}
+	}
+
+	return r
+}
+
+// prettify given value in indented JSON format (for debugging purporse)
+func prettify(v any) string {
+	if bytes, err := json.MarshalIndent(v, "", "  "); err == nil {
+		return string(bytes)
+	}
+
+	return fmt.Sprintf("%+v", v)
+}
+
+// create a new gemini-things client with given API key and model
+func newGeminiClient(apiKey, model string) (*gt.Client, error) {
+	gtc, err := gt.NewClient(apiKey, model)
+	if err != nil {
+		return nil, err
+	}
+	gtc.SetSystemInstructionFunc(func() string {
+		return fmt.Sprintf(systemInstruction, time.Now().In(_location).Format(datetimeFormat))
+	})
+
+	return gtc, nil
+}
+
+// create a new gemini-things client with given user's own API key, or return nil if there is none
+func userGeminiClient(conf config, db *Database, userID int64) *gt.Client {
+	if conf.EncryptionKey == "" {
+		return nil
+	}
+
+	saved, err := db.GetUserAPIKey(userID)
+	if err != nil {
+		return nil
+	}
+
+	apiKey, err := db.Decrypt(saved.EncryptedKey)
+	if err != nil {
+		logError(db, "failed to decrypt API key of user %d: %s", userID, err)
+		return nil
+	}
+
+	gtc, err := newGeminiClient(apiKey, conf.GoogleGenerativeModel)
+	if err != nil {
+		logError(db, "failed to initialize gemini-things client for user %d: %s", userID, err)
+		return nil
+	}
+
+	return gtc
+}
+
+// generation config with the parameters of given config (nil for the defaults of the model)
+func generationConfig(conf config) *genai.GenerationConfig {
+	if conf.Temperature == nil && conf.TopP == nil && conf.MaxOutputTokens <= 0 {
+		return nil
+	}
+
+	generation := &genai.GenerationConfig{
+		Temperature: conf.Temperature,
+		TopP:        conf.TopP,
+	}
+	if conf.MaxOutputTokens > 0 {
+		generation.MaxOutputTokens = &conf.MaxOutputTokens
+	}
+
+	return generation
+}
+
+// parse given string, generate items from the parsed ones, and return them
+func parse(ctx context.Context, conf config, db *Database, gtc *gt.Client, message tg.Message, text string) (result []parsedItem, errs []error) {
+	result = []parsedItem{}
+	errs = []error{}
+
+	chatID := message.Chat.ID
+	userID := message.From.ID
+	username := userName(message.From)
+
+	// tell the model the current datetime in the chat's timezone, if it is not the default one
+	loc := chatLocation(db, chatID)
+	prompt := text
+	if loc != _location {
+		prompt = fmt.Sprintf(promptWithTimezoneFormat, loc, time.Now().In(loc).Format(datetimeFormat), text)
+	}
+
+	// tell the model the chat's own phrases of times in the text (eg. "lunch" => 12:30), if any
+	aliases := aliasesInText(db, chatID, text)
+	if aliases != "" {
+		prompt = fmt.Sprintf(promptWithAliasesFormat, aliases, prompt)
+	}
+
+	// use the cached result of the same text (with the same aliases), if any
+	cacheKey := parseCacheKey(conf, loc, aliases+text, time.Now())
+	if cached, exists := cachedParse(conf, cacheKey); exists {
+		logDebug(conf, "[verbose] using cached result of: '%s'", text)
+
+		savePromptAndResult(conf, db, chatID, userID, username, text, 0, 0, "", conf.GoogleGenerativeModel, 0)
+
+		return cached, errs
+	}
+
+	// use the user's own API key, if there is one
+	if userGtc := userGeminiClient(conf, db, userID); userGtc != nil {
+		defer userGtc.Close()
+
+		gtc = userGtc
+	}
+
+	// options for generation
+	opts := &gt.GenerationOptions{
+		Config: generationConfig(conf),
+		// set function declarations
+		Tools: []*genai.Tool{
+			{
+				FunctionDeclarations: fnDeclarations(conf),
+			},
+		},
+		// function call config
+		ToolConfig: &genai.ToolConfig{
+			// https://cloud.google.com/vertex-ai/generative-ai/docs/model-reference/function-calling
+			FunctionCallingConfig: &genai.FunctionCallingConfig{
+				Mode: genai.FunctionCallingAny,
+				AllowedFunctionNames: []string{
 					fnNameInferDatetime,
 				},
 			},
 		},
 	}
 
-	// generate text
-	var numTokensInput, numTokensOutput int32
-	if generated, err := gtc.Generate(
-		ctx,
-		text,
-		nil,
-		opts,
-	); err == nil {
-		logDebug(conf, "[verbose] generated: %s", prettify(generated))
+	// generate text (retry on transient errors)
+	var numTokensInput, numTokensOutput int32
+	generated, err := gtc.Generate(ctx, prompt, nil, opts)
+	retries := 0
+	for err != nil && retries < conf.ParseMaxRetries && isTransientError(err) {
+		retries++
+
+		backoff := parseRetryBackoff * time.Duration(1<<(retries-1))
+		logInfo("retrying generation (%d/%d) in %s after a transient error: %s", retries, conf.ParseMaxRetries, backoff, errorString(err))
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(backoff):
+			generated, err = gtc.Generate(ctx, prompt, nil, opts)
+		}
+	}
+	if err == nil {
+		logDebug(conf, "[verbose] generated: %s", prettify(generated))
+
+		// token counts
+		numTokensInput, numTokensOutput = generated.UsageMetadata.PromptTokenCount, generated.UsageMetadata.CandidatesTokenCount
+
+		if len(generated.Candidates) <= 0 {
+			errs = append(errs, fmt.Errorf("%w: no returned candidate", ErrAmbiguous))
+
+			logError(db, "there was no returned candidate")
+		} else {
+			for _, candidate := range generated.Candidates {
+				content := candidate.Content
+
+				if len(content.Parts) > 0 {
+					for _, part := range content.Parts {
+						if fnCall, ok := part.(genai.FunctionCall); ok { // if it is a function call,
+							if handled, err := handleFnCall(conf, fnCall, loc); err == nil {
+								for i := range handled {
+									handled[i].Model = conf.GoogleGenerativeModel
+									handled[i].TokensInput = int(numTokensInput)
+									handled[i].TokensOutput = int(numTokensOutput)
+								}
+
+								// append result
+								result = append(result, handled...)
+							} else {
+								errs = append(errs, err)
+
+								logError(db, "failed to handle function call: %s", err)
+							}
+							break
+						}
+					}
+				} else {
+					errs = append(errs, fmt.Errorf("%w: no part in content", ErrAmbiguous))
+
+					logError(db, "there was no part in the returned content")
+				}
+			}
+
+			if len(result) <= 0 {
+				errs = append(errs, fmt.Errorf("%w: no function call in parts", ErrAmbiguous))
+
+				logError(db, "there was no usable function call in the returned parts")
+			}
+		}
+	} else {
+		errs = append(errs, fmt.Errorf("%w: failed to generate text: %s", ErrModelUnavailable, errorString(err)))
+
+		logError(db, "failed to generate text: %s", errorString(err))
+	}
+
+	// log the result of every attempt (with the reason of failure, if nothing was parsed)
+	var failReason string
+	if len(result) <= 0 {
+		if len(errs) <= 0 { // (should not happen, but not to be counted as a successful one)
+			errs = append(errs, fmt.Errorf("%w: nothing was parsed", ErrAmbiguous))
+		}
+		failReason = errors.Join(errs...).Error()
+	}
+	savePromptAndResult(conf, db, chatID, userID, username, text, int(numTokensInput), int(numTokensOutput), failReason, conf.GoogleGenerativeModel, retries)
+
+	// cache successful ones only
+	if len(result) > 0 && len(errs) <= 0 {
+		cacheParse(conf, cacheKey, result)
+	}
+
+	return result, errs
+}
+
+// cached result of parsing
+type parseCacheEntry struct {
+	result    []parsedItem
+	expiresOn time.Time
+}
+
+// cached results of parsing, by their keys
+var _parseCache = map[string]parseCacheEntry{}
+var _parseCacheLock sync.Mutex
+
+// generate the key of the parse cache for given text
+//
+// (with the date in the chat's timezone, as results of date-relative texts like "tomorrow" change on the next day)
+func parseCacheKey(conf config, loc *time.Location, text string, now time.Time) string {
+	normalized := strings.ToLower(collapseSpaces(text)) // (line breaks are kept, as they are kept in the parsed messages)
+
+	return strings.Join([]string{conf.GoogleGenerativeModel, loc.String(), now.In(loc).Format("2006-01-02"), normalized}, "\x00")
+}
+
+// get the cached result of given key, if it exists and is not expired
+func cachedParse(conf config, key string) (result []parsedItem, exists bool) {
+	if conf.ParseCacheTTLSeconds <= 0 {
+		return nil, false
+	}
+
+	_parseCacheLock.Lock()
+	defer _parseCacheLock.Unlock()
+
+	entry, exists := _parseCache[key]
+	if !exists || time.Now().After(entry.expiresOn) {
+		return nil, false
+	}
+
+	// (no tokens were used for cached ones)
+	result = slices.Clone(entry.result)
+	for i := range result {
+		result[i].TokensInput, result[i].TokensOutput = 0, 0
+	}
+
+	return result, true
+}
+
+// cache given result with the key, for `parse_cache_ttl_seconds`
+func cacheParse(conf config, key string, result []parsedItem) {
+	if conf.ParseCacheTTLSeconds <= 0 {
+		return
+	}
+
+	_parseCacheLock.Lock()
+	defer _parseCacheLock.Unlock()
+
+	// remove expired ones, not to grow indefinitely
+	now := time.Now()
+	for k, entry := range _parseCache {
+		if now.After(entry.expiresOn) {
+			delete(_parseCache, k)
+		}
+	}
+
+	_parseCache[key] = parseCacheEntry{
+		result:    slices.Clone(result),
+		expiresOn: now.Add(time.Duration(conf.ParseCacheTTLSeconds) * time.Second),
+	}
+}
+
+// marker of epoch times in messages (eg. "@1736917200 call mom")
+const epochMarker = "@"
+
+// exact datetimes later than this many years from now are ignored (eg. mistyped ones)
+const maxExactDatetimeYears = 10
+
+// layouts of exact datetimes which can be parsed without the model
+var exactDatetimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// parse given text which starts (or ends) with an exact datetime (eg. "2025-01-15T14:00:00+09:00 message", "message 2025-01-15 14:00"),
+// or epoch time with a marker (eg. "@1736917200 message"), or only with it (eg. "1736917200")
+//
+// (zone-less datetimes are in given location, eg. the chat's timezone)
+func parseExactDatetime(text string, loc *time.Location, now time.Time) (item parsedItem, ok bool) {
+	text = strings.TrimSpace(text)
+
+	fields := strings.Fields(text)
+	if len(fields) <= 0 {
+		return item, false
+	}
+
+	// (bare epoch time, only when it is the whole message; not to take numbers in messages, eg. phone numbers)
+	if len(fields) == 1 && isEpochString(text) {
+		fields[0] = epochMarker + text
+	}
+
+	// candidates of (datetime, message) pairs
+	first, last := fields[0], fields[len(fields)-1]
+	candidates := [][2]string{
+		{first, strings.TrimSpace(strings.TrimPrefix(text, first))},
+		{last, strings.TrimSpace(strings.TrimSuffix(text, last))},
+	}
+	if len(fields) >= 2 { // eg. "2025-01-15 14:00 message", "message 2025-01-15 14:00"
+		second, secondLast := fields[1], fields[len(fields)-2]
+		rest := strings.TrimSpace(strings.TrimPrefix(text, first))
+		candidates = append(candidates, [2]string{
+			first + " " + second,
+			strings.TrimSpace(strings.TrimPrefix(rest, second)),
+		})
+		rest = strings.TrimSpace(strings.TrimSuffix(text, last))
+		candidates = append(candidates, [2]string{
+			secondLast + " " + last,
+			strings.TrimSpace(strings.TrimSuffix(rest, secondLast)),
+		})
+	}
+
+	for _, candidate := range candidates {
+		datetime, message := candidate[0], candidate[1]
+
+		if when, parsed := parseExactDatetimeString(datetime, loc); parsed {
+			// (absurdly far ones are not what the user meant)
+			if when.After(now.AddDate(maxExactDatetimeYears, 0, 0)) {
+				continue
+			}
+
+			if message == "" {
+				message = text
+			}
+
+			return parsedItem{
+				Message: message,
+				When:    when,
+				Exact:   true,
+			}, true
+		}
+	}
+
+	return item, false
+}
+
+// parse given string as an exact datetime, or epoch time with a marker (eg. "@1736917200")
+func parseExactDatetimeString(str string, loc *time.Location) (when time.Time, ok bool) {
+	for _, layout := range exactDatetimeLayouts {
+		if t, err := time.ParseInLocation(layout, str, loc); err == nil {
+			return t, true
+		}
+	}
+
+	// epoch seconds (10 digits) or milliseconds (13 digits)
+	if epochStr, found := strings.CutPrefix(str, epochMarker); found && isEpochString(epochStr) {
+		if epoch, err := strconv.ParseInt(epochStr, 10, 64); err == nil && epoch > 0 {
+			if len(epochStr) == 13 {
+				return time.UnixMilli(epoch).In(loc), true
+			}
+			return time.Unix(epoch, 0).In(loc), true
+		}
+	}
+
+	return when, false
+}
+
+// check if given string looks like epoch seconds (10 digits) or milliseconds (13 digits)
+func isEpochString(str string) bool {
+	if len(str) != 10 && len(str) != 13 {
+		return false
+	}
+	for _, r := range str {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filter parsed items to be all valid
+func filterParsed(conf config, parsed []parsedItem, loc *time.Location) (filtered []parsedItem) {
+	// add some generated items for convenience
+	generated := []parsedItem{}
+	for _, p := range parsed {
+		// save it as it is,
+		generated = append(generated, p)
+
+		// (no need to generate more for exact datetimes, or recurring ones which have their own times)
+		if p.Exact || p.Recurrence != "" {
+			continue
+		}
+
+		// and add generated ones,
+		when := p.When.In(loc)
+		hour, minute := when.Hour(), when.Minute()
+		if hour == 0 && minute == 0 {
+			// time for reminders with no time
+			fallbackHour, fallbackMinute := noTimeFallback(conf)
+			generated = append(generated, parsedItem{
+				Message:    p.Message,
+				When:       when.Add(time.Hour*time.Duration(fallbackHour) + time.Minute*time.Duration(fallbackMinute)),
+				Generated:  true,
+				Model:      p.Model,
+				Silent:     p.Silent,
+				Confidence: p.Confidence,
+			})
+		} else if hour < 12 {
+			// add 12 hours if it is AM
+			generated = append(generated, parsedItem{
+				Message:    p.Message,
+				When:       when.Add(time.Hour * 12),
+				Generated:  true,
+				Model:      p.Model,
+				Silent:     p.Silent,
+				Confidence: p.Confidence,
+			})
+		}
+	}
+
+	// rank them,
+	now := time.Now()
+	generated = rankParsed(generated, now)
+
+	// and remove already-passed or duplicated ones
+	filtered = []parsedItem{}
+	duplicated := map[string]bool{}
+	for _, p := range generated {
+		when := p.When.In(_location)
+
+		// remove duplicated ones,
+		dup := when.Format(datetimeFormat)
+		if _, exists := duplicated[dup]; exists {
+			continue
+		} else {
+			duplicated[dup] = true // mark as duplicated,
+
+			// and remove already-passed ones
+			if when.After(now) {
+				filtered = append(filtered, p)
+			}
+		}
+	}
+
+	return filtered
+}
+
+// build a temporary message of given parsed item, which will be enqueued with one of the times in inline keyboards
+func temporaryItemOf(chatID, messageID int64, item parsedItem) TemporaryMessage {
+	return TemporaryMessage{
+		ChatID:           chatID,
+		MessageID:        messageID,
+		Message:          item.Message,
+		Silent:           item.Silent,
+		Recurrence:       item.Recurrence,
+		UntilOn:          item.UntilOn,
+		IntervalMinutes:  item.IntervalMinutes,
+		WindowEndMinutes: item.WindowEndMinutes,
+
+		LeadOffsetSeconds: int64(item.LeadOffset.Seconds()),
+	}
+}
+
+// get items which have passed within a day, rolled to the next day (eg. "at 9am" at 10am => 9am tomorrow)
+func rollPastToNextDay(parsed []parsedItem, now time.Time) (rolled []parsedItem) {
+	rolled = []parsedItem{}
+
+	for _, p := range parsed {
+		if !p.When.After(now) && p.When.After(now.AddDate(0, 0, -1)) {
+			r := p // (keeping its recurrence, window, and lead offset)
+			r.When = p.When.AddDate(0, 0, 1)
+			r.Generated = true
+
+			rolled = append(rolled, r)
+		}
+	}
+
+	return rolled
+}
+
+// rank parsed items (without modifying `parsed`) with following rules, in order:
+//
+//  1. items with both a datetime and a message come first,
+//  2. items with past (or current) datetimes come last,
+//  3. items with earlier datetimes come first,
+//  4. and items with the same rank keep their original order (eg. parsed ones before generated ones).
+func rankParsed(parsed []parsedItem, now time.Time) (ranked []parsedItem) {
+	ranked = slices.Clone(parsed)
+
+	slices.SortStableFunc(ranked, func(a, b parsedItem) int {
+		if aComplete, bComplete := isCompleteParsedItem(a), isCompleteParsedItem(b); aComplete != bComplete {
+			if aComplete {
+				return -1
+			}
+			return 1
+		}
+		if aPast, bPast := !a.When.After(now), !b.When.After(now); aPast != bPast {
+			if bPast {
+				return -1
+			}
+			return 1
+		}
+		return a.When.Compare(b.When)
+	})
+
+	return ranked
+}
+
+// check if given parsed item has both a datetime and a message
+func isCompleteParsedItem(item parsedItem) bool {
+	return !item.When.IsZero() && strings.TrimSpace(item.Message) != ""
+}
+
+// filter out items which are sooner than the minimum lead time,
+// and return `tooSoon` = true if all of them were filtered out
+func filterTooSoon(conf config, parsed []parsedItem) (filtered []parsedItem, tooSoon bool) {
+	filtered = []parsedItem{}
+
+	minFireOn := time.Now().Add(time.Duration(conf.MinLeadTimeSeconds) * time.Second)
+	for _, p := range parsed {
+		if !p.When.Before(minFireOn) {
+			filtered = append(filtered, p)
+		}
+	}
+
+	return filtered, len(parsed) > 0 && len(filtered) <= 0
+}
+
+// generate user's name
+func userName(user *tg.User) string {
+	if user.Username != nil {
+		return fmt.Sprintf("@%s (%s)", *user.Username, user.FirstName)
+	} else {
+		return user.FirstName
+	}
+}
+
+// generate user's name from update
+func userNameFromUpdate(update tg.Update) string {
+	if user := update.GetFrom(); user != nil {
+		return userName(user)
+	}
+
+	logInfo("there was no `from` in `update`")
+
+	return "unknown"
+}
+
+// save prompt and its result (successful if `failReason` is empty) to logs database
+func savePromptAndResult(conf config, db *Database, chatID, userID int64, username string, prompt string, promptTokens int, resultTokens int, failReason string, model string, retries int) {
+	if db != nil {
+		// save only the numbers of tokens and the result
+		if !storesPrompts(conf, db, chatID) {
+			userID, username, prompt = 0, "", ""
+		}
+
+		if err := db.SavePrompt(Prompt{
+			ChatID:   chatID,
+			UserID:   userID,
+			Username: username,
+			Text:     prompt,
+			Tokens:   promptTokens,
+			Result: ParsedItem{
+				Successful: failReason == "",
+				Tokens:     resultTokens,
+				ModelName:  model,
+				Retries:    retries,
+				FailReason: failReason,
+			},
+		}); err != nil {
+			log.Printf("failed to save prompt & result to database: %s", err)
+		}
+	}
+}
+
+// check if the texts of prompts of given chat should be saved
+func storesPrompts(conf config, db *Database, chatID int64) bool {
+	if conf.StorePrompts != nil && !*conf.StorePrompts {
+		return false
+	}
+
+	if setting, err := db.GetChatSetting(chatID); err == nil {
+		return !setting.NoPromptStorage
+	} else {
+		logError(db, "failed to get chat setting: %s", err)
+	}
+
+	return true
+}
+
+// generate a help message with version info
+func helpMessage(conf config) string {
+	return fmt.Sprintf(msgHelp, conf.GoogleGenerativeModel, version.Build(version.OS|version.Architecture|version.Revision), githubPageURL)
+}
+
+// return a /start command handler
+func startCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, _ string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "start command not allowed: %s", userNameFromUpdate(update))
+
+			// guide not-allowed users (with the rate limit of /whoami)
+			if message := messageFromUpdate(update); message != nil && message.From != nil && allowWhoAmIRate(message.From.ID) {
+				msg := msgStartNotAllowed
+				if conf.UnauthorizedReply != "" {
+					msg = conf.UnauthorizedReply
+				}
+				send(b, conf, db, msg, message.Chat.ID, nil)
+			}
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			chatID := message.Chat.ID
+
+			if db == nil || conf.SkipOnboarding {
+				send(b, conf, db, msgStart, chatID, nil)
+			} else if setting, err := db.GetChatSetting(chatID); err == nil && setting.OnboardingStep == onboardingDone {
+				send(b, conf, db, msgStartAgain, chatID, nil)
+			} else {
+				startOnboarding(b, db, *message)
+			}
+		}
+	}
+}
+
+// render given reminder as a line of /list (in HTML)
+func listItemText(r QueueItem, pref datetimePreference, verbose bool) (text string) {
+	text = fmt.Sprintf(msgListItemFormat, datetimeToStr(r.FireOn, pref), escapeHTML(firstLine(r.Message, listItemMessageLength)))
+	if r.LeadOffsetSeconds > 0 {
+		lead := time.Duration(r.LeadOffsetSeconds) * time.Second
+		text += fmt.Sprintf(msgListItemLeadFormat, durationToStr(lead), datetimeToStr(r.FireOn.Add(lead), pref))
+	}
+	if r.Recurrence != "" {
+		text += fmt.Sprintf(msgListItemCronFormat, escapeHTML(r.Recurrence))
+		if r.IntervalMinutes > 0 {
+			text += fmt.Sprintf(msgListItemIntervalFormat, durationToStr(time.Duration(r.IntervalMinutes)*time.Minute), windowEndStr(r.WindowEndMinutes))
+		}
+		if r.UntilOn != nil {
+			text += fmt.Sprintf(msgListItemUntilFormat, datetimeToStr(*r.UntilOn, pref))
+		}
+	}
+	if r.Silent {
+		text += msgListItemSilent
+	}
+	if verbose && r.ModelName != "" {
+		text += fmt.Sprintf(msgListItemModelFormat, escapeHTML(r.ModelName))
+	}
+	if verbose && r.Source != "" {
+		text += fmt.Sprintf(msgListItemSourceFormat, r.Source)
+	}
+
+	return text
+}
+
+// return a /list command handler
+func listRemindersCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "start command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+
+			// "verbose", "sort=created", "#work", ...
+			verbose := false
+			sortKey := listSortFireOn
+			var tag string
+			for _, arg := range strings.Fields(args) {
+				if arg == argListVerbose {
+					verbose = true
+				} else if key, found := strings.CutPrefix(arg, argListSort); found {
+					sortKey = key
+				} else if strings.HasPrefix(arg, "#") {
+					tag = normalizeTag(arg)
+				}
+			}
+
+			// (all of them, or the ones with the tag)
+			listReminders := func(order string) ([]QueueItem, error) {
+				if tag != "" {
+					return db.QueueItemsByTag(chatID, tag, order)
+				}
+				return db.SortedUndeliveredQueueItems(chatID, order)
+			}
+
+			// cancel buttons of each reminder (not for too many of them)
+			var buttons [][]tg.InlineKeyboardButton
+
+			if order, valid := listSortOrders[sortKey]; !valid {
+				msg = fmt.Sprintf(msgListSortInvalidFormat, escapeHTML(sortKey), strings.Join([]string{listSortFireOn, listSortCreated, listSortMessage}, ", "))
+			} else if reminders, err := listReminders(order); err == nil {
+				if len(reminders) > 0 {
+					pref := chatDatetimePreference(db, chatID)
+					for _, r := range reminders {
+						msg += listItemText(r, pref, verbose) + "\n"
+					}
+
+					if len(reminders) <= maxListCancelButtons {
+						for _, r := range reminders {
+							buttons = append(buttons, []tg.InlineKeyboardButton{
+								tg.NewInlineKeyboardButton(fmt.Sprintf(msgListCancelButtonFormat, datetimeToStr(r.FireOn, pref), firstLine(r.Message, listButtonMessageLength))).
+									SetCallbackData(fmt.Sprintf("%s %d", cmdCancel, r.ID)),
+							})
+						}
+					}
+				} else if tag != "" {
+					msg = fmt.Sprintf(msgNoTaggedRemindersFormat, escapeHTML(tag))
+				} else {
+					msg = msgNoReminders
+				}
+			} else {
+				logError(db, "failed to process %s: %s", cmdListReminders, err)
+			}
+
+			// send message (with cancel buttons, if any)
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			if len(buttons) > 0 {
+				options := tg.OptionsSendMessage{}.
+					SetReplyMarkup(tg.NewInlineKeyboardMarkup(buttons)).
+					SetParseMode(tg.ParseModeHTML)
+				if sent := sendMessageWithRetries(b, conf, chatID, msg, options); !sent.Ok {
+					logError(db, "failed to send message: %s", *sent.Description)
+				}
+			} else {
+				send(b, conf, db, msg, chatID, nil)
+			}
+		}
+	}
+}
+
+// return a /history command handler
+func historyCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "history command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+
+			// "", "20", "20 2"
+			perPage, page := historyItemsPerPage, 1
+			fields := strings.Fields(args)
+			valid := len(fields) <= 2
+			for i, field := range fields {
+				n, err := strconv.Atoi(field)
+				if err != nil || n <= 0 {
+					valid = false
+					break
+				}
+				if i == 0 {
+					perPage = min(n, maxHistoryItemsPerPage)
+				} else {
+					page = n
+				}
+			}
+
+			if !valid {
+				msg = fmt.Sprintf(msgHistoryUsageFormat, cmdHistory, cmdHistory)
+			} else if delivered, err := db.DeliveredQueueItems(chatID, perPage+1, perPage*(page-1)); err == nil { // (one more item for checking if there are older ones)
+				if len(delivered) > 0 {
+					hasMore := len(delivered) > perPage
+					if hasMore {
+						delivered = delivered[:perPage]
+					}
+
+					pref := chatDatetimePreference(db, chatID)
+					for _, d := range delivered {
+						msg += fmt.Sprintf(msgHistoryItemFormat, datetimeToStr(*d.DeliveredOn, pref), escapeHTML(firstLine(d.Message, listItemMessageLength)))
+						if d.Recurrence != "" {
+							msg += fmt.Sprintf(msgListItemCronFormat, escapeHTML(d.Recurrence))
+						}
+						msg += "\n"
+					}
+					if hasMore {
+						msg += "\n" + fmt.Sprintf(msgHistoryMoreFormat, cmdHistory, perPage, page+1)
+					}
+				} else if page > 1 {
+					msg = fmt.Sprintf(msgNoHistoryPageFormat, page)
+				} else {
+					msg = msgNoHistory
+				}
+			} else {
+				logError(db, "failed to process %s: %s", cmdHistory, err)
+			}
+
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			send(b, conf, db, msg, chatID, nil)
+		}
+	}
+}
+
+// order clauses for sort keys of /list
+var listSortOrders = map[string]string{
+	listSortFireOn:  "fire_on asc",
+	listSortCreated: "created_at desc, id desc",
+	listSortMessage: "message asc",
+}
+
+// return a /cancel command handler
+func cancelCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "start command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+			options := tg.OptionsSendMessage{}.
+				SetReplyMarkup(defaultReplyMarkup())
+
+			if reminders, err := db.CancelableQueueItems(chatID); err == nil { // (including undated ones)
+				if len(reminders) > 0 {
+					// inline keyboards
+					keys := make(map[string]string)
+					pref := chatDatetimePreference(db, chatID)
+					for _, r := range reminders {
+						keys[fmt.Sprintf(msgListItemFormat, fireOnToStr(r, pref), firstLine(r.Message, listItemMessageLength))] = fmt.Sprintf("%s %d", cmdCancel, r.ID)
+					}
+					buttons := tg.NewInlineKeyboardButtonsAsRowsWithCallbackData(keys)
+
+					// add a cancel button for canceling reminder
+					buttons = append(buttons, []tg.InlineKeyboardButton{
+						tg.NewInlineKeyboardButton(msgCancel).
+							SetCallbackData(cmdCancel),
+					})
+
+					// options
+					options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(buttons))
+
+					msg = msgCancelWhat
+				} else {
+					msg = msgNoReminders
+				}
+			} else {
+				logError(db, "failed to process %s: %s", cmdCancel, err)
+			}
+
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			if sent := b.SendMessage(chatID, msg, options); !sent.Ok {
+				logError(db, "failed to send message: %s", *sent.Description)
+			}
+		}
+	}
+}
+
+// return a /cancelall command handler
+func cancelAllCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "cancelall command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+			options := tg.OptionsSendMessage{}.
+				SetReplyMarkup(defaultReplyMarkup())
+
+			// eg. "#work", "dentist", or empty for all
+			filter := strings.TrimSpace(args)
+			data := strings.TrimSpace(fmt.Sprintf("%s %s %s", cmdCancelAll, argConfirm, filter))
+
+			if len(data) > maxCallbackDataLength {
+				msg = msgCancelAllFilterTooLong
+			} else if reminders, err := db.UndeliveredQueueItemsMatching(chatID, filter); err == nil {
+				if len(reminders) > 0 {
+					// echo what will be canceled
+					pref := chatDatetimePreference(db, chatID)
+					lines := []string{}
+					for i, r := range reminders {
+						if i >= maxCancelAllPreviews {
+							lines = append(lines, fmt.Sprintf(msgCancelAllMoreFormat, len(reminders)-i))
+							break
+						}
+						lines = append(lines, fmt.Sprintf(msgListItemFormat, fireOnToStr(r, pref), firstLine(r.Message, listItemMessageLength)))
+					}
+					msg = fmt.Sprintf(msgCancelAllConfirmFormat, len(reminders), strings.Join(lines, "\n"))
+
+					// ask for confirmation
+					options.SetReplyMarkup(tg.NewInlineKeyboardMarkup([][]tg.InlineKeyboardButton{
+						{
+							tg.NewInlineKeyboardButton(fmt.Sprintf(msgCancelAllYesFormat, len(reminders))).
+								SetCallbackData(data),
+							tg.NewInlineKeyboardButton(msgCancel).
+								SetCallbackData(cmdCancel),
+						},
+					}))
+				} else if filter != "" {
+					msg = fmt.Sprintf(msgCancelAllNoMatchFormat, filter)
+				} else {
+					msg = msgNoReminders
+				}
+			} else {
+				logError(db, "failed to process %s: %s", cmdCancelAll, err)
+			}
+
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			if sent := b.SendMessage(chatID, msg, options); !sent.Ok {
+				logError(db, "failed to send message: %s", *sent.Description)
+			}
+		}
+	}
+}
+
+// return a /clone command handler
+func cloneCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "clone command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+			options := tg.OptionsSendMessage{}.
+				SetReplyMarkup(defaultReplyMarkup())
+
+			if reminders, err := db.UndeliveredQueueItems(chatID); err == nil {
+				if len(reminders) > 0 {
+					// inline keyboards
+					keys := make(map[string]string)
+					pref := chatDatetimePreference(db, chatID)
+					for _, r := range reminders {
+						keys[fmt.Sprintf(msgListItemFormat, datetimeToStr(r.FireOn, pref), firstLine(r.Message, listItemMessageLength))] = fmt.Sprintf("%s %d", cmdClone, r.ID)
+					}
+					buttons := tg.NewInlineKeyboardButtonsAsRowsWithCallbackData(keys)
+
+					// add a cancel button
+					buttons = append(buttons, []tg.InlineKeyboardButton{
+						tg.NewInlineKeyboardButton(msgCancel).
+							SetCallbackData(cmdCancel),
+					})
+
+					// options
+					options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(buttons))
+
+					msg = msgCloneWhat
+				} else {
+					msg = msgNoReminders
+				}
+			} else {
+				logError(db, "failed to process %s: %s", cmdClone, err)
+			}
+
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			if sent := b.SendMessage(chatID, msg, options); !sent.Ok {
+				logError(db, "failed to send message: %s", *sent.Description)
+			}
+		}
+	}
+}
+
+// return a /preset command handler
+func presetCommandHandler(ctx context.Context, conf config, db *Database, gtc *gt.Client) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "preset command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			chatID := message.Chat.ID
+			messageID := message.MessageID
+
+			// "save NAME TEXT", "use NAME", "list", "delete NAME"
+			var msg string
+			fields := strings.Fields(args)
+			var subcmd, name string
+			if len(fields) > 0 {
+				subcmd = fields[0]
+			}
+			if len(fields) > 1 {
+				name = fields[1]
+			}
+
+			switch {
+			case subcmd == argPresetSave && len(fields) > 2:
+				if isValidPresetName(name) {
+					text := strings.Join(fields[2:], " ")
+					if _, err := db.SavePreset(chatID, name, text); err == nil {
+						msg = fmt.Sprintf(msgPresetSavedFormat, name)
+					} else {
+						logError(db, "failed to save preset: %s", err)
+					}
+				} else {
+					msg = fmt.Sprintf(msgPresetInvalidNameFormat, escapeHTML(name), maxPresetNameLength)
+				}
+			case subcmd == argPresetUse && len(fields) == 2:
+				if preset, err := db.GetPreset(chatID, name); err == nil {
+					// handle the text of the preset as if it was sent by the user
+					handleMessage(ctx, b, conf, db, gtc, updateWithText(update, preset.Text), *message)
+					return
+				} else {
+					msg = fmt.Sprintf(msgNoSuchPresetFormat, escapeHTML(name))
+				}
+			case subcmd == argPresetList && len(fields) == 1:
+				if presets, err := db.ListPresets(chatID); err == nil {
+					if len(presets) > 0 {
+						lines := []string{}
+						for _, preset := range presets {
+							lines = append(lines, fmt.Sprintf(msgListPresetFormat, preset.Name, escapeHTML(preset.Text)))
+						}
+						msg = strings.Join(lines, "\n")
+					} else {
+						msg = msgNoPresets
+					}
+				} else {
+					logError(db, "failed to list presets: %s", err)
+				}
+			case subcmd == argPresetDelete && len(fields) == 2:
+				if deleted, err := db.DeletePreset(chatID, name); err == nil {
+					if deleted {
+						msg = fmt.Sprintf(msgPresetDeletedFormat, name)
+					} else {
+						msg = fmt.Sprintf(msgNoSuchPresetFormat, escapeHTML(name))
+					}
+				} else {
+					logError(db, "failed to delete preset: %s", err)
+				}
+			default:
+				msg = msgPresetUsage
+			}
+
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			send(b, conf, db, msg, chatID, &messageID)
+		}
+	}
+}
+
+// check if given preset name is valid
+func isValidPresetName(name string) bool {
+	if len(name) <= 0 || len(name) > maxPresetNameLength {
+		return false
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// copy given update, replacing the text of its message with given one
+func updateWithText(update tg.Update, text string) tg.Update {
+	if update.Message != nil {
+		message := *update.Message
+		message.Text = &text
+		update.Message = &message
+	}
+	if update.EditedMessage != nil {
+		message := *update.EditedMessage
+		message.Text = &text
+		update.EditedMessage = &message
+	}
+
+	return update
+}
+
+// check if given message is awaited by the bot (eg. a reply to the bot's question, or the next message after it)
+func isAwaitedMessage(db *Database, message tg.Message) bool {
+	if replied := message.ReplyToMessage; replied != nil {
+		return replied.From != nil && replied.From.IsBot
+	}
+
+	setting, err := db.GetChatSetting(message.Chat.ID)
+	return err == nil && setting.PendingMessageID != 0
+}
+
+// return a /remind command handler
+func remindCommandHandler(ctx context.Context, conf config, db *Database, gtc *gt.Client) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "remind command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			if text := strings.TrimSpace(args); text != "" {
+				// handle the arguments as if they were sent by the user
+				handleMessage(ctx, b, conf, db, gtc, updateWithText(update, text), *message)
+			} else {
+				send(b, conf, db, msgRemindUsage, message.Chat.ID, &message.MessageID)
+			}
+		}
+	}
+}
+
+// return a /clearhistory command handler
+func clearHistoryCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "clearhistory command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			chatID := message.Chat.ID
+
+			// ask for confirmation
+			options := tg.OptionsSendMessage{}.
+				SetReplyMarkup(tg.NewInlineKeyboardMarkup([][]tg.InlineKeyboardButton{
+					{
+						tg.NewInlineKeyboardButton(msgClearHistoryYes).
+							SetCallbackData(fmt.Sprintf("%s %s", cmdClearHistory, argConfirm)),
+						tg.NewInlineKeyboardButton(msgCancel).
+							SetCallbackData(cmdCancel),
+					},
+				}))
+			if sent := b.SendMessage(chatID, msgClearHistoryConfirm, options); !sent.Ok {
+				logError(db, "failed to send message: %s", *sent.Description)
+			}
+		}
+	}
+}
+
+// return a /privacy command handler
+func privacyCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if message := messageFromUpdate(update); message != nil {
+			chatID := message.Chat.ID
+
+			// (only allowed users can see or change the setting of the chat)
+			if db == nil || !isAllowed(conf, update) {
+				send(b, conf, db, msgPrivacy, chatID, nil)
+				return
+			}
+
+			msg := msgPrivacy
+			switch strings.TrimSpace(args) {
+			case argPrivacyOff, argPrivacyOn:
+				off := strings.TrimSpace(args) == argPrivacyOff
+				if _, err := db.UpdateChatSetting(chatID, "no_prompt_storage", off); err == nil {
+					if off {
+						msg = msgPrivacyOff
+					} else {
+						msg = msgPrivacyOn
+					}
+				} else {
+					logError(db, "failed to save privacy setting: %s", err)
+
+					msg = msgError
+				}
+			default:
+				if conf.StorePrompts != nil && !*conf.StorePrompts {
+					msg += msgPrivacyPromptsDisabled
+				} else if storesPrompts(conf, db, chatID) {
+					msg += msgPrivacyPromptsStored
+				} else {
+					msg += msgPrivacyPromptsNotSaved
+				}
+			}
+
+			send(b, conf, db, msg, chatID, nil)
+		}
+	}
+}
+
+// return a /forgetme command handler
+func forgetMeCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "forgetme command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+
+			if message.Chat.Type != tg.ChatTypePrivate && !isAdmin(conf, update) { // (not to be wiped out by any member of the group)
+				msg = msgForgetMeNotAllowed
+			} else if strings.TrimSpace(args) != argConfirm { // (should be typed, not to be done by accident)
+				msg = fmt.Sprintf(msgForgetMeWarningFormat, cmdForgetMe, argConfirm)
+			} else if count, err := db.DeleteAllUserData(chatID, userIDForForgetMe(message)); err == nil {
+				logInfo("deleted all data of chat(%d) on request: %d row(s)", chatID, count)
+
+				msg = fmt.Sprintf(msgForgetMeDoneFormat, count)
+			} else {
+				logError(db, "failed to delete all data of chat(%d): %s", chatID, err)
+			}
+
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			send(b, conf, db, msg, chatID, nil)
+		}
+	}
+}
+
+// return the id of the user whose own data (eg. API key) will be deleted with /forgetme (only in private chats)
+func userIDForForgetMe(message *tg.Message) int64 {
+	if message.Chat.Type == tg.ChatTypePrivate && message.From != nil {
+		return message.From.ID
+	}
+	return 0
+}
+
+// return a /stats command handler
+func statsCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "stats command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			chatID := message.Chat.ID
+			messageID := message.MessageID
+
+			var msg string
+			if db == nil {
+				msg = msgDatabaseNotConfigured
+			} else if strings.TrimSpace(args) == argStatsGraph { // chart of this chat's reminders
+				if sendStatsGraph(b, db, chatID, messageID) {
+					return
+				}
+				msg = msgStatsGraphFailed
+			} else if strings.TrimSpace(args) == argStatsFailed { // latest failed parses (for admins, for improving prompts)
+				if isAdmin(conf, update) {
+					msg = failedParsesMessage(db, chatID)
+				} else {
+					msg = msgAdminOnly
+				}
+			} else if fields := strings.Fields(args); len(fields) > 0 && fields[0] == argStatsUsers { // last interactions of users (for admins)
+				if isAdmin(conf, update) {
+					days := inactiveUserDays
+					if len(fields) > 1 {
+						if n, err := strconv.Atoi(fields[1]); err == nil && n > 0 {
+							days = n
+						} else {
+							days = 0
+						}
+					}
+
+					if days > 0 {
+						msg = userActivitiesMessage(conf, db, chatID, days)
+					} else {
+						msg = msgStatsUsersUsage
+					}
+				} else {
+					msg = msgAdminOnly
+				}
+			} else {
+				msg = db.Stats()
+
+				if setting, err := db.GetChatSetting(chatID); err == nil {
+					if setting.Paused {
+						msg += "\n\n" + msgStatsChatPaused
+					}
+				} else {
+					logError(db, "failed to get chat setting: %s", err)
+				}
+
+				// send it with a chart (or fallback to the text only)
+				if conf.StatsChart && sendStatsChart(b, db, msg, chatID, messageID) {
+					return
+				}
+			}
+
+			send(b, conf, db, msg, chatID, &messageID)
+		}
+	}
+}
+
+// send a chart of reminders created per day, with given stats as its caption, and return if it was sent successfully
+func sendStatsChart(b *tg.Bot, db *Database, stats string, chatID, messageID int64) bool {
+	counts, err := db.DailyReminderCounts(0, statsChartDays) // (of all chats)
+	if err != nil {
+		logError(db, "failed to count reminders for stats chart: %s", err)
+		return false
+	}
+
+	return sendChart(b, db, dailyCountsUntil(counts, statsChartDays, time.Now()), stats+fmt.Sprintf(msgStatsChartFormat, statsChartDays), chatID, messageID)
+}
+
+// generate a message of the latest failed parses (of all chats)
+func failedParsesMessage(db *Database, chatID int64) string {
+	prompts, err := db.RecentFailedParses(failedParsesLimit)
+	if err != nil {
+		logError(db, "failed to get failed parses: %s", err)
+		return msgError
+	}
+	if len(prompts) <= 0 {
+		return msgNoFailedParses
+	}
+
+	pref := chatDatetimePreference(db, chatID)
+	lines := []string{}
+	for _, prompt := range prompts {
+		text := msgFailedParseNotSaved
+		if prompt.Text != "" {
+			text = escapeHTML(ellipsize(prompt.Text, failedParseTextLength))
+		}
+
+		lines = append(lines, fmt.Sprintf(msgFailedParseItemFormat,
+			datetimeToStr(prompt.CreatedAt, pref),
+			escapeHTML(prompt.Result.ModelName),
+			text,
+			escapeHTML(ellipsize(prompt.Result.FailReason, failedParseTextLength)),
+		))
+	}
+
+	return fmt.Sprintf(msgFailedParsesFormat, len(prompts), strings.Join(lines, "\n"))
+}
+
+// generate a message of users' last interactions, with the number of users inactive for given days
+// (allowed users who never interacted with the bot are also listed)
+func userActivitiesMessage(conf config, db *Database, chatID int64, days int) string {
+	activities, err := db.UserActivities()
+	if err != nil {
+		logError(db, "failed to get user activities: %s", err)
+		return msgError
+	}
+
+	pref := chatDatetimePreference(db, chatID)
+	inactiveSince := time.Now().AddDate(0, 0, -days)
+
+	lines := []string{}
+	usernames := []string{}
+	inactive := 0
+	for _, activity := range activities {
+		name := activity.FirstName
+		if activity.Username != "" {
+			name = fmt.Sprintf("@%s (%s)", activity.Username, activity.FirstName)
+			usernames = append(usernames, activity.Username)
+		}
+		if activity.LastSeenOn.Before(inactiveSince) {
+			inactive++
+		}
+
+		lines = append(lines, fmt.Sprintf(msgUserActivityItemFormat, escapeHTML(name), datetimeToStr(activity.LastSeenOn, pref)))
+	}
+	for _, username := range conf.AllowedTelegramUsers {
+		if !slices.Contains(usernames, username) {
+			inactive++
+
+			lines = append(lines, fmt.Sprintf(msgUserActivityItemFormat, escapeHTML("@"+username), msgUserActivityNever))
+		}
+	}
+
+	if len(lines) <= 0 {
+		return msgNoUserActivities
+	}
+
+	return fmt.Sprintf(msgUserActivitiesFormat, len(lines), strings.Join(lines, "\n"), days, inactive)
+}
+
+// collapse consecutive spaces in each line of given string, keeping its line breaks
+func collapseSpaces(str string) string {
+	lines := strings.Split(str, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// get the first line of given (multi-line) string, cut to the maximum length (in characters),
+// with an ellipsis if anything was left out (eg. "buy milk\nand eggs" => "buy milk …")
+func firstLine(str string, length int) string {
+	line, rest, multiline := strings.Cut(strings.TrimSpace(str), "\n")
+	line = strings.TrimSpace(line)
+
+	if runes := []rune(line); len(runes) > length {
+		return string(runes[:length]) + "…"
+	}
+	if multiline && strings.TrimSpace(rest) != "" {
+		return line + " …"
+	}
+
+	return line
+}
+
+// cut given string to the maximum length (in characters), with an ellipsis
+func ellipsize(str string, length int) string {
+	if runes := []rune(str); len(runes) > length {
+		return string(runes[:length]) + "…"
+	}
+
+	return str
+}
+
+// send a chart of given chat's reminders created per day, and return if it was sent successfully
+func sendStatsGraph(b *tg.Bot, db *Database, chatID, messageID int64) bool {
+	counts, err := db.DailyReminderCounts(chatID, statsChartDays)
+	if err != nil {
+		logError(db, "failed to count reminders for stats graph: %s", err)
+		return false
+	}
+
+	values := dailyCountsUntil(counts, statsChartDays, time.Now())
+
+	var total int64
+	for _, value := range values {
+		total += value
+	}
+
+	return sendChart(b, db, values, fmt.Sprintf(msgStatsGraphFormat, statsChartDays, total), chatID, messageID)
+}
+
+// send a bar chart of given values with given caption, and return if it was sent successfully
+func sendChart(b *tg.Bot, db *Database, values []int64, caption string, chatID, messageID int64) bool {
+	img, err := renderBarChart(values)
+	if err != nil {
+		logError(db, "failed to render chart: %s", err)
+		return false
+	}
+
+	if len([]rune(caption)) > maxCaptionLength {
+		return false
+	}
+
+	options := tg.OptionsSendPhoto{}.
+		SetCaption(caption).
+		SetParseMode(tg.ParseModeHTML).
+		SetReplyParameters(tg.NewReplyParameters(messageID)).
+		SetReplyMarkup(defaultReplyMarkup())
+	if sent := b.SendPhoto(chatID, tg.NewInputFileFromBytes(img), options); !sent.Ok {
+		logError(db, "failed to send chart: %s", *sent.Description)
+		return false
+	}
+
+	return true
+}
+
+// return a /pause command handler
+func pauseCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return pauseOrResumeCommandHandler(conf, db, true)
+}
+
+// return a /resume command handler
+func resumeCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return pauseOrResumeCommandHandler(conf, db, false)
+}
+
+// return a /pause or /resume command handler
+func pauseOrResumeCommandHandler(conf config, db *Database, pause bool) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "pause/resume command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			chatID := message.Chat.ID
+			messageID := message.MessageID
+
+			var msg string
+			if _, err := db.UpdateChatSetting(chatID, "paused", pause); err == nil {
+				if pause {
+					msg = msgPaused
+				} else {
+					msg = msgResumed
+				}
+			} else {
+				logError(db, "failed to update paused state of chat %d: %s", chatID, err)
+
+				msg = msgError
+			}
+
+			send(b, conf, db, msg, chatID, &messageID)
+		}
+	}
+}
+
+// return a /snooze command handler
+func snoozeCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "snooze command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			chatID := message.Chat.ID
+			messageID := message.MessageID
+
+			var msg string
+			args = strings.TrimSpace(args)
+			if args == "" { // show current presets
+				if setting, err := db.GetChatSetting(chatID); err == nil {
+					msg = fmt.Sprintf(msgSnoozePresetsFormat, escapeHTML(strings.Join(snoozePresetsOf(setting), ", ")))
+				} else {
+					logError(db, "failed to get chat setting: %s", err)
+				}
+			} else { // save (or reset) presets
+				var presets []string
+				var err error
+				if args == argSnoozeReset {
+					presets = strings.Split(defaultSnoozePresets, ",")
+					args = ""
+				} else if presets, err = parseSnoozePresets(args); err == nil {
+					args = strings.Join(presets, ",")
+				}
+
+				if err == nil {
+					if _, err := db.UpdateChatSetting(chatID, "snooze_presets", args); err == nil {
+						msg = fmt.Sprintf(msgSnoozePresetsSavedFormat, escapeHTML(strings.Join(presets, ", ")))
+					} else {
+						logError(db, "failed to save snooze presets: %s", err)
+					}
+				} else {
+					msg = fmt.Sprintf(msgSnoozePresetsInvalidFormat, escapeHTML(err.Error()))
+				}
+			}
+
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			send(b, conf, db, msg, chatID, &messageID)
+		}
+	}
+}
+
+// return an /undated command handler
+func undatedCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "undated command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
 
-		// token counts
-		numTokensInput, numTokensOutput = generated.UsageMetadata.PromptTokenCount, generated.UsageMetadata.CandidatesTokenCount
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+			options := tg.OptionsSendMessage{}.
+				SetReplyMarkup(defaultReplyMarkup())
 
-		if len(generated.Candidates) <= 0 {
-			logError(db, "there was no returned candidate")
-		} else {
-			for _, candidate := range generated.Candidates {
-				content := candidate.Content
+			// `/undated [queue id] [preset]` for scheduling directly
+			if queueID, preset, found := strings.Cut(strings.TrimSpace(args), " "); found {
+				if id, err := strconv.ParseInt(queueID, 10, 64); err == nil {
+					msg = scheduleUndated(db, chatID, id, preset)
+				} else {
+					logError(db, "failed to convert queue id: %s", err)
+				}
+			} else if reminders, err := db.UndatedQueueItems(chatID); err == nil {
+				if len(reminders) > 0 {
+					// inline keyboards
+					keys := make(map[string]string)
+					for _, r := range reminders {
+						keys[r.Message] = fmt.Sprintf("%s %d", cmdUndated, r.ID)
+					}
+					buttons := tg.NewInlineKeyboardButtonsAsRowsWithCallbackData(keys)
 
-				if len(content.Parts) > 0 {
-					for _, part := range content.Parts {
-						if fnCall, ok := part.(genai.FunctionCall); ok { // if it is a function call,
-							if handled, err := handleFnCall(conf, fnCall); err == nil {
-								// append result
-								result = append(result, handled...)
-							} else {
-								errs = append(errs, err)
+					// add a cancel button
+					buttons = append(buttons, []tg.InlineKeyboardButton{
+						tg.NewInlineKeyboardButton(msgCancel).
+							SetCallbackData(cmdCancel),
+					})
 
-								logError(db, "failed to handle function call: %s", err)
-							}
-							break
+					// options
+					options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(buttons))
+
+					msg = msgScheduleWhat
+				} else {
+					msg = msgNoUndatedReminders
+				}
+			} else {
+				logError(db, "failed to process %s: %s", cmdUndated, err)
+			}
+
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			if sent := b.SendMessage(chatID, msg, options); !sent.Ok {
+				logError(db, "failed to send message: %s", *sent.Description)
+			}
+		}
+	}
+}
+
+// return a /milestones command handler
+func milestonesCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "milestones command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+			options := tg.OptionsSendMessage{}.
+				SetReplyMarkup(defaultReplyMarkup()).
+				SetParseMode(tg.ParseModeHTML)
+
+			args = strings.TrimSpace(args)
+			if args == "" {
+				msg = msgMilestonesUsage
+			} else if offsets, err := parseMilestones(args); err == nil {
+				if reminders, err := db.UndeliveredQueueItems(chatID); err == nil {
+					if len(reminders) > 0 {
+						// inline keyboards
+						keys := make(map[string]string)
+						pref := chatDatetimePreference(db, chatID)
+						for _, r := range reminders {
+							keys[fmt.Sprintf(msgListItemFormat, datetimeToStr(r.FireOn, pref), firstLine(r.Message, listItemMessageLength))] = fmt.Sprintf("%s %d/%s", cmdMilestones, r.ID, milestonesToParam(offsets))
 						}
+						buttons := tg.NewInlineKeyboardButtonsAsRowsWithCallbackData(keys)
+
+						// add a cancel button
+						buttons = append(buttons, []tg.InlineKeyboardButton{
+							tg.NewInlineKeyboardButton(msgCancel).
+								SetCallbackData(cmdCancel),
+						})
+
+						// options
+						options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(buttons))
+
+						msg = msgMilestonesWhat
+					} else {
+						msg = msgNoReminders
 					}
 				} else {
-					errs = append(errs, fmt.Errorf("no part in content"))
-
-					logError(db, "there was no part in the returned content")
+					logError(db, "failed to process %s: %s", cmdMilestones, err)
 				}
+			} else {
+				msg = fmt.Sprintf(msgMilestonesInvalidFormat, escapeHTML(err.Error()))
 			}
 
-			if len(result) <= 0 {
-				errs = append(errs, fmt.Errorf("no function call in parts"))
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			if sent := b.SendMessage(chatID, msg, options); !sent.Ok {
+				logError(db, "failed to send message: %s", *sent.Description)
+			}
+		}
+	}
+}
 
-				logError(db, "there was no usable function call in the returned parts")
+// return a /escalate command handler
+func escalateCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "escalate command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+			options := tg.OptionsSendMessage{}.
+				SetReplyMarkup(defaultReplyMarkup()).
+				SetParseMode(tg.ParseModeHTML)
+
+			args = strings.ToLower(strings.TrimSpace(args))
+			if args == "" {
+				msg = msgEscalateUsage
+			} else if minutes, err := parseEscalateMinutes(args); err == nil {
+				if reminders, err := db.UndeliveredQueueItems(chatID); err == nil {
+					if len(reminders) > 0 {
+						// inline keyboards
+						keys := make(map[string]string)
+						pref := chatDatetimePreference(db, chatID)
+						for _, r := range reminders {
+							keys[fmt.Sprintf(msgListItemFormat, datetimeToStr(r.FireOn, pref), firstLine(r.Message, listItemMessageLength))] = fmt.Sprintf("%s %d/%d", cmdEscalate, r.ID, minutes)
+						}
+						buttons := tg.NewInlineKeyboardButtonsAsRowsWithCallbackData(keys)
+
+						// add a cancel button
+						buttons = append(buttons, []tg.InlineKeyboardButton{
+							tg.NewInlineKeyboardButton(msgCancel).
+								SetCallbackData(cmdCancel),
+						})
+
+						// options
+						options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(buttons))
+
+						msg = msgEscalateWhat
+					} else {
+						msg = msgNoReminders
+					}
+				} else {
+					logError(db, "failed to process %s: %s", cmdEscalate, err)
+				}
+			} else {
+				msg = fmt.Sprintf(msgEscalateInvalidFormat, escapeHTML(err.Error()))
+			}
+
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			if sent := b.SendMessage(chatID, msg, options); !sent.Ok {
+				logError(db, "failed to send message: %s", *sent.Description)
 			}
 		}
-	} else {
-		errs = append(errs, fmt.Errorf("failed to generate text: %s", errorString(err)))
+	}
+}
 
-		// log failure
-		savePromptAndResult(db, chatID, userID, username, text, int(numTokensInput), int(numTokensOutput), false)
+// parse given interval of re-notifications (eg. "30m") into minutes, 0 for "off"
+func parseEscalateMinutes(str string) (minutes int, err error) {
+	if str == argEscalateOff {
+		return 0, nil
+	}
 
-		logError(db, "failed to generate text: %s", errorString(err))
+	interval, err := parseDuration(str)
+	if err != nil {
+		return 0, err
 	}
+	if interval < minEscalationInterval {
+		return 0, fmt.Errorf("shorter than %s", durationToStr(minEscalationInterval))
+	}
+
+	return int(interval / time.Minute), nil
+}
+
+// return a /activehours command handler
+func activeHoursCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "activehours command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+			messageID := message.MessageID
+
+			args = strings.ToLower(strings.ReplaceAll(args, " ", ""))
+			if args == "" { // show
+				hours := msgActiveHoursAny
+				if h := chatActiveHours(db, chatID); h != nil {
+					hours = h.String()
+				}
+				msg = fmt.Sprintf(msgActiveHoursFormat, hours)
+			} else if args == argActiveHoursReset { // reset
+				if _, err := db.UpdateChatSetting(chatID, "active_hours", ""); err == nil {
+					msg = msgActiveHoursReset
+				} else {
+					logError(db, "failed to reset active hours: %s", err)
+				}
+			} else if hours, err := parseActiveHours(args); err == nil { // set
+				if _, err := db.UpdateChatSetting(chatID, "active_hours", hours.String()); err == nil {
+					msg = fmt.Sprintf(msgActiveHoursSavedFormat, hours)
+				} else {
+					logError(db, "failed to save active hours: %s", err)
+				}
+			} else {
+				msg = fmt.Sprintf(msgActiveHoursInvalidFormat, escapeHTML(err.Error()))
+			}
 
-	// log success
-	if len(errs) <= 0 {
-		savePromptAndResult(db, chatID, userID, username, text, int(numTokensInput), int(numTokensOutput), true)
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			send(b, conf, db, msg, chatID, &messageID)
+		}
 	}
+}
 
-	return result, errs
+// return a /cron command handler
+func cronCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "cron command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+			messageID := message.MessageID
+
+			// "m h dom mon dow message"
+			fields := strings.Fields(args)
+			if len(fields) <= len(_cronFields) {
+				msg = msgCronUsage
+			} else {
+				expr := strings.Join(fields[:len(_cronFields)], " ")
+				what := strings.Join(fields[len(_cronFields):], " ")
+
+				if reachedActiveRemindersLimit(conf, db, update, chatID) {
+					msg = fmt.Sprintf(msgTooManyRemindersFormat, conf.MaxActiveRemindersPerChat)
+				} else if when, err := nextCronTime(expr, time.Now().In(chatLocation(db, chatID))); err == nil {
+					if _, err := db.EnqueueItem(QueueItem{
+						ChatID:          chatID,
+						MessageID:       messageID,
+						MessageThreadID: threadIDOf(*message),
+						Message:         what,
+						FireOn:          when,
+						Recurrence:      expr,
+						Source:          sourceCommand,
+						CreatedBy:       userIDOf(*message),
+					}); err == nil {
+						msg = fmt.Sprintf(msgCronResponseFormat, escapeHTML(what), datetimeToStr(when, chatDatetimePreference(db, chatID)), escapeHTML(expr))
+					} else {
+						msg = fmt.Sprintf(msgSaveFailedFormat, escapeHTML(what), escapeHTML(err.Error()))
+					}
+				} else {
+					msg = fmt.Sprintf(msgCronInvalidFormat, escapeHTML(err.Error()))
+				}
+			}
+
+			send(b, conf, db, msg, chatID, &messageID)
+		}
+	}
 }
 
-// filter parsed items to be all valid
-func filterParsed(conf config, parsed []parsedItem) (filtered []parsedItem) {
-	// add some generated items for convenience
-	generated := []parsedItem{}
-	for _, p := range parsed {
-		// save it as it is,
-		generated = append(generated, p)
+// return a /ical command handler
+func icalCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "ical command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
 
-		// and add generated ones,
-		when := p.When.In(_location)
-		hour, minute := when.Hour(), when.Minute()
-		if hour == 0 && minute == 0 {
-			// default hour
-			generated = append(generated, parsedItem{
-				Message:   p.Message,
-				When:      p.When.In(_location).Add(time.Hour * time.Duration(conf.DefaultHour)),
-				Generated: true,
-			})
-		} else if hour < 12 {
-			// add 12 hours if it is AM
-			generated = append(generated, parsedItem{
-				Message:   p.Message,
-				When:      p.When.In(_location).Add(time.Hour * 12),
-				Generated: true,
-			})
+		if message := messageFromUpdate(update); message != nil {
+			chatID := message.Chat.ID
+			messageID := message.MessageID
+
+			// url of the chat's feed
+			if fields := strings.Fields(args); len(fields) > 0 && fields[0] == argICalFeed {
+				send(b, conf, db, icalFeedMessage(conf, db, chatID, len(fields) > 1 && fields[1] == argICalFeedReset), chatID, &messageID)
+				return
+			}
+
+			if reminders, err := db.UndeliveredQueueItems(chatID); err == nil {
+				if len(reminders) <= 0 {
+					send(b, conf, db, msgNoReminders, chatID, &messageID)
+					return
+				}
+
+				if err := sendICalendar(b, reminders, chatLocation(db, chatID), chatID, messageID); err != nil {
+					logError(db, "failed to send iCalendar: %s", err)
+
+					send(b, conf, db, msgICalFailed, chatID, &messageID)
+				}
+			} else {
+				logError(db, "failed to process %s: %s", cmdICal, err)
+
+				send(b, conf, db, msgError, chatID, &messageID)
+			}
 		}
 	}
+}
 
-	// remove already-passed or duplicated ones
-	filtered = []parsedItem{}
-	duplicated := map[string]bool{}
-	now := time.Now()
-	for _, p := range generated {
-		when := p.When.In(_location)
+// generate a message with the url of given chat's iCalendar feed, (re)generating its token if needed
+func icalFeedMessage(conf config, db *Database, chatID int64, reset bool) string {
+	if conf.ICalFeed == nil {
+		return msgICalFeedDisabled
+	}
+
+	setting, err := db.GetChatSetting(chatID)
+	if err != nil {
+		logError(db, "failed to get chat setting: %s", err)
+		return msgError
+	}
+
+	token := setting.ICalToken
+	if token == "" || reset {
+		if token, err = newICalFeedToken(); err != nil {
+			logError(db, "failed to generate token of iCalendar feed: %s", err)
+			return msgError
+		}
+		if _, err := db.UpdateChatSetting(chatID, "ical_token", token); err != nil {
+			logError(db, "failed to save token of iCalendar feed: %s", err)
+			return msgError
+		}
+	}
+
+	return fmt.Sprintf(msgICalFeedFormat, escapeHTML(icalFeedURL(*conf.ICalFeed, token)))
+}
+
+// send given reminders as an iCalendar file
+func sendICalendar(b *tg.Bot, reminders []QueueItem, loc *time.Location, chatID, messageID int64) error {
+	// (save it as a file, for sending it with its filename)
+	dir, err := os.MkdirTemp("", "ical")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, icsFilename)
+	if err := os.WriteFile(path, generateICalendar(reminders, loc, time.Now()), 0o600); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	options := tg.OptionsSendDocument{}.
+		SetCaption(fmt.Sprintf(msgICalCaptionFormat, len(reminders), loc)).
+		SetReplyParameters(tg.NewReplyParameters(messageID)).
+		SetReplyMarkup(defaultReplyMarkup())
+	if sent := b.SendDocument(chatID, tg.NewInputFileFromFilepath(path), options); !sent.Ok {
+		return fmt.Errorf("failed to send document: %s", *sent.Description)
+	}
+
+	return nil
+}
+
+// return a /test command handler
+func testCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "test command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
 
-		// remove duplicated ones,
-		dup := when.Format(datetimeFormat)
-		if _, exists := duplicated[dup]; exists {
-			continue
-		} else {
-			duplicated[dup] = true // mark as duplicated,
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+			messageID := message.MessageID
 
-			// and remove already-passed ones
-			if when.After(now) {
-				filtered = append(filtered, p)
+			when := time.Now().Add(testReminderDelay)
+			if _, err := db.EnqueueItem(QueueItem{
+				ChatID:          chatID,
+				MessageID:       messageID,
+				MessageThreadID: threadIDOf(*message),
+				Message:         msgTestReminder,
+				FireOn:          when,
+				Source:          sourceCommand,
+				CreatedBy:       userIDOf(*message),
+			}); err == nil {
+				msg = fmt.Sprintf(msgTestScheduledFormat, datetimeToStr(when, chatDatetimePreference(db, chatID)), conf.MonitorIntervalSeconds)
+
+				// (paused ones will not be delivered until resumed)
+				if setting, err := db.GetChatSetting(chatID); err == nil && setting.Paused {
+					msg += "\n\n" + msgPaused
+				}
+			} else {
+				msg = fmt.Sprintf(msgSaveFailedFormat, msgTestReminder, escapeHTML(err.Error()))
 			}
+
+			send(b, conf, db, msg, chatID, &messageID)
 		}
 	}
-
-	return filtered
 }
 
-// generate user's name
-func userName(user *tg.User) string {
-	if user.Username != nil {
-		return fmt.Sprintf("@%s (%s)", *user.Username, user.FirstName)
-	} else {
-		return user.FirstName
+// return a /timezone command handler
+func timezoneCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "timezone command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+			messageID := message.MessageID
+
+			args = strings.TrimSpace(args)
+			if args == "" { // show
+				msg = fmt.Sprintf(msgTimezoneFormat, chatLocation(db, chatID))
+			} else if args == argTimezoneReset { // reset
+				if _, err := db.UpdateChatSetting(chatID, "timezone", ""); err == nil {
+					msg = fmt.Sprintf(msgTimezoneSavedFormat, _location)
+				} else {
+					logError(db, "failed to reset timezone: %s", err)
+				}
+			} else { // set
+				msg = escapeHTML(setTimezone(db, chatID, args))
+			}
+
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			send(b, conf, db, msg, chatID, &messageID)
+		}
 	}
 }
 
-// generate user's name from update
-func userNameFromUpdate(update tg.Update) string {
-	if user := update.GetFrom(); user != nil {
-		return userName(user)
-	}
+// return a /email command handler
+func emailCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "email command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
 
-	logInfo("there was no `from` in `update`")
+		if message := messageFromUpdate(update); message != nil {
+			var msg string
+			chatID := message.Chat.ID
+			messageID := message.MessageID
 
-	return "unknown"
-}
+			args = strings.TrimSpace(args)
+			if conf.SMTP == nil {
+				msg = msgEmailNotConfigured
+			} else if args == "" { // show
+				if setting, err := db.GetChatSetting(chatID); err == nil {
+					email := msgEmailNotSet
+					if setting.Email != "" {
+						email = escapeHTML(setting.Email)
+					}
+					msg = fmt.Sprintf(msgEmailFormat, email)
+				} else {
+					logError(db, "failed to get chat setting: %s", err)
+				}
+			} else if args == argEmailReset { // reset
+				if _, err := db.UpdateChatSetting(chatID, "email", ""); err == nil {
+					msg = msgEmailReset
+				} else {
+					logError(db, "failed to reset email: %s", err)
+				}
+			} else if isValidEmail(args) { // set
+				if _, err := db.UpdateChatSetting(chatID, "email", args); err == nil {
+					msg = fmt.Sprintf(msgEmailSavedFormat, escapeHTML(args))
+				} else {
+					logError(db, "failed to save email: %s", err)
+				}
+			} else {
+				msg = fmt.Sprintf(msgEmailInvalidFormat, escapeHTML(args))
+			}
 
-// save prompt and its result to logs database
-func savePromptAndResult(db *Database, chatID, userID int64, username string, prompt string, promptTokens int, resultTokens int, resultSuccessful bool) {
-	if db != nil {
-		if err := db.SavePrompt(Prompt{
-			ChatID:   chatID,
-			UserID:   userID,
-			Username: username,
-			Text:     prompt,
-			Tokens:   promptTokens,
-			Result: ParsedItem{
-				Successful: resultSuccessful,
-				Tokens:     resultTokens,
-			},
-		}); err != nil {
-			log.Printf("failed to save prompt & result to database: %s", err)
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			send(b, conf, db, msg, chatID, &messageID)
 		}
 	}
 }
 
-// generate a help message with version info
-func helpMessage(conf config) string {
-	return fmt.Sprintf(msgHelp, conf.GoogleGenerativeModel, version.Build(version.OS|version.Architecture|version.Revision), githubPageURL)
-}
-
-// return a /start command handler
-func startCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
-	return func(b *tg.Bot, update tg.Update, _ string) {
+// return a /channels command handler
+func channelsCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
 		if !isAllowed(conf, update) {
-			log.Printf("start command not allowed: %s", userNameFromUpdate(update))
+			logInfoForUpdate(update, "channels command not allowed: %s", userNameFromUpdate(update))
 			return
 		}
 
 		if message := messageFromUpdate(update); message != nil {
+			var msg string
 			chatID := message.Chat.ID
+			messageID := message.MessageID
+
+			args = strings.TrimSpace(args)
+			if args == "" { // show
+				if setting, err := db.GetChatSetting(chatID); err == nil {
+					channels := msgChannelsNotSet
+					if current := channelsOf(setting); len(current) > 0 {
+						channels = strings.Join(current, ", ")
+					}
+					msg = fmt.Sprintf(msgChannelsFormat, channels)
+				} else {
+					logError(db, "failed to get chat setting: %s", err)
+				}
+			} else if args == argChannelsNone { // reset
+				if _, err := db.UpdateChatSetting(chatID, "channels", ""); err == nil {
+					msg = msgChannelsReset
+				} else {
+					logError(db, "failed to reset channels: %s", err)
+				}
+			} else if channels, err := parseChannels(args); err == nil { // set
+				if _, err := db.UpdateChatSetting(chatID, "channels", strings.Join(channels, ",")); err == nil {
+					msg = fmt.Sprintf(msgChannelsSavedFormat, strings.Join(channels, ", "))
+				} else {
+					logError(db, "failed to save channels: %s", err)
+				}
+			} else {
+				msg = fmt.Sprintf(msgChannelsInvalidFormat, escapeHTML(err.Error()), strings.Join(_notificationChannelNames, ", "))
+			}
 
-			send(b, conf, db, msgStart, chatID, nil)
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			send(b, conf, db, msg, chatID, &messageID)
 		}
 	}
 }
 
-// return a /list command handler
-func listRemindersCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+// return a /webhook command handler
+func webhookCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
 	return func(b *tg.Bot, update tg.Update, args string) {
 		if !isAllowed(conf, update) {
-			log.Printf("start command not allowed: %s", userNameFromUpdate(update))
+			logInfoForUpdate(update, "webhook command not allowed: %s", userNameFromUpdate(update))
 			return
 		}
 
 		if message := messageFromUpdate(update); message != nil {
 			var msg string
 			chatID := message.Chat.ID
+			messageID := message.MessageID
 
-			if reminders, err := db.UndeliveredQueueItems(chatID); err == nil {
-				if len(reminders) > 0 {
-					format := fmt.Sprintf("%s\n", msgListItemFormat)
-					for _, r := range reminders {
-						msg += fmt.Sprintf(format, datetimeToStr(r.FireOn), r.Message)
+			args = strings.TrimSpace(args)
+			if args == "" { // show
+				if setting, err := db.GetChatSetting(chatID); err == nil {
+					webhookURL := msgWebhookNotSet
+					if setting.WebhookURL != "" {
+						webhookURL = escapeHTML(setting.WebhookURL)
 					}
+					msg = fmt.Sprintf(msgWebhookFormat, webhookURL)
 				} else {
-					msg = msgNoReminders
+					logError(db, "failed to get chat setting: %s", err)
+				}
+			} else if args == argWebhookReset { // reset
+				if _, err := db.UpdateChatSetting(chatID, "webhook_url", ""); err == nil {
+					msg = msgWebhookReset
+				} else {
+					logError(db, "failed to reset webhook url: %s", err)
+				}
+			} else if isValidWebhookURL(args) { // set
+				if _, err := db.UpdateChatSetting(chatID, "webhook_url", args); err == nil {
+					msg = fmt.Sprintf(msgWebhookSavedFormat, escapeHTML(args))
+				} else {
+					logError(db, "failed to save webhook url: %s", err)
 				}
 			} else {
-				logError(db, "failed to process %s: %s", cmdListReminders, err)
+				msg = fmt.Sprintf(msgWebhookInvalidFormat, escapeHTML(args))
 			}
 
 			// send message
 			if len(msg) <= 0 {
 				msg = msgError
 			}
-			send(b, conf, db, msg, chatID, nil)
+			send(b, conf, db, msg, chatID, &messageID)
 		}
 	}
 }
 
-// return a /cancel command handler
-func cancelCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+// return a /datetime command handler
+func datetimeCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
 	return func(b *tg.Bot, update tg.Update, args string) {
 		if !isAllowed(conf, update) {
-			log.Printf("start command not allowed: %s", userNameFromUpdate(update))
+			logInfoForUpdate(update, "datetime command not allowed: %s", userNameFromUpdate(update))
 			return
 		}
 
@@ -904,32 +5741,34 @@ func cancelCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.U
 			var msg string
 			chatID := message.Chat.ID
 			options := tg.OptionsSendMessage{}.
-				SetReplyMarkup(defaultReplyMarkup())
-
-			if reminders, err := db.UndeliveredQueueItems(chatID); err == nil {
-				if len(reminders) > 0 {
-					// inline keyboards
-					keys := make(map[string]string)
-					for _, r := range reminders {
-						keys[fmt.Sprintf(msgListItemFormat, datetimeToStr(r.FireOn), r.Message)] = fmt.Sprintf("%s %d", cmdCancel, r.ID)
-					}
-					buttons := tg.NewInlineKeyboardButtonsAsRowsWithCallbackData(keys)
+				SetReplyMarkup(defaultReplyMarkup()).
+				SetReplyParameters(tg.NewReplyParameters(message.MessageID)).
+				SetParseMode(tg.ParseModeHTML)
+
+			args = strings.TrimSpace(args)
+			if args == "" { // show (with buttons for selecting one)
+				name := _datetimeFormats[0].name
+				if setting, err := db.GetChatSetting(chatID); err == nil && setting.DatetimeFormat != "" {
+					name = setting.DatetimeFormat
+				}
+				msg = fmt.Sprintf(msgDatetimeFormatFormat, name, datetimeToStr(time.Now(), chatDatetimePreference(db, chatID)))
 
-					// add a cancel button for canceling reminder
+				buttons := [][]tg.InlineKeyboardButton{}
+				for _, format := range _datetimeFormats {
 					buttons = append(buttons, []tg.InlineKeyboardButton{
-						tg.NewInlineKeyboardButton(msgCancel).
-							SetCallbackData(cmdCancel),
+						tg.NewInlineKeyboardButton(fmt.Sprintf("%s (%s)", format.name, time.Now().In(chatLocation(db, chatID)).Format(format.layout))).
+							SetCallbackData(fmt.Sprintf("%s %s", cmdDatetime, format.name)),
 					})
-
-					// options
-					options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(buttons))
-
-					msg = msgCancelWhat
-				} else {
-					msg = msgNoReminders
 				}
-			} else {
-				logError(db, "failed to process %s: %s", cmdCancel, err)
+				buttons = append(buttons, []tg.InlineKeyboardButton{
+					tg.NewInlineKeyboardButton(msgCancel).
+						SetCallbackData(cmdCancel),
+				})
+				options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(buttons))
+			} else if args == argDatetimeReset { // reset
+				msg = setDatetimeFormat(db, chatID, _datetimeFormats[0].name)
+			} else { // set
+				msg = escapeHTML(setDatetimeFormat(db, chatID, args))
 			}
 
 			// send message
@@ -943,46 +5782,213 @@ func cancelCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.U
 	}
 }
 
-// return a /privacy command handler
-func privacyCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+// return a /prefix command handler
+func prefixCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
 	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "prefix command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
 		if message := messageFromUpdate(update); message != nil {
+			var msg string
 			chatID := message.Chat.ID
+			messageID := message.MessageID
 
-			send(b, conf, db, msgPrivacy, chatID, nil)
+			args = strings.TrimSpace(args)
+			if args == "" { // show
+				prefix := msgPrefixNone
+				if p := reminderPrefix(conf, db, chatID); p != "" {
+					prefix = escapeHTML(p)
+				}
+				msg = fmt.Sprintf(msgPrefixFormat, prefix)
+			} else if args == argPrefixReset { // reset (to the default one)
+				if _, err := db.UpdateChatSetting(chatID, "reminder_prefix", nil); err == nil {
+					msg = msgPrefixReset
+				} else {
+					logError(db, "failed to reset reminder prefix: %s", err)
+				}
+			} else if args == argPrefixNone { // remove
+				if _, err := db.UpdateChatSetting(chatID, "reminder_prefix", ""); err == nil {
+					msg = msgPrefixRemoved
+				} else {
+					logError(db, "failed to remove reminder prefix: %s", err)
+				}
+			} else if len([]rune(args)) > maxPrefixLength {
+				msg = fmt.Sprintf(msgPrefixTooLongFormat, maxPrefixLength)
+			} else { // set
+				if _, err := db.UpdateChatSetting(chatID, "reminder_prefix", args); err == nil {
+					msg = fmt.Sprintf(msgPrefixSavedFormat, escapeHTML(args))
+				} else {
+					logError(db, "failed to save reminder prefix: %s", err)
+				}
+			}
+
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
+			send(b, conf, db, msg, chatID, &messageID)
 		}
 	}
 }
 
-// return a /stats command handler
-func statsCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+// return a /weekstart command handler
+func weekStartCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
 	return func(b *tg.Bot, update tg.Update, args string) {
 		if !isAllowed(conf, update) {
-			log.Printf("stats command not allowed: %s", userNameFromUpdate(update))
+			logInfoForUpdate(update, "weekstart command not allowed: %s", userNameFromUpdate(update))
 			return
 		}
 
 		if message := messageFromUpdate(update); message != nil {
+			var msg string
 			chatID := message.Chat.ID
 			messageID := message.MessageID
 
-			var msg string
-			if db == nil {
-				msg = msgDatabaseNotConfigured
+			names := []string{}
+			for _, weekStart := range []time.Weekday{time.Sunday, time.Monday} {
+				names = append(names, weekStartName(weekStart))
+			}
+
+			args = strings.ToLower(strings.TrimSpace(args))
+			if args == "" { // show
+				msg = fmt.Sprintf(msgWeekStartFormat, weekStartName(chatWeekStart(db, chatID)), strings.Join(names, ", "))
+			} else if args == argWeekStartReset { // reset
+				if _, err := db.UpdateChatSetting(chatID, "week_start", ""); err == nil {
+					msg = msgWeekStartReset
+				} else {
+					logError(db, "failed to reset week start: %s", err)
+				}
+			} else if _, exists := _weekStarts[args]; exists { // set
+				if _, err := db.UpdateChatSetting(chatID, "week_start", args); err == nil {
+					msg = fmt.Sprintf(msgWeekStartSavedFormat, args)
+				} else {
+					logError(db, "failed to save week start: %s", err)
+				}
 			} else {
-				msg = db.Stats()
+				msg = fmt.Sprintf(msgWeekStartInvalidFormat, escapeHTML(args), strings.Join(names, ", "))
 			}
 
+			// send message
+			if len(msg) <= 0 {
+				msg = msgError
+			}
 			send(b, conf, db, msg, chatID, &messageID)
 		}
 	}
 }
 
+// validate and save the datetime format of given chat, and return the resulting message
+func setDatetimeFormat(db *Database, chatID int64, name string) (msg string) {
+	if _, exists := datetimeLayoutOf(name); exists {
+		if _, err := db.UpdateChatSetting(chatID, "datetime_format", name); err == nil {
+			msg = fmt.Sprintf(msgDatetimeFormatSavedFormat, name, datetimeToStr(time.Now(), chatDatetimePreference(db, chatID)))
+		} else {
+			logError(db, "failed to save datetime format: %s", err)
+		}
+	} else {
+		names := []string{}
+		for _, format := range _datetimeFormats {
+			names = append(names, format.name)
+		}
+		msg = fmt.Sprintf(msgDatetimeFormatInvalidFormat, name, strings.Join(names, ", "))
+	}
+
+	return msg
+}
+
+// validate and save the timezone of given chat, and return the resulting message
+func setTimezone(db *Database, chatID int64, zone string) (msg string) {
+	if loc, err := time.LoadLocation(zone); err == nil && zone != "" {
+		if _, err := db.UpdateChatSetting(chatID, "timezone", loc.String()); err == nil {
+			msg = fmt.Sprintf(msgTimezoneSavedFormat, loc) + finishOnboarding(db, chatID)
+		} else {
+			logError(db, "failed to save timezone: %s", err)
+		}
+	} else {
+		msg = fmt.Sprintf(msgTimezoneInvalidFormat, zone)
+	}
+
+	return msg
+}
+
+// parse comma-separated milestone offsets (eg. "1d,1h")
+func parseMilestones(str string) (offsets []time.Duration, err error) {
+	offsets = []time.Duration{}
+
+	for _, offset := range strings.Split(str, ",") {
+		if strings.TrimSpace(offset) == "" {
+			continue
+		}
+
+		if duration, err := parseDuration(offset); err == nil {
+			if !slices.Contains(offsets, duration) {
+				offsets = append(offsets, duration)
+			}
+		} else {
+			return nil, err
+		}
+	}
+	if len(offsets) <= 0 {
+		return nil, fmt.Errorf("no milestone was given")
+	}
+	if len(offsets) > maxMilestones {
+		return nil, fmt.Errorf("too many milestones (max: %d)", maxMilestones)
+	}
+
+	return offsets, nil
+}
+
+// convert milestone offsets to a callback query parameter (eg. "1d,1h" => "86400s,3600s")
+func milestonesToParam(offsets []time.Duration) string {
+	params := []string{}
+	for _, offset := range offsets {
+		params = append(params, fmt.Sprintf("%ds", int64(offset.Seconds())))
+	}
+
+	return strings.Join(params, ",")
+}
+
+// convert milestone offsets to a human-readable string
+func milestonesToStr(offsets []time.Duration) string {
+	strs := []string{}
+	for _, offset := range offsets {
+		strs = append(strs, durationToStr(offset))
+	}
+
+	return strings.Join(strs, ", ")
+}
+
+// schedule an undated reminder with given preset (eg. "1h", "tomorrow 9am"), and return the result message
+func scheduleUndated(db *Database, chatID, queueID int64, preset string) (msg string) {
+	msg = msgError
+
+	if item, err := db.GetQueueItem(chatID, queueID); err == nil {
+		if when, err := snoozeUntil(preset, time.Now()); err == nil {
+			if _, err := db.ScheduleQueueItem(chatID, queueID, when); err == nil {
+				msg = fmt.Sprintf(msgResponseFormat,
+					item.Message,
+					datetimeToStr(when, chatDatetimePreference(db, chatID)),
+				)
+			} else {
+				msg = fmt.Sprintf(msgSaveFailedFormat, item.Message, err)
+			}
+		} else {
+			logError(db, "failed to parse schedule preset: %s", err)
+		}
+	} else {
+		logError(db, "failed to get reminder: %s", err)
+	}
+
+	return msg
+}
+
 // return a /help command handler
 func helpCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
 	return func(b *tg.Bot, update tg.Update, _ string) {
 		if !isAllowed(conf, update) {
-			log.Printf("help command not allowed: %s", userNameFromUpdate(update))
+			logInfoForUpdate(update, "help command not allowed: %s", userNameFromUpdate(update))
 			return
 		}
 
@@ -999,7 +6005,9 @@ func helpCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Upd
 func noSuchCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, cmd, args string) {
 	return func(b *tg.Bot, update tg.Update, cmd, args string) {
 		if !isAllowed(conf, update) {
-			log.Printf("command not allowed: %s", userNameFromUpdate(update))
+			logInfoForUpdate(update, "command not allowed: %s", userNameFromUpdate(update))
+
+			replyUnauthorized(b, conf, db, update)
 			return
 		}
 
@@ -1007,23 +6015,109 @@ func noSuchCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.U
 			chatID := message.Chat.ID
 			messageID := message.MessageID
 
-			send(b, conf, db, fmt.Sprintf(msgCmdNotSupported, cmd), chatID, &messageID)
+			if suggested, found := suggestCommand(conf, cmd); found {
+				options := tg.OptionsSendMessage{}.
+					SetReplyParameters(tg.NewReplyParameters(messageID)).
+					SetParseMode(tg.ParseModeHTML)
+
+				// with a button for running the suggested command (with the same arguments, if they fit in the callback data)
+				if suggestableCommandHandler(suggested) != nil {
+					data := strings.TrimSpace(fmt.Sprintf("%s %s %s", cmdSuggested, suggested, args))
+					if len(data) > maxCallbackDataLength {
+						data = fmt.Sprintf("%s %s", cmdSuggested, suggested)
+					}
+					options.SetReplyMarkup(tg.NewInlineKeyboardMarkup([][]tg.InlineKeyboardButton{
+						{
+							tg.NewInlineKeyboardButton(suggested).
+								SetCallbackData(data),
+						},
+						{
+							tg.NewInlineKeyboardButton(msgCancel).
+								SetCallbackData(cmdCancel),
+						},
+					}))
+				}
+
+				if sent := b.SendMessage(chatID, fmt.Sprintf(msgCmdSuggestionFormat, escapeHTML(cmd), suggested), options); !sent.Ok {
+					logError(db, "failed to send message: %s", *sent.Description)
+				}
+			} else {
+				send(b, conf, db, fmt.Sprintf(msgCmdNotSupported, escapeHTML(cmd)), chatID, &messageID)
+			}
+		}
+	}
+}
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+var _stdout = newLogger(os.Stdout, logFormatText)
+var _stderr = newLogger(os.Stderr, logFormatText)
+
+// create a new logger which writes to `w` in given format
+func newLogger(w io.Writer, format string) *slog.Logger {
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+
+	if format == logFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// set the format of loggers (should be called only once, on startup)
+func setLogFormat(format string) {
+	_stdout = newLogger(os.Stdout, format)
+	_stderr = newLogger(os.Stderr, format)
+
+	// messages from the standard `log` package will also be formatted
+	slog.SetDefault(_stderr)
+}
+
+// log message with given level and attributes (the first `error` in `a` is also added as an attribute)
+func logWithAttrs(logger *slog.Logger, level slog.Level, attrs []any, format string, a ...any) {
+	for _, v := range a {
+		if err, ok := v.(error); ok && err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+			break
 		}
 	}
+
+	logger.Log(context.Background(), level, fmt.Sprintf(format, a...), attrs...)
 }
 
-var _stdout = log.New(os.Stdout, "", log.LstdFlags)
-var _stderr = log.New(os.Stderr, "", log.LstdFlags)
+// get log attributes (chat id and user) from given update
+func attrsFromUpdate(update tg.Update) (attrs []any) {
+	if chatID, exists := chatIDFromUpdate(update); exists {
+		attrs = append(attrs, slog.Int64("chat_id", chatID))
+	}
+	attrs = append(attrs, slog.String("user", userNameFromUpdate(update)))
+
+	return attrs
+}
 
 // log info message
 func logInfo(format string, a ...any) {
-	_stdout.Printf(format, a...)
+	logWithAttrs(_stdout, slog.LevelInfo, nil, format, a...)
+}
+
+// log info message with attributes from given update
+func logInfoForUpdate(update tg.Update, format string, a ...any) {
+	logWithAttrs(_stdout, slog.LevelInfo, attrsFromUpdate(update), format, a...)
 }
 
 // log debug message (printed to stdout only when `IsVerbose` is true)
 func logDebug(conf config, format string, a ...any) {
 	if conf.Verbose {
-		_stdout.Printf(format, a...)
+		logWithAttrs(_stdout, slog.LevelDebug, nil, format, a...)
+	}
+}
+
+// log debug message with attributes from given update (printed to stdout only when `IsVerbose` is true)
+func logDebugForUpdate(conf config, update tg.Update, format string, a ...any) {
+	if conf.Verbose {
+		logWithAttrs(_stdout, slog.LevelDebug, attrsFromUpdate(update), format, a...)
 	}
 }
 
@@ -1033,7 +6127,16 @@ func logError(db *Database, format string, a ...any) {
 		db.LogError(format, a...)
 	}
 
-	_stderr.Printf(format, a...)
+	logWithAttrs(_stderr, slog.LevelError, nil, format, a...)
+}
+
+// log error message with attributes from given update
+func logErrorForUpdate(db *Database, update tg.Update, format string, a ...any) {
+	if db != nil {
+		db.LogError(format, a...)
+	}
+
+	logWithAttrs(_stderr, slog.LevelError, attrsFromUpdate(update), format, a...)
 }
 
 // log error message and exit(1)
@@ -1042,7 +6145,8 @@ func logErrorAndDie(db *Database, format string, a ...any) {
 		db.LogError(format, a...)
 	}
 
-	_stderr.Fatalf(format, a...)
+	logWithAttrs(_stderr, slog.LevelError, nil, format, a...)
+	os.Exit(1)
 }
 
 // default reply markup
@@ -1056,9 +6160,9 @@ func defaultReplyMarkup() tg.ReplyKeyboardMarkup {
 }
 
 // generate inline keyboard buttons for multiple datetimes
-func datetimeButtonsForCallbackQuery(items []parsedItem, chatID int64, messageID int64) [][]tg.InlineKeyboardButton {
-	// datetime buttons
-	keys := make(map[string]string)
+func datetimeButtonsForCallbackQuery(items []parsedItem, chatID int64, messageID int64, pref datetimePreference) [][]tg.InlineKeyboardButton {
+	// datetime buttons (in the order of given items)
+	buttons := [][]tg.InlineKeyboardButton{}
 
 	var title, generated string
 	for _, item := range items {
@@ -1067,10 +6171,13 @@ func datetimeButtonsForCallbackQuery(items []parsedItem, chatID int64, messageID
 		} else {
 			generated = ""
 		}
-		title = fmt.Sprintf("%s%s", datetimeToStr(item.When), generated)
-		keys[title] = fmt.Sprintf("%s %d/%d/%s", cmdLoad, chatID, messageID, datetimeToStr(item.When))
+		title = fmt.Sprintf("%s%s", datetimeToStr(item.When, pref), generated)
+		buttons = append(buttons, []tg.InlineKeyboardButton{
+			tg.NewInlineKeyboardButton(title).
+				// (always in the canonical format, for parsing it back in the callback query)
+				SetCallbackData(fmt.Sprintf("%s %d/%d/%s", cmdLoad, chatID, messageID, item.When.In(_location).Format(datetimeFormat))),
+		})
 	}
-	buttons := tg.NewInlineKeyboardButtonsAsRowsWithCallbackData(keys)
 
 	// add cancel button
 	buttons = append(buttons, []tg.InlineKeyboardButton{
@@ -1081,12 +6188,410 @@ func datetimeButtonsForCallbackQuery(items []parsedItem, chatID int64, messageID
 	return buttons
 }
 
-// format given time to string
-func datetimeToStr(t time.Time) string {
-	return t.In(_location).Format(datetimeFormat)
+// generate inline keyboard buttons for confirming (or changing) the time of given item, before saving it
+func confirmButtonsForCallbackQuery(item parsedItem, chatID int64, messageID int64) [][]tg.InlineKeyboardButton {
+	return [][]tg.InlineKeyboardButton{
+		{
+			tg.NewInlineKeyboardButton(msgConfirm).
+				// (same as selecting one of the datetime buttons)
+				SetCallbackData(fmt.Sprintf("%s %d/%d/%s", cmdLoad, chatID, messageID, item.When.In(_location).Format(datetimeFormat))),
+			tg.NewInlineKeyboardButton(msgChangeTime).
+				SetCallbackData(fmt.Sprintf("%s %d/%d", cmdChangeTime, chatID, messageID)),
+		},
+		{
+			tg.NewInlineKeyboardButton(msgCancel).
+				SetCallbackData(cmdCancel),
+		},
+	}
+}
+
+// generate inline keyboard buttons of a delivered reminder (snooze and feedback)
+func deliveredButtonsForCallbackQuery(db *Database, q QueueItem) [][]tg.InlineKeyboardButton {
+	buttons := [][]tg.InlineKeyboardButton{}
+	if setting, err := db.GetChatSetting(q.ChatID); err == nil {
+		buttons = append(buttons, snoozeButtonsForCallbackQuery(q.ID, snoozePresetsOf(setting))...)
+	} else {
+		logError(db, "failed to get chat setting: %s", err)
+	}
+
+	if q.EscalateMinutes > 0 {
+		buttons = append(buttons, acknowledgeButtonsForCallbackQuery(q.ID)...)
+	}
+
+	return append(buttons, feedbackButtonsForCallbackQuery(q.ID)...)
+}
+
+// generate inline keyboard buttons for acknowledging a delivered (escalated) reminder
+func acknowledgeButtonsForCallbackQuery(queueID int64) [][]tg.InlineKeyboardButton {
+	return [][]tg.InlineKeyboardButton{
+		{
+			tg.NewInlineKeyboardButton(msgAcknowledge).
+				SetCallbackData(fmt.Sprintf("%s %d", cmdAcknowledge, queueID)),
+		},
+	}
+}
+
+// generate inline keyboard buttons for undoing a snooze of a delivered reminder
+func undoSnoozeButtonsForCallbackQuery(snoozedID, originalID int64) [][]tg.InlineKeyboardButton {
+	return [][]tg.InlineKeyboardButton{
+		{
+			tg.NewInlineKeyboardButton(msgUndoSnooze).
+				SetCallbackData(fmt.Sprintf("%s %d/%d", cmdUnsnooze, snoozedID, originalID)),
+		},
+	}
+}
+
+// generate inline keyboard buttons for snoozing a delivered reminder
+func snoozeButtonsForCallbackQuery(queueID int64, presets []string) [][]tg.InlineKeyboardButton {
+	buttons := []tg.InlineKeyboardButton{}
+	for _, preset := range presets {
+		buttons = append(buttons, tg.NewInlineKeyboardButton(preset).
+			SetCallbackData(fmt.Sprintf("%s %d/%s", cmdSnooze, queueID, preset)))
+	}
+
+	return [][]tg.InlineKeyboardButton{buttons}
+}
+
+// generate inline keyboard buttons for feedback on a delivered reminder
+func feedbackButtonsForCallbackQuery(queueID int64) [][]tg.InlineKeyboardButton {
+	return [][]tg.InlineKeyboardButton{
+		{
+			tg.NewInlineKeyboardButton(msgHelpful).
+				SetCallbackData(fmt.Sprintf("%s %d/%s", cmdFeedback, queueID, argHelpful)),
+			tg.NewInlineKeyboardButton(msgNotHelpful).
+				SetCallbackData(fmt.Sprintf("%s %d/%s", cmdFeedback, queueID, argNotHelpful)),
+		},
+	}
+}
+
+// generate inline keyboard buttons for fixing the time of a reminder
+func fixTimeButtonsForCallbackQuery(queueID int64) [][]tg.InlineKeyboardButton {
+	return [][]tg.InlineKeyboardButton{
+		{
+			tg.NewInlineKeyboardButton(msgWrongTime).
+				SetCallbackData(fmt.Sprintf("%s %d", cmdFixTime, queueID)),
+		},
+	}
+}
+
+// generate inline keyboard buttons for scheduling an undated reminder
+func scheduleButtonsForCallbackQuery(queueID int64, presets []string) [][]tg.InlineKeyboardButton {
+	buttons := []tg.InlineKeyboardButton{}
+	for _, preset := range presets {
+		buttons = append(buttons, tg.NewInlineKeyboardButton(preset).
+			SetCallbackData(fmt.Sprintf("%s %d/%s", cmdSchedule, queueID, preset)))
+	}
+
+	return [][]tg.InlineKeyboardButton{buttons}
+}
+
+// get snooze presets of given chat setting, or the default ones
+func snoozePresetsOf(setting ChatSetting) []string {
+	if presets, err := parseSnoozePresets(setting.SnoozePresets); err == nil && len(presets) > 0 {
+		return presets
+	}
+
+	return strings.Split(defaultSnoozePresets, ",")
+}
+
+// parse and validate comma-separated snooze presets
+func parseSnoozePresets(str string) (presets []string, err error) {
+	presets = []string{}
+
+	for _, preset := range strings.Split(str, ",") {
+		preset = strings.ToLower(strings.Join(strings.Fields(preset), " "))
+		if preset == "" {
+			continue
+		}
+
+		if _, err := snoozeUntil(preset, time.Now()); err != nil {
+			return nil, err
+		}
+
+		presets = append(presets, preset)
+	}
+
+	if len(presets) > maxSnoozePresets {
+		return nil, fmt.Errorf("too many presets (max: %d)", maxSnoozePresets)
+	}
+
+	return presets, nil
+}
+
+// enqueue given (delivered) reminder again, to be fired at given time (snoozed by given user)
+func enqueueSnoozed(db *Database, item QueueItem, when time.Time, createdBy int64) (int64, error) {
+	return db.EnqueueItem(QueueItem{
+		ChatID:          item.ChatID,
+		MessageID:       item.MessageID,
+		MessageThreadID: item.MessageThreadID,
+		Message:         item.Message,
+		FireOn:          when,
+		Silent:          item.Silent,
+		Source:          sourceSnooze,
+		CreatedBy:       createdBy,
+	})
+}
+
+// handle given message if it is a snooze request (eg. "snooze 30m", "remind again tomorrow 9am") replied to a delivered reminder,
+// and return true if it was handled
+func handleSnoozeReply(bot *tg.Bot, conf config, db *Database, message tg.Message) bool {
+	replied := message.ReplyToMessage
+	if replied == nil || replied.From == nil || !replied.From.IsBot || !message.HasText() {
+		return false
+	}
+
+	preset, found := snoozeReplyPreset(*message.Text)
+	if !found {
+		return false
+	}
+
+	chatID := message.Chat.ID
+	item, err := db.GetDeliveredQueueItem(chatID, replied.MessageID)
+	if err != nil {
+		return false // not a reply to a delivered reminder
+	}
+
+	// "snooze" only: with the first snooze preset of the chat
+	if preset == "" {
+		setting, _ := db.GetChatSetting(chatID)
+		preset = snoozePresetsOf(setting)[0]
+	}
+
+	var msg string
+	options := tg.OptionsSendMessage{}.
+		SetReplyMarkup(defaultReplyMarkup()).
+		SetReplyParameters(tg.NewReplyParameters(message.MessageID)).
+		SetParseMode(tg.ParseModeHTML)
+	if when, err := snoozeUntil(preset, time.Now()); err == nil {
+		if snoozedID, err := enqueueSnoozed(db, item, when, userIDOf(message)); err == nil {
+			// (snoozing acknowledges it too)
+			if _, err := db.AcknowledgeQueueItem(item.ChatID, item.ID); err != nil {
+				logError(db, "failed to cancel re-notifications: %s", err)
+			}
+
+			msg = fmt.Sprintf(msgSnoozedFormat,
+				escapeHTML(item.Message),
+				datetimeToStr(when, chatDatetimePreference(db, chatID)),
+			)
+
+			// for undoing it (if snoozed by accident)
+			options.SetReplyMarkup(tg.NewInlineKeyboardMarkup(undoSnoozeButtonsForCallbackQuery(snoozedID, item.ID)))
+		} else {
+			msg = fmt.Sprintf(msgSaveFailedFormat, escapeHTML(item.Message), err)
+		}
+	} else {
+		msg = fmt.Sprintf(msgSnoozeReplyInvalidFormat, escapeHTML(err.Error()))
+	}
+
+	if sent := bot.SendMessage(chatID, msg, options); !sent.Ok {
+		logError(db, "failed to send message: %s", *sent.Description)
+	}
+
+	return true
+}
+
+// keywords of snooze requests replied to delivered reminders (longer ones first)
+var _snoozeReplyKeywords = []string{"remind me again", "remind again", "snooze"}
+
+// get the snooze preset (eg. "30m", "tomorrow 9am") from given reply text (eg. "snooze 30m", "remind again in 2h"),
+// or return false if it is not a snooze request
+func snoozeReplyPreset(text string) (preset string, found bool) {
+	text = strings.TrimSpace(strings.ToLower(text))
+
+	for _, keyword := range _snoozeReplyKeywords {
+		if rest, ok := strings.CutPrefix(text, keyword); ok && (rest == "" || strings.HasPrefix(rest, " ")) {
+			rest = strings.TrimSpace(rest)
+			rest = strings.TrimSpace(strings.TrimPrefix(rest, "in "))
+
+			// "tomorrow" only: at the same time tomorrow
+			if rest == "tomorrow" {
+				rest = "1d"
+			}
+
+			return rest, true
+		}
+	}
+
+	return "", false
+}
+
+// calculate the time when a reminder snoozed with given preset (eg. "10m", "2d", "tomorrow 9am") should be fired
+func snoozeUntil(preset string, from time.Time) (time.Time, error) {
+	preset = strings.TrimSpace(strings.ToLower(preset))
+
+	// "tomorrow 9am", "tomorrow 21:30", ...
+	if clock, found := strings.CutPrefix(preset, "tomorrow"); found {
+		hour, minute, err := parseClock(clock)
+		if err != nil {
+			return from, fmt.Errorf("invalid time in '%s': %s", preset, err)
+		}
+
+		tomorrow := from.In(_location).AddDate(0, 0, 1)
+		return time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), hour, minute, 0, 0, _location), nil
+	}
+
+	// "2d", "10m", "1h30m", ...
+	duration, err := parseDuration(preset)
+	if err != nil {
+		return from, err
+	}
+
+	return from.Add(duration), nil
+}
+
+// parse given positive duration string (eg. "2d", "10m", "1h30m")
+func parseDuration(str string) (duration time.Duration, err error) {
+	str = strings.TrimSpace(strings.ToLower(str))
+
+	if days, found := strings.CutSuffix(str, "d"); found {
+		if n, err := strconv.Atoi(days); err == nil {
+			duration = time.Duration(n) * 24 * time.Hour
+		} else {
+			return 0, fmt.Errorf("invalid number of days in '%s'", str)
+		}
+	} else if d, err := time.ParseDuration(str); err == nil {
+		duration = d
+	} else {
+		return 0, fmt.Errorf("invalid duration: '%s'", str)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("non-positive duration: '%s'", str)
+	}
+
+	return duration, nil
+}
+
+// format given duration to a human-readable string (eg. "1 day", "3 hours", "30 minutes")
+func durationToStr(duration time.Duration) string {
+	var n int64
+	var unit string
+	if duration%(24*time.Hour) == 0 {
+		n, unit = int64(duration/(24*time.Hour)), "day"
+	} else if duration%time.Hour == 0 {
+		n, unit = int64(duration/time.Hour), "hour"
+	} else {
+		n, unit = int64(duration/time.Minute), "minute"
+	}
+
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// parse clock string (eg. "9am", "9:30 pm", "21:30") into hour and minute
+func parseClock(str string) (hour, minute int, err error) {
+	str = strings.ReplaceAll(strings.TrimSpace(strings.ToLower(str)), " ", "")
+
+	var meridiem bool
+	var offset int
+	if s, found := strings.CutSuffix(str, "am"); found {
+		str, meridiem = s, true
+	} else if s, found := strings.CutSuffix(str, "pm"); found {
+		str, meridiem, offset = s, true, 12
+	}
+
+	hh, mm, _ := strings.Cut(str, ":")
+	if hour, err = strconv.Atoi(hh); err != nil {
+		return 0, 0, fmt.Errorf("invalid hour: '%s'", hh)
+	}
+	if mm != "" {
+		if minute, err = strconv.Atoi(mm); err != nil {
+			return 0, 0, fmt.Errorf("invalid minute: '%s'", mm)
+		}
+	}
+	if meridiem {
+		if hour < 1 || hour > 12 {
+			return 0, 0, fmt.Errorf("invalid hour: %d", hour)
+		}
+		hour = hour%12 + offset
+	}
+	if hour < 0 || hour >= 24 || minute < 0 || minute >= 60 {
+		return 0, 0, fmt.Errorf("out of range: %02d:%02d", hour, minute)
+	}
+
+	return hour, minute, nil
+}
+
+// datetime formats which can be chosen for each chat (the first one is the default)
+var _datetimeFormats = []struct {
+	name   string
+	layout string
+}{
+	{"ymd", datetimeFormat},             // 2024.12.25 15:00 KST
+	{"ymd12", "2006.01.02 3:04 PM MST"}, // 2024.12.25 3:00 PM KST
+	{"dmy", "02.01.2006 15:04 MST"},     // 25.12.2024 15:00 KST
+	{"dmy12", "02.01.2006 3:04 PM MST"}, // 25.12.2024 3:00 PM KST
+	{"mdy", "01/02/2006 15:04 MST"},     // 12/25/2024 15:00 KST
+	{"mdy12", "01/02/2006 3:04 PM MST"}, // 12/25/2024 3:00 PM KST
+}
+
+// preference of a chat for displaying datetimes
+type datetimePreference struct {
+	layout   string
+	location *time.Location
+}
+
+// get the datetime preference (format and timezone) of given chat
+func chatDatetimePreference(db *Database, chatID int64) datetimePreference {
+	pref := datetimePreference{
+		layout:   datetimeFormat,
+		location: chatLocation(db, chatID),
+	}
+
+	if setting, err := db.GetChatSetting(chatID); err == nil {
+		if layout, exists := datetimeLayoutOf(setting.DatetimeFormat); exists {
+			pref.layout = layout
+		}
+	}
+
+	return pref
+}
+
+// get the layout of given datetime format name
+func datetimeLayoutOf(name string) (layout string, exists bool) {
+	for _, format := range _datetimeFormats {
+		if format.name == name {
+			return format.layout, true
+		}
+	}
+
+	return "", false
+}
+
+// format given time to string for displaying (use `datetimeFormat` for the canonical ones which will be parsed back)
+func datetimeToStr(t time.Time, pref datetimePreference) string {
+	return t.In(pref.location).Format(pref.layout)
+}
+
+// format the fire time of given queue item with given preference, or a marker if it is undated
+func fireOnToStr(q QueueItem, pref datetimePreference) string {
+	if q.Undated {
+		return msgUndated
+	}
+
+	return datetimeToStr(q.FireOn, pref)
 }
 
 // convert error to string
+// check if given error is transient (eg. network errors, timeouts, or 5xx errors of the API), so it is worth retrying
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return gerr.Code == http.StatusRequestTimeout || gerr.Code >= 500
+	}
+
+	var nerr net.Error
+	return errors.As(err, &nerr)
+}
+
 func errorString(err error) (error string) {
 	var gerr *googleapi.Error
 	if errors.As(err, &gerr) {
@@ -1095,3 +6600,124 @@ func errorString(err error) (error string) {
 		return err.Error()
 	}
 }
+
+// return a /setkey command handler
+func setKeyCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "setkey command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil && message.From != nil {
+			chatID := message.Chat.ID
+			userID := message.From.ID
+
+			var msg string
+			apiKey := strings.TrimSpace(args)
+			if conf.EncryptionKey == "" {
+				msg = msgKeyNotConfigured
+			} else if apiKey == "" {
+				msg = msgSetKeyUsage
+			} else {
+				// delete the message which contains the key
+				if deleted := b.DeleteMessage(chatID, message.MessageID); !deleted.Ok {
+					logError(db, "failed to delete message with API key: %s", *deleted.Description)
+				}
+
+				if encrypted, err := db.Encrypt(apiKey); err == nil {
+					if _, err := db.SaveUserAPIKey(userID, encrypted); err == nil {
+						msg = msgKeySaved
+					} else {
+						logError(db, "failed to save API key: %s", err)
+
+						msg = msgError
+					}
+				} else {
+					logError(db, "failed to encrypt API key: %s", err)
+
+					msg = msgError
+				}
+			}
+
+			options := tg.OptionsSendMessage{}.
+				SetReplyMarkup(defaultReplyMarkup())
+			if sent := b.SendMessage(chatID, msg, options); !sent.Ok {
+				logError(db, "failed to send message: %s", *sent.Description)
+			}
+		}
+	}
+}
+
+// return a /clearkey command handler
+func clearKeyCommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if !isAllowed(conf, update) {
+			logInfoForUpdate(update, "clearkey command not allowed: %s", userNameFromUpdate(update))
+			return
+		}
+
+		if message := messageFromUpdate(update); message != nil && message.From != nil {
+			chatID := message.Chat.ID
+
+			var msg string
+			if deleted, err := db.DeleteUserAPIKey(message.From.ID); err == nil {
+				if deleted {
+					msg = msgKeyCleared
+				} else {
+					msg = msgNoKey
+				}
+			} else {
+				logError(db, "failed to delete API key: %s", err)
+
+				msg = msgError
+			}
+
+			options := tg.OptionsSendMessage{}.
+				SetReplyMarkup(defaultReplyMarkup())
+			if sent := b.SendMessage(chatID, msg, options); !sent.Ok {
+				logError(db, "failed to send message: %s", *sent.Description)
+			}
+		}
+	}
+}
+
+// return a /whoami command handler
+//
+// (allowed for everyone, for letting users know why they are not allowed)
+func whoAmICommandHandler(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	return func(b *tg.Bot, update tg.Update, args string) {
+		if message := messageFromUpdate(update); message != nil && message.From != nil {
+			chatID := message.Chat.ID
+			userID := message.From.ID
+
+			if !allowWhoAmIRate(userID) {
+				logDebug(conf, "rate limit of whoami exceeded: %s", userNameFromUpdate(update))
+				return
+			}
+
+			username := msgWhoAmINoUsername
+			if message.From.Username != nil {
+				username = "@" + escapeHTML(*message.From.Username)
+			}
+
+			// (do not tell anything about other users)
+			var allowed, hint string
+			if isAdmin(conf, update) {
+				allowed = msgWhoAmIAdmin
+			} else if isAllowed(conf, update) {
+				allowed = msgWhoAmIAllowed
+			} else {
+				allowed = msgWhoAmINotAllowed
+
+				if message.From.Username == nil {
+					hint = msgWhoAmISetUsername
+				} else {
+					hint = msgWhoAmIAskOwner
+				}
+			}
+
+			send(b, conf, db, fmt.Sprintf(msgWhoAmIFormat, userID, username, allowed)+hint, chatID, &message.MessageID)
+		}
+	}
+}
@@ -0,0 +1,717 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tg "github.com/meinside/telegram-bot-go"
+)
+
+func TestMain(m *testing.M) {
+	_location = time.UTC
+
+	os.Exit(m.Run())
+}
+
+func TestRankParsed(t *testing.T) {
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	soon := now.Add(time.Hour)
+	later := now.Add(2 * time.Hour)
+
+	tests := []struct {
+		name     string
+		parsed   []parsedItem
+		expected []string // messages, in the expected order
+	}{
+		{
+			name:     "empty",
+			parsed:   []parsedItem{},
+			expected: []string{},
+		},
+		{
+			name: "earlier ones first",
+			parsed: []parsedItem{
+				{Message: "later", When: later},
+				{Message: "soon", When: soon},
+			},
+			expected: []string{"soon", "later"},
+		},
+		{
+			name: "ties keep their original order",
+			parsed: []parsedItem{
+				{Message: "parsed", When: soon},
+				{Message: "generated", When: soon, Generated: true},
+				{Message: "another", When: soon},
+			},
+			expected: []string{"parsed", "generated", "another"},
+		},
+		{
+			name: "past ones last",
+			parsed: []parsedItem{
+				{Message: "past", When: past},
+				{Message: "later", When: later},
+				{Message: "soon", When: soon},
+			},
+			expected: []string{"soon", "later", "past"},
+		},
+		{
+			name: "current ones are past",
+			parsed: []parsedItem{
+				{Message: "now", When: now},
+				{Message: "soon", When: soon},
+			},
+			expected: []string{"soon", "now"},
+		},
+		{
+			name: "past ones are ranked by their times too",
+			parsed: []parsedItem{
+				{Message: "past", When: past},
+				{Message: "long ago", When: past.AddDate(0, 0, -1)},
+			},
+			expected: []string{"long ago", "past"},
+		},
+		{
+			name: "incomplete ones last",
+			parsed: []parsedItem{
+				{Message: "", When: soon},
+				{Message: "no time"},
+				{Message: "past", When: past},
+				{Message: "later", When: later},
+			},
+			expected: []string{"later", "past", "", "no time"}, // (items without times are past)
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := append([]parsedItem{}, test.parsed...)
+
+			ranked := rankParsed(test.parsed, now)
+
+			messages := []string{}
+			for _, p := range ranked {
+				messages = append(messages, p.Message)
+			}
+			if !slices.Equal(messages, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, messages)
+			}
+
+			// (should not be modified)
+			for i := range original {
+				if original[i].Message != test.parsed[i].Message {
+					t.Errorf("original items were modified: %v", test.parsed)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestFilterParsed(t *testing.T) {
+	now := time.Now().In(_location)
+	past := now.Add(-time.Hour)
+	soon := now.Add(time.Hour)
+	later := now.Add(2 * time.Hour)
+
+	tests := []struct {
+		name     string
+		parsed   []parsedItem
+		expected []string // messages, in the expected order
+	}{
+		{
+			name: "past ones are removed",
+			parsed: []parsedItem{
+				{Message: "past", When: past, Exact: true},
+				{Message: "soon", When: soon, Exact: true},
+			},
+			expected: []string{"soon"},
+		},
+		{
+			name: "all past",
+			parsed: []parsedItem{
+				{Message: "past", When: past, Exact: true},
+				{Message: "long ago", When: past.AddDate(0, 0, -1), Exact: true},
+			},
+			expected: []string{},
+		},
+		{
+			name: "duplicated times keep the first ranked one",
+			parsed: []parsedItem{
+				{Message: "later", When: later, Exact: true},
+				{Message: "soon", When: soon, Exact: true},
+				{Message: "soon again", When: soon, Exact: true},
+			},
+			expected: []string{"soon", "later"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filtered := filterParsed(config{}, test.parsed, _location)
+
+			messages := []string{}
+			for _, p := range filtered {
+				messages = append(messages, p.Message)
+			}
+			if !slices.Equal(messages, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, messages)
+			}
+		})
+	}
+}
+
+func TestRecoverInHandler(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+
+	var mutex sync.Mutex
+	handled := []int64{}
+
+	// a handler which panics on the first update
+	handler := commandHandler(newConfigHolder(config{}), db, "/test", func(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+		return func(b *tg.Bot, update tg.Update, args string) {
+			if update.UpdateID == 1 {
+				panic("injected panic")
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			handled = append(handled, update.UpdateID)
+		}
+	})
+
+	// handle updates like polling does (in goroutines, so an unrecovered panic would crash the whole process)
+	bot := tg.NewClient("test-token")
+	for _, updateIDs := range [][]int64{{1, 2}, {3}} { // (updates of each poll)
+		var wg sync.WaitGroup
+		for _, updateID := range updateIDs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				handler(bot, tg.Update{UpdateID: updateID}, "")
+			}()
+		}
+		wg.Wait()
+	}
+
+	slices.Sort(handled)
+	if !slices.Equal(handled, []int64{2, 3}) {
+		t.Errorf("expected updates [2 3] to be handled, got %v", handled)
+	}
+
+	if logs, err := db.GetLogs(10); err == nil {
+		if !slices.ContainsFunc(logs, func(l Log) bool {
+			return strings.Contains(l.Message, "recovered from panic in /test command handler: injected panic")
+		}) {
+			t.Errorf("panic was not logged: %v", logs)
+		}
+	} else {
+		t.Errorf("failed to get logs: %s", err)
+	}
+}
+
+func TestEscapeHTML(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"buy milk", "buy milk"},
+		{"<b>not bold</b>", "&lt;b&gt;not bold&lt;/b&gt;"},
+		{"1 < 2 && 3 > 2", "1 &lt; 2 &amp;&amp; 3 &gt; 2"},
+		{"already &amp; escaped", "already &amp;amp; escaped"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if escaped := escapeHTML(test.text); escaped != test.expected {
+			t.Errorf("expected %q for %q, got %q", test.expected, test.text, escaped)
+		}
+	}
+}
+
+func TestListItemText(t *testing.T) {
+	pref := datetimePreference{layout: datetimeFormat, location: time.UTC}
+	fireOn := time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		item     QueueItem
+		verbose  bool
+		expected string
+	}{
+		{
+			name:     "plain message",
+			item:     QueueItem{Message: "buy milk", FireOn: fireOn},
+			expected: fmt.Sprintf(msgListItemFormat, datetimeToStr(fireOn, pref), "buy milk"),
+		},
+		{
+			name:     "message with html",
+			item:     QueueItem{Message: "check <b>1 < 2</b> & 3 > 2", FireOn: fireOn},
+			expected: fmt.Sprintf(msgListItemFormat, datetimeToStr(fireOn, pref), "check &lt;b&gt;1 &lt; 2&lt;/b&gt; &amp; 3 &gt; 2"),
+		},
+		{
+			name: "recurring one with html",
+			item: QueueItem{Message: "<stand-up>", FireOn: fireOn, Recurrence: "0 9 * * 1-5"},
+			expected: fmt.Sprintf(msgListItemFormat, datetimeToStr(fireOn, pref), "&lt;stand-up&gt;") +
+				fmt.Sprintf(msgListItemCronFormat, "0 9 * * 1-5"),
+		},
+		{
+			name:    "verbose with the model name",
+			item:    QueueItem{Message: "R&D meeting", FireOn: fireOn, ModelName: "<model>"},
+			verbose: true,
+			expected: fmt.Sprintf(msgListItemFormat, datetimeToStr(fireOn, pref), "R&amp;D meeting") +
+				fmt.Sprintf(msgListItemModelFormat, "&lt;model&gt;"),
+		},
+		{
+			name:     "not verbose without the model name",
+			item:     QueueItem{Message: "R&D meeting", FireOn: fireOn, ModelName: "<model>"},
+			expected: fmt.Sprintf(msgListItemFormat, datetimeToStr(fireOn, pref), "R&amp;D meeting"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if text := listItemText(test.item, pref, test.verbose); text != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, text)
+			}
+		})
+	}
+}
+
+func TestFirstLine(t *testing.T) {
+	tests := []struct {
+		str      string
+		length   int
+		expected string
+	}{
+		{"buy milk", 100, "buy milk"},
+		{"buy milk\nand eggs", 100, "buy milk …"},
+		{"  buy milk  \n  and eggs  ", 100, "buy milk …"},
+		{"\n\nbuy milk\n\n", 100, "buy milk"},
+		{"buy milk\n   \n", 100, "buy milk"},
+		{"buy milk and eggs\nand bread", 8, "buy milk…"},
+		{"우유 사기\n계란도", 100, "우유 사기 …"},
+		{"", 100, ""},
+	}
+
+	for _, test := range tests {
+		if line := firstLine(test.str, test.length); line != test.expected {
+			t.Errorf("expected %q for %q (%d), got %q", test.expected, test.str, test.length, line)
+		}
+	}
+}
+
+func TestParseCacheKey(t *testing.T) {
+	conf := config{GoogleGenerativeModel: "some-model"}
+	seoul, _ := time.LoadLocation("Asia/Seoul")
+	now := time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		a, b  string
+		confB config
+		locB  *time.Location
+		nowB  time.Time
+		equal bool
+	}{
+		{
+			name:  "same text",
+			a:     "buy milk at 9",
+			b:     "buy milk at 9",
+			equal: true,
+		},
+		{
+			name:  "different spaces and cases",
+			a:     "Buy  milk\tat 9",
+			b:     "buy milk at 9",
+			equal: true,
+		},
+		{
+			name:  "different spaces of each line",
+			a:     "  buy milk  \n  and eggs\n\n",
+			b:     "buy milk\nand eggs",
+			equal: true,
+		},
+		{
+			name:  "different line breaks",
+			a:     "buy milk\nand eggs",
+			b:     "buy milk and eggs",
+			equal: false,
+		},
+		{
+			name:  "different empty lines",
+			a:     "buy milk\n\nand eggs",
+			b:     "buy milk\nand eggs",
+			equal: false,
+		},
+		{
+			name:  "different models",
+			a:     "buy milk at 9",
+			b:     "buy milk at 9",
+			confB: config{GoogleGenerativeModel: "another-model"},
+			equal: false,
+		},
+		{
+			name:  "different timezones",
+			a:     "buy milk at 9",
+			b:     "buy milk at 9",
+			locB:  seoul,
+			equal: false,
+		},
+		{
+			name:  "different days",
+			a:     "buy milk at 9",
+			b:     "buy milk at 9",
+			nowB:  now.AddDate(0, 0, 1),
+			equal: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			confB, locB, nowB := conf, time.UTC, now
+			if test.confB.GoogleGenerativeModel != "" {
+				confB = test.confB
+			}
+			if test.locB != nil {
+				locB = test.locB
+			}
+			if !test.nowB.IsZero() {
+				nowB = test.nowB
+			}
+
+			a := parseCacheKey(conf, time.UTC, test.a, now)
+			b := parseCacheKey(confB, locB, test.b, nowB)
+			if (a == b) != test.equal {
+				t.Errorf("expected keys of %q and %q to be equal: %t, got %q and %q", test.a, test.b, test.equal, a, b)
+			}
+		})
+	}
+}
+
+func TestRollPastToNextDay(t *testing.T) {
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	until := now.AddDate(0, 1, 0)
+
+	parsed := []parsedItem{
+		{ // "every weekday between 9 and 5, every hour, until next month" at 10am
+			Message:          "stretch",
+			When:             time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC),
+			Silent:           true,
+			Recurrence:       "0 9 * * 1-5",
+			UntilOn:          &until,
+			IntervalMinutes:  60,
+			WindowEndMinutes: 17 * 60,
+		},
+		{ // "meeting at 9:30, 15 minutes before" at 10am
+			Message:    "meeting",
+			When:       time.Date(2025, 1, 15, 9, 15, 0, 0, time.UTC),
+			LeadOffset: 15 * time.Minute,
+		},
+		{Message: "not passed yet", When: now.Add(time.Hour)},
+		{Message: "passed long ago", When: now.AddDate(0, 0, -2)},
+	}
+
+	rolled := rollPastToNextDay(parsed, now)
+
+	if len(rolled) != 2 {
+		t.Fatalf("expected 2 rolled items, got %d: %v", len(rolled), rolled)
+	}
+	for i, r := range rolled {
+		expected := parsed[i]
+		expected.When = parsed[i].When.AddDate(0, 0, 1)
+		expected.Generated = true
+
+		if r.Message != expected.Message ||
+			!r.When.Equal(expected.When) ||
+			r.Generated != expected.Generated ||
+			r.Silent != expected.Silent ||
+			r.Recurrence != expected.Recurrence ||
+			r.UntilOn != expected.UntilOn ||
+			r.IntervalMinutes != expected.IntervalMinutes ||
+			r.WindowEndMinutes != expected.WindowEndMinutes ||
+			r.LeadOffset != expected.LeadOffset {
+			t.Errorf("expected %+v, got %+v", expected, r)
+		}
+
+		// (should be kept in temporary messages too, for the buttons of rolled items)
+		temp := temporaryItemOf(10, 20, r)
+		if temp.Recurrence != expected.Recurrence ||
+			temp.UntilOn != expected.UntilOn ||
+			temp.IntervalMinutes != expected.IntervalMinutes ||
+			temp.WindowEndMinutes != expected.WindowEndMinutes ||
+			temp.LeadOffsetSeconds != int64(expected.LeadOffset.Seconds()) ||
+			temp.Silent != expected.Silent {
+			t.Errorf("expected a temporary message of %+v, got %+v", expected, temp)
+		}
+	}
+}
+
+func TestFailOccurrence(t *testing.T) {
+	db := openTestDatabase(t)
+
+	fireOn := time.Now().Add(-time.Minute).Truncate(time.Minute)
+
+	tests := []struct {
+		name       string
+		item       QueueItem
+		nextFireOn *time.Time // nil if not enqueued
+	}{
+		{
+			name: "one-shot",
+			item: QueueItem{ChatID: 10, Message: "once", FireOn: fireOn},
+		},
+		{
+			name:       "recurring",
+			item:       QueueItem{ChatID: 20, Message: "every day", FireOn: fireOn, Recurrence: fmt.Sprintf("%d %d * * *", fireOn.Minute(), fireOn.Hour())},
+			nextFireOn: func() *time.Time { next := fireOn.AddDate(0, 0, 1); return &next }(),
+		},
+		{
+			name: "recurring, but ended",
+			item: QueueItem{ChatID: 30, Message: "every day until now", FireOn: fireOn, Recurrence: fmt.Sprintf("%d %d * * *", fireOn.Minute(), fireOn.Hour()), UntilOn: &fireOn},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := db.EnqueueItem(test.item)
+			if err != nil {
+				t.Fatalf("failed to enqueue item: %s", err)
+			}
+			item, _ := db.GetQueueItem(test.item.ChatID, id)
+
+			if err := failOccurrence(db, item, "test"); err != nil {
+				t.Fatalf("failed to fail item: %s", err)
+			}
+
+			if failed, _ := db.GetQueueItem(test.item.ChatID, id); failed.FailedOn == nil || failed.FailReason != "test" {
+				t.Errorf("expected the item to be failed, got %+v", failed)
+			}
+
+			items, err := db.UndeliveredQueueItems(test.item.ChatID)
+			if err != nil {
+				t.Fatalf("failed to list items: %s", err)
+			}
+			if test.nextFireOn == nil {
+				if len(items) != 0 {
+					t.Errorf("expected no next occurrence, got %+v", items)
+				}
+			} else if len(items) != 1 {
+				t.Errorf("expected the next occurrence, got %+v", items)
+			} else if !items[0].FireOn.Equal(*test.nextFireOn) || items[0].Recurrence != test.item.Recurrence {
+				t.Errorf("expected the next occurrence on %s, got %+v", test.nextFireOn, items[0])
+			}
+		})
+	}
+}
+
+func TestParseExactDatetime(t *testing.T) {
+	kst := time.FixedZone("KST", 9*60*60)
+	now := time.Date(2025, time.January, 15, 0, 0, 0, 0, time.UTC)
+	epoch := time.Date(2025, time.January, 15, 5, 0, 0, 0, time.UTC) // 1736917200
+
+	tests := []struct {
+		name            string
+		text            string
+		expectedOk      bool
+		expectedWhen    time.Time
+		expectedMessage string
+	}{
+		{
+			name:            "bare epoch seconds",
+			text:            "1736917200",
+			expectedOk:      true,
+			expectedWhen:    epoch,
+			expectedMessage: "1736917200",
+		},
+		{
+			name:            "bare epoch milliseconds",
+			text:            "1736917200000",
+			expectedOk:      true,
+			expectedWhen:    epoch,
+			expectedMessage: "1736917200000",
+		},
+		{
+			name:            "epoch with a marker before the message",
+			text:            "@1736917200 call mom",
+			expectedOk:      true,
+			expectedWhen:    epoch,
+			expectedMessage: "call mom",
+		},
+		{
+			name:            "epoch with a marker after the message",
+			text:            "call mom @1736917200000",
+			expectedOk:      true,
+			expectedWhen:    epoch,
+			expectedMessage: "call mom",
+		},
+		{
+			name:       "epoch without a marker in the message",
+			text:       "call 1736917200 now",
+			expectedOk: false,
+		},
+		{
+			name:       "epoch without a marker after the message",
+			text:       "call mom 1736917200",
+			expectedOk: false,
+		},
+		{
+			name:            "iso 8601 with a zone",
+			text:            "2025-01-15T14:00:00+09:00 call mom",
+			expectedOk:      true,
+			expectedWhen:    epoch,
+			expectedMessage: "call mom",
+		},
+		{
+			name:            "iso 8601 without a zone (in the chat's timezone)",
+			text:            "2025-01-15T14:00 call mom",
+			expectedOk:      true,
+			expectedWhen:    time.Date(2025, time.January, 15, 14, 0, 0, 0, kst),
+			expectedMessage: "call mom",
+		},
+		{
+			name:            "leading datetime with a space",
+			text:            "2025-01-15 09:00 call mom",
+			expectedOk:      true,
+			expectedWhen:    time.Date(2025, time.January, 15, 9, 0, 0, 0, kst),
+			expectedMessage: "call mom",
+		},
+		{
+			name:            "trailing datetime with a space",
+			text:            "call mom 2025-01-15 09:00",
+			expectedOk:      true,
+			expectedWhen:    time.Date(2025, time.January, 15, 9, 0, 0, 0, kst),
+			expectedMessage: "call mom",
+		},
+		{
+			name:       "beyond the cap of years",
+			text:       "2099-01-15 09:00 call mom",
+			expectedOk: false,
+		},
+		{
+			name:       "no datetime",
+			text:       "tomorrow 9am call mom",
+			expectedOk: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			item, ok := parseExactDatetime(test.text, kst, now)
+
+			if ok != test.expectedOk {
+				t.Fatalf("expected ok to be %t, got %t", test.expectedOk, ok)
+			}
+			if !ok {
+				return
+			}
+			if !item.When.Equal(test.expectedWhen) {
+				t.Errorf("expected %s, got %s", test.expectedWhen.Format(time.RFC3339), item.When.Format(time.RFC3339))
+			}
+			if item.Message != test.expectedMessage {
+				t.Errorf("expected message '%s', got '%s'", test.expectedMessage, item.Message)
+			}
+			if !item.Exact {
+				t.Errorf("expected it to be exact")
+			}
+		})
+	}
+}
+
+func TestParseExactDatetimeString(t *testing.T) {
+	kst := time.FixedZone("KST", 9*60*60)
+	epoch := time.Date(2025, time.January, 15, 5, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		str          string
+		expectedOk   bool
+		expectedWhen time.Time
+	}{
+		{"2025-01-15T14:00:00+09:00", true, epoch},
+		{"2025-01-15T05:00:00Z", true, epoch},
+		{"2025-01-15T14:00:00", true, epoch},
+		{"2025-01-15T14:00", true, epoch},
+		{"2025-01-15 14:00:00", true, epoch},
+		{"2025-01-15 14:00", true, epoch},
+		{"@1736917200", true, epoch},
+		{"@1736917200000", true, epoch},
+		{"1736917200", false, time.Time{}}, // (without a marker)
+		{"@173691720", false, time.Time{}}, // (9 digits)
+		{"@0000000000", false, time.Time{}},
+		{"2025-01-15", false, time.Time{}},
+		{"14:00", false, time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.str, func(t *testing.T) {
+			when, ok := parseExactDatetimeString(test.str, kst)
+
+			if ok != test.expectedOk {
+				t.Fatalf("expected ok to be %t, got %t", test.expectedOk, ok)
+			}
+			if ok && !when.Equal(test.expectedWhen) {
+				t.Errorf("expected %s, got %s", test.expectedWhen.Format(time.RFC3339), when.Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+func TestIsEpochString(t *testing.T) {
+	tests := []struct {
+		str      string
+		expected bool
+	}{
+		{"1736917200", true},
+		{"1736917200000", true},
+		{"173691720", false},
+		{"17369172000", false},
+		{"173691720000", false},
+		{"17369172000000", false},
+		{"173691720a", false},
+		{"-736917200", false},
+		{"@1736917200", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if result := isEpochString(test.str); result != test.expected {
+			t.Errorf("expected %t for '%s', got %t", test.expected, test.str, result)
+		}
+	}
+}
+
+func TestIsTrickling(t *testing.T) {
+	db := openTestDatabase(t)
+
+	launchedAt := time.Now()
+	missed := QueueItem{ChatID: 10, FireOn: launchedAt.Add(-time.Hour)}
+	due := QueueItem{ChatID: 10, FireOn: launchedAt.Add(time.Minute)}
+
+	if isTrickling(db, missed) {
+		t.Errorf("expected the missed one not to be trickling before trickling starts")
+	}
+
+	_tricklingBefore.Store(db, launchedAt)
+	if !isTrickling(db, missed) {
+		t.Errorf("expected the missed one to be trickling")
+	}
+	if isTrickling(db, due) {
+		t.Errorf("expected the one due after launch not to be trickling")
+	}
+
+	// (delivered by `processQueue` again after trickling)
+	trickleMissedReminders(nil, config{}, db, nil)
+	if isTrickling(db, missed) {
+		t.Errorf("expected the missed one not to be trickling after trickling ends")
+	}
+}
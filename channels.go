@@ -0,0 +1,138 @@
+package main
+
+// channels.go
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// extra channels for delivering reminders (besides telegram, which is the default one)
+const (
+	channelEmail   = "email"
+	channelWebhook = "webhook"
+)
+
+// timeout of webhook requests
+const webhookTimeout = 10 * time.Second
+
+// notificationChannel is an extra channel for delivering reminders which were delivered on telegram
+type notificationChannel interface {
+	// check if it is usable for given chat (not retried if not)
+	check(conf config, setting ChatSetting) error
+
+	// deliver given queue item to given chat
+	deliver(conf config, setting ChatSetting, q QueueItem) error
+}
+
+// extra channels by their names
+var _notificationChannels = map[string]notificationChannel{
+	channelEmail:   emailChannel{},
+	channelWebhook: webhookChannel{},
+}
+
+// names of extra channels, in the order of appearance
+var _notificationChannelNames = []string{channelEmail, channelWebhook}
+
+// get the extra channels of given chat setting
+func channelsOf(setting ChatSetting) (channels []string) {
+	channels = []string{}
+	for _, channel := range strings.Split(setting.Channels, ",") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels
+}
+
+// parse given comma-separated channels (eg. "email, webhook")
+func parseChannels(str string) (channels []string, err error) {
+	channels = []string{}
+	for _, channel := range strings.Split(str, ",") {
+		channel = strings.ToLower(strings.TrimSpace(channel))
+		if _, exists := _notificationChannels[channel]; !exists {
+			return nil, fmt.Errorf("no such channel: '%s'", channel)
+		}
+		if !slices.Contains(channels, channel) {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels, nil
+}
+
+// emailChannel delivers reminders to the email address of the chat (`/email`)
+type emailChannel struct{}
+
+func (emailChannel) check(conf config, setting ChatSetting) error {
+	if conf.SMTP == nil {
+		return fmt.Errorf("smtp is not configured")
+	}
+	if setting.Email == "" {
+		return fmt.Errorf("email address is not set")
+	}
+
+	return nil
+}
+
+func (emailChannel) deliver(conf config, setting ChatSetting, q QueueItem) error {
+	return sendEmail(*conf.SMTP, setting.Email, fmt.Sprintf(msgEmailSubjectFormat, q.Message), q.Message)
+}
+
+// webhookChannel delivers reminders to the webhook url of the chat (`/webhook`) with a POST request
+type webhookChannel struct{}
+
+// payload of webhook requests
+type webhookPayload struct {
+	ID      int64     `json:"id"`
+	ChatID  int64     `json:"chat_id"`
+	Message string    `json:"message"`
+	FireOn  time.Time `json:"fire_on"`
+}
+
+func (webhookChannel) check(conf config, setting ChatSetting) error {
+	if setting.WebhookURL == "" {
+		return fmt.Errorf("webhook url is not set")
+	}
+
+	return nil
+}
+
+func (webhookChannel) deliver(conf config, setting ChatSetting, q QueueItem) error {
+	body, err := json.Marshal(webhookPayload{
+		ID:      q.ID,
+		ChatID:  q.ChatID,
+		Message: q.Message,
+		FireOn:  q.FireOn,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	client := http.Client{Timeout: webhookTimeout}
+	res, err := client.Post(setting.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to request webhook: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status: %s", res.Status)
+	}
+
+	return nil
+}
+
+// check if given string is a valid url for webhooks
+func isValidWebhookURL(str string) bool {
+	parsed, err := url.Parse(str)
+
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
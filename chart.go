@@ -0,0 +1,87 @@
+package main
+
+// chart.go
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"time"
+)
+
+// chart dimensions and colors
+const (
+	chartWidth   = 600
+	chartHeight  = 300
+	chartPadding = 20
+	chartBarGap  = 2
+)
+
+var (
+	_chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	_chartAxis       = color.RGBA{0x99, 0x99, 0x99, 0xff}
+	_chartBar        = color.RGBA{0x2a, 0x9d, 0xf4, 0xff}
+	_chartToday      = color.RGBA{0xf4, 0x7b, 0x2a, 0xff}
+)
+
+// fill given counts into consecutive `days` days until `until` (inclusive), with zeros for missing days
+func dailyCountsUntil(counts []DailyCount, days int, until time.Time) (filled []int64) {
+	byDay := map[string]int64{}
+	for _, c := range counts {
+		byDay[c.Day] = c.Count
+	}
+
+	filled = make([]int64, days)
+	for i := range days {
+		day := until.AddDate(0, 0, i-days+1).Format(time.DateOnly)
+		filled[i] = byDay[day]
+	}
+
+	return filled
+}
+
+// render a bar chart of given values (oldest first, the last one highlighted) as a PNG image
+func renderBarChart(values []int64) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{_chartBackground}, image.Point{}, draw.Src)
+
+	// axis
+	bottom := chartHeight - chartPadding
+	draw.Draw(img, image.Rect(chartPadding, bottom, chartWidth-chartPadding, bottom+1), &image.Uniform{_chartAxis}, image.Point{}, draw.Src)
+
+	// bars
+	var highest int64
+	for _, v := range values {
+		if v > highest {
+			highest = v
+		}
+	}
+	if len(values) > 0 && highest > 0 {
+		barWidth := (chartWidth - chartPadding*2) / len(values)
+		plotHeight := chartHeight - chartPadding*2
+
+		for i, v := range values {
+			height := int(int64(plotHeight) * v / highest)
+			if height <= 0 {
+				continue
+			}
+
+			col := _chartBar
+			if i == len(values)-1 {
+				col = _chartToday
+			}
+
+			left := chartPadding + i*barWidth
+			draw.Draw(img, image.Rect(left+chartBarGap, bottom-height, left+barWidth-chartBarGap, bottom), &image.Uniform{col}, image.Point{}, draw.Src)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,209 @@
+package main
+
+// commands.go
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tg "github.com/meinside/telegram-bot-go"
+)
+
+// commands (and their descriptions) for the command menu of telegram, in the order of appearance
+var _menuCommands = []struct {
+	command      string
+	descriptions map[string]string // by language code ("" for the default one)
+}{
+	{cmdRemind, map[string]string{"": "add a reminder", "ko": "알림 추가"}},
+	{cmdListReminders, map[string]string{"": "list reminders", "ko": "알림 목록"}},
+	{cmdHistory, map[string]string{"": "list delivered reminders", "ko": "전달된 알림 목록"}},
+	{cmdICal, map[string]string{"": "export reminders to calendar (.ics)", "ko": "알림을 캘린더(.ics)로 내보내기"}},
+	{cmdCancel, map[string]string{"": "cancel a reminder", "ko": "알림 취소"}},
+	{cmdCancelAll, map[string]string{"": "cancel all (or matching) reminders", "ko": "알림 일괄 취소"}},
+	{cmdUndated, map[string]string{"": "schedule undated reminders", "ko": "시간 미정 알림 예약"}},
+	{cmdClone, map[string]string{"": "duplicate a reminder to a new time", "ko": "알림 복제"}},
+	{cmdMilestones, map[string]string{"": "get notified before a reminder", "ko": "알림 전 미리 알림"}},
+	{cmdEscalate, map[string]string{"": "re-notify a reminder until acknowledged", "ko": "확인할 때까지 반복 알림"}},
+	{cmdActiveHours, map[string]string{"": "show or set the hours for re-notifications", "ko": "반복 알림 시간대 설정"}},
+	{cmdCron, map[string]string{"": "add a recurring reminder", "ko": "반복 알림 추가"}},
+	{cmdPreset, map[string]string{"": "save and use reminder presets", "ko": "알림 프리셋"}},
+	{cmdAlias, map[string]string{"": "define phrases of times", "ko": "시간 별칭 설정"}},
+	{cmdSnooze, map[string]string{"": "show or set snooze buttons", "ko": "다시 알림 버튼 설정"}},
+	{cmdTest, map[string]string{"": "send a test reminder", "ko": "테스트 알림 보내기"}},
+	{cmdPause, map[string]string{"": "pause reminders", "ko": "알림 일시 정지"}},
+	{cmdResume, map[string]string{"": "resume reminders", "ko": "알림 재개"}},
+	{cmdTimezone, map[string]string{"": "show or set the timezone", "ko": "시간대 설정"}},
+	{cmdDatetime, map[string]string{"": "show or set the datetime format", "ko": "날짜 형식 설정"}},
+	{cmdPrefix, map[string]string{"": "show or set the prefix of reminders", "ko": "알림 머리말 설정"}},
+	{cmdWeekStart, map[string]string{"": "show or set the first day of weeks", "ko": "한 주의 시작 요일 설정"}},
+	{cmdEmail, map[string]string{"": "show or set the email address", "ko": "이메일 주소 설정"}},
+	{cmdChannels, map[string]string{"": "show or set extra delivery channels", "ko": "추가 알림 채널 설정"}},
+	{cmdWebhook, map[string]string{"": "show or set the webhook url", "ko": "웹훅 주소 설정"}},
+	{cmdClearHistory, map[string]string{"": "delete delivered reminders", "ko": "전달된 알림 삭제"}},
+	{cmdForgetMe, map[string]string{"": "delete all data of this chat", "ko": "이 채팅의 모든 데이터 삭제"}},
+	{cmdStats, map[string]string{"": "show statistics", "ko": "통계"}},
+	{cmdSetKey, map[string]string{"": "use your own API key", "ko": "내 API 키 사용"}},
+	{cmdClearKey, map[string]string{"": "delete your API key", "ko": "내 API 키 삭제"}},
+	{cmdWhoAmI, map[string]string{"": "show your user id and status", "ko": "내 사용자 정보"}},
+	{cmdPrivacy, map[string]string{"": "show privacy policy", "ko": "개인정보 처리방침"}},
+	{cmdHelp, map[string]string{"": "show help message", "ko": "도움말"}},
+}
+
+// language codes of the localized command menus (besides the default one)
+var _menuLanguageCodes = []string{"ko"}
+
+// register the command menu of given bot (for each supported language), except the hidden ones
+func registerCommands(bot *tg.Bot, conf config) error {
+	for _, languageCode := range append([]string{""}, _menuLanguageCodes...) {
+		commands := []tg.BotCommand{}
+		for _, cmd := range _menuCommands {
+			if slices.Contains(conf.HiddenCommands, cmd.command) {
+				continue
+			}
+
+			description, exists := cmd.descriptions[languageCode]
+			if !exists {
+				description = cmd.descriptions[""]
+			}
+			commands = append(commands, tg.BotCommand{
+				Command:     strings.TrimPrefix(cmd.command, "/"),
+				Description: description,
+			})
+		}
+
+		options := tg.OptionsSetMyCommands{}
+		if languageCode != "" {
+			options.SetLanguageCode(languageCode)
+		}
+		if res := bot.SetMyCommands(commands, options); !res.Ok {
+			return fmt.Errorf("failed to set commands (language code: '%s'): %s", languageCode, *res.Description)
+		}
+	}
+
+	return nil
+}
+
+// maximum edit distance of a mistyped command from a known one, for suggesting it
+const maxCommandSuggestionDistance = 2
+
+// find the known command which is closest to given (mistyped) one, within `maxCommandSuggestionDistance`
+func suggestCommand(conf config, cmd string) (suggested string, found bool) {
+	typed := strings.ToLower(strings.TrimPrefix(cmd, "/"))
+
+	nearest := maxCommandSuggestionDistance + 1
+	for _, c := range _menuCommands {
+		if slices.Contains(conf.HiddenCommands, c.command) {
+			continue
+		}
+
+		name := strings.TrimPrefix(c.command, "/")
+		if distance := editDistance(typed, name); distance < nearest && distance < len([]rune(name)) {
+			suggested, nearest = c.command, distance
+		}
+	}
+
+	return suggested, suggested != ""
+}
+
+// edit distance between given strings, counting a transposition of adjacent characters as one edit (eg. "lsit" => "list")
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// distances[i][j]: distance between ra[:i] and rb[:j]
+	distances := make([][]int, len(ra)+1)
+	for i := range distances {
+		distances[i] = make([]int, len(rb)+1)
+		distances[i][0] = i
+	}
+	for j := range len(rb) + 1 {
+		distances[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			distances[i][j] = min(
+				distances[i-1][j]+1,      // deletion
+				distances[i][j-1]+1,      // insertion
+				distances[i-1][j-1]+cost, // substitution
+			)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				distances[i][j] = min(distances[i][j], distances[i-2][j-2]+1) // transposition
+			}
+		}
+	}
+
+	return distances[len(ra)][len(rb)]
+}
+
+// get the handler generator of given command, which can be run from a suggestion button (nil if it cannot be)
+func suggestableCommandHandler(cmd string) func(conf config, db *Database) func(b *tg.Bot, update tg.Update, args string) {
+	switch cmd {
+	case cmdListReminders:
+		return listRemindersCommandHandler
+	case cmdHistory:
+		return historyCommandHandler
+	case cmdCancel:
+		return cancelCommandHandler
+	case cmdCancelAll:
+		return cancelAllCommandHandler
+	case cmdUndated:
+		return undatedCommandHandler
+	case cmdClone:
+		return cloneCommandHandler
+	case cmdMilestones:
+		return milestonesCommandHandler
+	case cmdEscalate:
+		return escalateCommandHandler
+	case cmdActiveHours:
+		return activeHoursCommandHandler
+	case cmdCron:
+		return cronCommandHandler
+	case cmdSnooze:
+		return snoozeCommandHandler
+	case cmdAlias:
+		return aliasCommandHandler
+	case cmdICal:
+		return icalCommandHandler
+	case cmdTest:
+		return testCommandHandler
+	case cmdPause:
+		return pauseCommandHandler
+	case cmdResume:
+		return resumeCommandHandler
+	case cmdTimezone:
+		return timezoneCommandHandler
+	case cmdDatetime:
+		return datetimeCommandHandler
+	case cmdPrefix:
+		return prefixCommandHandler
+	case cmdWeekStart:
+		return weekStartCommandHandler
+	case cmdEmail:
+		return emailCommandHandler
+	case cmdChannels:
+		return channelsCommandHandler
+	case cmdWebhook:
+		return webhookCommandHandler
+	case cmdClearHistory:
+		return clearHistoryCommandHandler
+	case cmdForgetMe:
+		return forgetMeCommandHandler
+	case cmdStats:
+		return statsCommandHandler
+	case cmdWhoAmI:
+		return whoAmICommandHandler
+	case cmdPrivacy:
+		return privacyCommandHandler
+	case cmdHelp:
+		return helpCommandHandler
+	}
+
+	// (others need more than the config and database, or should not be run with a button, eg. /setkey)
+	return nil
+}
@@ -0,0 +1,216 @@
+package main
+
+// cron.go
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minimal parser for standard cron expressions (minute, hour, day of month, month, day of week)
+
+// number of years to look ahead for the next matching time
+const cronLookAheadYears = 5
+
+// number of minutes in a day (for windows of intra-day recurrences)
+const minutesInDay = 24 * 60
+
+// cronField is the name and range of a field in cron expressions
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var _cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // both 0 and 7 are sunday
+}
+
+// cronSchedule is a parsed cron expression
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // bit sets of matching values
+
+	// if either of day of month or day of week is '*', both of them should match,
+	// otherwise one of them should match
+	domStar, dowStar bool
+}
+
+// parse given cron expression (eg. "0 9 * * 1-5")
+func parseCron(expr string) (schedule cronSchedule, err error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(_cronFields) {
+		return schedule, fmt.Errorf("expected %d fields (minute, hour, day of month, month, day of week), but got %d", len(_cronFields), len(fields))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		if bits[i], err = parseCronField(field, _cronFields[i]); err != nil {
+			return schedule, err
+		}
+	}
+
+	// 7 => 0 (sunday)
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+
+	return cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parse a field of cron expression (eg. "*", "1-5", "*/15", "0,30")
+func parseCronField(field string, f cronField) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		rng, step, hasStep := strings.Cut(part, "/")
+
+		// range
+		var lo, hi int
+		if rng == "*" {
+			lo, hi = f.min, f.max
+		} else if from, to, found := strings.Cut(rng, "-"); found {
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid %s: '%s'", f.name, part)
+			}
+			if hi, err = strconv.Atoi(to); err != nil {
+				return 0, fmt.Errorf("invalid %s: '%s'", f.name, part)
+			}
+		} else {
+			if lo, err = strconv.Atoi(rng); err != nil {
+				return 0, fmt.Errorf("invalid %s: '%s'", f.name, part)
+			}
+			hi = lo
+			if hasStep { // "n/step" means "n-max/step"
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%s out of range (%d-%d): '%s'", f.name, f.min, f.max, part)
+		}
+
+		// step
+		n := 1
+		if hasStep {
+			if n, err = strconv.Atoi(step); err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step of %s: '%s'", f.name, part)
+			}
+		}
+
+		for i := lo; i <= hi; i += n {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+// get the next matching time after given time
+func (s cronSchedule) next(after time.Time) (time.Time, error) {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronLookAheadYears, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = advanceTo(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = advanceTo(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = advanceTo(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc))
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t, nil
+	}
+
+	return after, fmt.Errorf("no matching time in %d years", cronLookAheadYears)
+}
+
+// get `to` if it is after `t`, or `t` an hour later
+//
+// (times in gaps of DST transitions are normalized by time.Date, possibly backwards,
+// so times in the skipped hour never match)
+func advanceTo(t, to time.Time) time.Time {
+	if to.After(t) {
+		return to
+	}
+	return t.Add(time.Hour)
+}
+
+// check if the day of given time matches
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	domMatches := s.dom&(1<<uint(t.Day())) != 0
+	dowMatches := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return domMatches && dowMatches
+	}
+	return domMatches || dowMatches
+}
+
+// get the next time after `after`, repeated with given interval from `from` within its day,
+// or return false if it is not before the end of the window (in minutes of the day, end of the day if 0)
+//
+// (eg. "every hour between 9 and 5": from 09:00 with 60 minutes until 1020 => 10:00, 11:00, ..., 17:00)
+func nextInWindow(from, after time.Time, intervalMinutes, windowEndMinutes int) (next time.Time, ok bool) {
+	if intervalMinutes <= 0 {
+		return from, false
+	}
+	if windowEndMinutes <= 0 || windowEndMinutes >= minutesInDay {
+		windowEndMinutes = minutesInDay - 1
+	}
+
+	interval := time.Duration(intervalMinutes) * time.Minute
+	end := time.Date(from.Year(), from.Month(), from.Day(), windowEndMinutes/60, windowEndMinutes%60, 0, 0, from.Location())
+
+	next = from.Add(interval)
+	for !next.After(after) { // (skip the missed ones)
+		next = next.Add(interval)
+	}
+
+	return next, !next.After(end)
+}
+
+// parse given time of the day (eg. "17:00") into minutes of the day (eg. 1020)
+func parseMinutesOfDay(str string) (minutes int, err error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(str))
+	if err != nil {
+		return 0, err
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// format given minutes of the day (eg. 1020) as a time of the day (eg. "17:00")
+func minutesOfDayToStr(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// get the next matching time of given cron expression after given time
+func nextCronTime(expr string, after time.Time) (time.Time, error) {
+	schedule, err := parseCron(expr)
+	if err != nil {
+		return after, err
+	}
+
+	return schedule.next(after)
+}
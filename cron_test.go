@@ -0,0 +1,261 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextCronTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone data: %s", err)
+	}
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skipf("no time zone data: %s", err)
+	}
+
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2025, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		after    time.Time
+		expected time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "day of month or day of week when both are restricted",
+			expr:     "0 9 16 * 5",
+			after:    utc(time.January, 15, 10, 0), // wednesday
+			expected: utc(time.January, 16, 9, 0),  // thursday, the 16th
+		},
+		{
+			name:     "day of week matches first when both are restricted",
+			expr:     "0 9 20 * 5",
+			after:    utc(time.January, 15, 10, 0),
+			expected: utc(time.January, 17, 9, 0), // friday
+		},
+		{
+			name:     "day of month with a star and a step, and day of week",
+			expr:     "0 9 */2 * 1",
+			after:    utc(time.January, 15, 10, 0),
+			expected: utc(time.January, 27, 9, 0), // monday on an odd day (not the 20th)
+		},
+		{
+			name:     "7 is sunday",
+			expr:     "0 9 * * 7",
+			after:    utc(time.January, 15, 10, 0),
+			expected: utc(time.January, 19, 9, 0),
+		},
+		{
+			name:     "0 is sunday",
+			expr:     "0 9 * * 0",
+			after:    utc(time.January, 15, 10, 0),
+			expected: utc(time.January, 19, 9, 0),
+		},
+		{
+			name:     "start with a step",
+			expr:     "5/20 * * * *",
+			after:    utc(time.January, 15, 10, 0),
+			expected: utc(time.January, 15, 10, 5),
+		},
+		{
+			name:     "start with a step, after the last one of the hour",
+			expr:     "5/20 * * * *",
+			after:    utc(time.January, 15, 10, 45),
+			expected: utc(time.January, 15, 11, 5),
+		},
+		{
+			name:     "ranges and lists",
+			expr:     "0,30 9-10 * * 1-5",
+			after:    utc(time.January, 17, 10, 30), // friday
+			expected: utc(time.January, 20, 9, 0),
+		},
+		{
+			name:     "rollover to the next month",
+			expr:     "0 0 1 * *",
+			after:    utc(time.January, 15, 10, 0),
+			expected: utc(time.February, 1, 0, 0),
+		},
+		{
+			name:     "rollover to the next month with the day",
+			expr:     "0 9 31 * *",
+			after:    utc(time.January, 31, 10, 0),
+			expected: utc(time.March, 31, 9, 0),
+		},
+		{
+			name:     "rollover to the next year",
+			expr:     "0 9 1 1 *",
+			after:    utc(time.December, 31, 10, 0),
+			expected: time.Date(2026, time.January, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "leap day",
+			expr:     "0 9 29 2 *",
+			after:    utc(time.January, 15, 10, 0),
+			expected: time.Date(2028, time.February, 29, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "impossible day",
+			expr:    "0 9 30 2 *",
+			after:   utc(time.January, 15, 10, 0),
+			wantErr: true,
+		},
+		{
+			name:     "skipped hour of the spring-forward gap",
+			expr:     "30 2 * * *",
+			after:    time.Date(2025, time.March, 8, 3, 0, 0, 0, newYork),
+			expected: time.Date(2025, time.March, 10, 2, 30, 0, 0, newYork),
+		},
+		{
+			name:     "hourly over the spring-forward gap",
+			expr:     "0 * * * *",
+			after:    time.Date(2025, time.March, 9, 1, 30, 0, 0, newYork),
+			expected: time.Date(2025, time.March, 9, 3, 0, 0, 0, newYork),
+		},
+		{
+			name:     "repeated hour of the fall-back",
+			expr:     "30 1 * * *",
+			after:    time.Date(2025, time.November, 1, 3, 0, 0, 0, newYork),
+			expected: time.Date(2025, time.November, 2, 1, 30, 0, 0, newYork), // (the first one)
+		},
+		{
+			name:     "skipped midnight of the spring-forward gap",
+			expr:     "0 9 * * *",
+			after:    time.Date(2018, time.November, 3, 10, 0, 0, 0, saoPaulo),
+			expected: time.Date(2018, time.November, 4, 9, 0, 0, 0, saoPaulo),
+		},
+		{
+			name:    "too few fields",
+			expr:    "0 9 * *",
+			after:   utc(time.January, 15, 10, 0),
+			wantErr: true,
+		},
+		{
+			name:    "out of range",
+			expr:    "0 24 * * *",
+			after:   utc(time.January, 15, 10, 0),
+			wantErr: true,
+		},
+		{
+			name:    "zero step",
+			expr:    "*/0 * * * *",
+			after:   utc(time.January, 15, 10, 0),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next, err := nextCronTime(test.expr, test.after)
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", next.Format(time.RFC1123))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !next.Equal(test.expected) {
+				t.Errorf("expected %s, got %s", test.expected.Format(time.RFC1123), next.Format(time.RFC1123))
+			}
+		})
+	}
+}
+
+func TestNextInWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2025, time.January, 15, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name             string
+		from, after      time.Time
+		intervalMinutes  int
+		windowEndMinutes int
+		expected         time.Time
+		expectedOk       bool
+	}{
+		{
+			name:             "next one in the window",
+			from:             at(9, 0),
+			after:            at(9, 0),
+			intervalMinutes:  60,
+			windowEndMinutes: 17 * 60,
+			expected:         at(10, 0),
+			expectedOk:       true,
+		},
+		{
+			name:             "at the end of the window",
+			from:             at(9, 0),
+			after:            at(16, 30),
+			intervalMinutes:  60,
+			windowEndMinutes: 17 * 60,
+			expected:         at(17, 0),
+			expectedOk:       true,
+		},
+		{
+			name:             "after the end of the window",
+			from:             at(9, 0),
+			after:            at(17, 0),
+			intervalMinutes:  60,
+			windowEndMinutes: 17 * 60,
+			expected:         at(18, 0),
+			expectedOk:       false,
+		},
+		{
+			name:             "not aligned to the end of the window",
+			from:             at(9, 0),
+			after:            at(9, 45),
+			intervalMinutes:  45,
+			windowEndMinutes: 10 * 60,
+			expected:         at(10, 30),
+			expectedOk:       false,
+		},
+		{
+			name:             "end of the day without the end",
+			from:             at(23, 0),
+			after:            at(23, 0),
+			intervalMinutes:  30,
+			windowEndMinutes: 0,
+			expected:         at(23, 30),
+			expectedOk:       true,
+		},
+		{
+			name:             "over midnight without the end",
+			from:             at(22, 0),
+			after:            at(23, 0),
+			intervalMinutes:  60,
+			windowEndMinutes: 0,
+			expected:         at(24, 0),
+			expectedOk:       false,
+		},
+		{
+			name:             "no interval",
+			from:             at(9, 0),
+			after:            at(9, 0),
+			intervalMinutes:  0,
+			windowEndMinutes: 17 * 60,
+			expected:         at(9, 0),
+			expectedOk:       false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next, ok := nextInWindow(test.from, test.after, test.intervalMinutes, test.windowEndMinutes)
+
+			if ok != test.expectedOk {
+				t.Errorf("expected ok to be %t, got %t", test.expectedOk, ok)
+			}
+			if !next.Equal(test.expected) {
+				t.Errorf("expected %s, got %s", test.expected.Format(time.RFC1123), next.Format(time.RFC1123))
+			}
+		})
+	}
+}
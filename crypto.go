@@ -0,0 +1,116 @@
+package main
+
+// crypto.go
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// parameters of scrypt for deriving keys from passphrases
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	cipherKeyLength = 32 // for AES-256
+	saltLength      = 16
+)
+
+// prefix of ciphertexts encrypted with keys derived with scrypt
+// (the ones without it were encrypted with the legacy keys, sha256 of passphrases)
+const cipherVersionPrefix = "v2:"
+
+// cipherKeys are the keys for encrypting and decrypting data at rest, derived from a passphrase (`encryption_key`)
+type cipherKeys struct {
+	key    []byte // derived with scrypt and the salt (stored in the database)
+	legacy []byte // sha256 of the passphrase, only for decrypting the ones encrypted before
+}
+
+// derive keys from given passphrase and salt
+func newCipherKeys(passphrase string, salt []byte) (keys cipherKeys, err error) {
+	if keys.key, err = scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, cipherKeyLength); err != nil {
+		return keys, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	legacy := sha256.Sum256([]byte(passphrase))
+	keys.legacy = legacy[:]
+
+	return keys, nil
+}
+
+// generate a new random salt for deriving keys
+func newSalt() ([]byte, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	return salt, nil
+}
+
+// encrypt given plaintext (AES-256-GCM), and return it as a base64-encoded string with the version prefix
+func (k cipherKeys) encrypt(plaintext string) (string, error) {
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return cipherVersionPrefix + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+// decrypt given ciphertext (generated by `encrypt`, or with the legacy key)
+func (k cipherKeys) decrypt(ciphertext string) (string, error) {
+	key := k.legacy
+	if encoded, found := strings.CutPrefix(ciphertext, cipherVersionPrefix); found {
+		key, ciphertext = k.key, encoded
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("ciphertext is too short")
+	}
+
+	nonce, sealed := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// check if given ciphertext was encrypted with the legacy key (and should be encrypted again)
+func isLegacyCiphertext(ciphertext string) bool {
+	return !strings.HasPrefix(ciphertext, cipherVersionPrefix)
+}
+
+// create a new AES-GCM cipher with given key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -11,11 +16,14 @@ import (
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // constants
 const (
 	DefaultMaxNumTries = 10
+
+	encryptedPrefix = "enc:" // prefix of encrypted values in the database
 )
 
 // Prompt struct
@@ -30,6 +38,8 @@ type Prompt struct {
 	Tokens int `gorm:"index"`
 
 	Result ParsedItem
+
+	BotID int64 `gorm:"index;default:0"` // id of the bot which received it (when running multiple bots)
 }
 
 // Log struct is for logging messages
@@ -46,6 +56,9 @@ type ParsedItem struct {
 
 	Successful bool `gorm:"index"`
 	Tokens     int  `gorm:"index"`
+	ModelName  string
+	Retries    int    // number of retries on transient errors
+	FailReason string // why it failed (empty if successful)
 
 	PromptID int64 // foreign key
 }
@@ -55,15 +68,69 @@ type QueueItem struct {
 	gorm.Model
 
 	ID          int64
-	ChatID      int64 `gorm:"index:idx_queue1;index:idx_queue4"`
+	ChatID      int64 `gorm:"index:idx_queue1;index:idx_queue4;uniqueIndex:idx_queue_idempotency1"`
 	MessageID   int64
 	Message     string
 	EnqueuedOn  time.Time  `gorm:"index:idx_queue2;index:idx_queue3;index:idx_queue4;index:idx_queue5"`
-	FireOn      time.Time  `gorm:"index:idx_queue5"`
+	FireOn      time.Time  `gorm:"index:idx_queue5"` // null for undated items (with `Undated`)
 	DeliveredOn *time.Time `gorm:"index:idx_queue1;index:idx_queue2;index:idx_queue3;index:idx_queue4;index:idx_queue5"`
 	NumTries    int        `gorm:"index:idx_queue3;index:idx_queue5"`
+
+	DeliveredMessageID int64 `gorm:"index"` // id of the delivered message
+
+	MessageThreadID int64 // for topics in forum groups
+
+	ModelName string // name of the model which parsed this item
+
+	FailedOn   *time.Time `gorm:"index"` // set when this item cannot be delivered anymore (terminal state)
+	FailReason string
+
+	// for milestone notifications (eg. "1 day left") of another item
+	MilestoneOf            int64 `gorm:"index;default:0"` // id of the main item
+	MilestoneOffsetSeconds int64
+
+	Recurrence string     // cron expression for recurring items (eg. "0 9 * * 1-5")
+	UntilOn    *time.Time // end of the recurrence (not repeated after it)
+
+	// for items repeated within a window of each day (eg. "every hour between 9 and 5"),
+	// from the times of `Recurrence` (eg. "0 9 * * *") until the end of the window
+	IntervalMinutes  int // 0 if not repeated within a day
+	WindowEndMinutes int // end of the window in minutes of the day (eg. 1020 for 17:00), end of the day if 0
+
+	Silent bool // deliver without notification sound
+
+	BotID int64 `gorm:"index;default:0"` // id of the bot which will deliver this item (when running multiple bots)
+
+	IdempotencyKey *string `gorm:"uniqueIndex:idx_queue_idempotency1"` // client-supplied key for not enqueueing the same item twice (eg. with the admin API)
+
+	EmailedOn *time.Time // set when this item was delivered by email fallback
+
+	Source    string `gorm:"index"` // where this item came from (eg. "message", "api"; empty for items created before tracking)
+	CreatedBy int64  // id of the user who created this item (0 if unknown, eg. with the admin API)
+
+	Tags string // comma-separated tags in the message, without '#' (eg. "work,home"; not saved when messages are encrypted)
+
+	LeadOffsetSeconds int64 // notified this much before the event (eg. "15 minutes before the meeting"), so the event is on `FireOn` + this
+
+	Undated bool `gorm:"index;default:false"` // not scheduled yet (`FireOn` is null until scheduled with `/undated`)
+
+	// for re-notifications until acknowledged
+	EscalateMinutes int   // re-notified every this minutes after delivered, until acknowledged (0 if not escalated)
+	EscalationOf    int64 `gorm:"index;default:0"` // id of the original item of this re-notification
+	EscalationCount int   // number of re-notifications so far
 }
 
+// sources of queue items
+const (
+	sourceMessage    = "message"    // telegram message (including replies to the bot's questions and inline keyboards)
+	sourceCommand    = "command"    // telegram command (eg. `/cron`)
+	sourceAPI        = "api"        // admin HTTP API
+	sourceSnooze     = "snooze"     // snoozed reminder
+	sourceRecurrence = "recurrence" // next occurrence of a recurring reminder
+	sourceMilestone  = "milestone"  // milestone notification of another reminder
+	sourceEscalation = "escalation" // re-notification of an unacknowledged reminder
+)
+
 // TemporaryMessage is a struct for temporary message for handling inline queries
 type TemporaryMessage struct {
 	gorm.Model
@@ -72,7 +139,130 @@ type TemporaryMessage struct {
 	ChatID    int64 `gorm:"index:idx_temp_messages1"`
 	MessageID int64 `gorm:"index:idx_temp_messages1"`
 	Message   string
+	Silent    bool
 	SavedOn   time.Time
+
+	// for recurring items which are waiting for confirmations
+	Recurrence       string
+	UntilOn          *time.Time
+	IntervalMinutes  int
+	WindowEndMinutes int
+
+	LeadOffsetSeconds int64 // for items which are notified before their events
+
+	BotID int64 `gorm:"index;default:0"` // id of the bot which received it (when running multiple bots)
+}
+
+// ChatSetting is a struct for per-chat settings
+type ChatSetting struct {
+	gorm.Model
+
+	ChatID        int64 `gorm:"uniqueIndex:idx_chat_settings1"`
+	Paused        bool
+	Blocked       bool   // set when the bot was blocked by the user (or the chat is not reachable), and reset on the next message from the chat
+	SnoozePresets string // comma-separated, eg. "10m,1h,tomorrow 9am"
+	Timezone      string // IANA timezone name, eg. "Asia/Seoul"
+
+	PendingMessageID int64 // id of the bot's message which is waiting for a time (eg. of /clone or clarification)
+
+	Email string // address for email fallback, when reminders cannot be delivered on telegram
+
+	NoPromptStorage bool // do not save the texts of prompts of this chat (set with `/privacy off`)
+
+	DatetimeFormat string // name of the datetime format for displaying, eg. "dmy12" (default if empty)
+
+	OnboardingStep int // step of onboarding on /start
+
+	ReminderPrefix *string // prepended to delivered reminders, eg. "⏰ Reminder:" (config's default if nil, none if empty)
+
+	// location of the chat (shared by the user), for times relative to the sun (eg. "at sunset")
+	Latitude  *float64
+	Longitude *float64
+
+	Channels   string // extra channels for delivering reminders besides telegram, comma-separated (eg. "email,webhook")
+	WebhookURL string // url for the webhook channel
+
+	WeekStart string // first day of weeks, "sunday" or "monday" (default if empty)
+
+	ICalToken string `gorm:"column:ical_token;index"` // token in the url of the chat's iCalendar feed (`/ical feed`), none if empty
+
+	ActiveHours string // window of the day for re-notifying escalated reminders, eg. "09:00-18:00" (any time if empty)
+
+	BotID int64 `gorm:"uniqueIndex:idx_chat_settings1;default:0"` // id of the bot for which these settings are (when running multiple bots)
+}
+
+// ChannelDelivery is a struct for delivering a (delivered) queue item to an extra channel (eg. email, webhook),
+// which is retried independently of telegram
+type ChannelDelivery struct {
+	gorm.Model
+
+	ID          int64
+	ChatID      int64      `gorm:"index"`
+	QueueItemID int64      `gorm:"uniqueIndex:idx_channel_deliveries1"`
+	Channel     string     `gorm:"uniqueIndex:idx_channel_deliveries1"` // eg. "email", "webhook"
+	DeliveredOn *time.Time `gorm:"index"`
+	NumTries    int
+	FailedOn    *time.Time `gorm:"index"` // set when it cannot be delivered anymore (eg. the channel is not configured)
+	FailReason  string     // (also the reason of the latest failed try)
+
+	BotID int64 `gorm:"index;default:0"` // id of the bot which will deliver it (when running multiple bots)
+}
+
+// DeliveryFeedback is a struct for user's feedback on a delivered reminder
+type DeliveryFeedback struct {
+	gorm.Model
+
+	ChatID      int64 `gorm:"index"`
+	QueueItemID int64 `gorm:"uniqueIndex"`
+	UserID      int64
+	Helpful     bool
+}
+
+// Preset is a struct for reminder presets of each chat
+type Preset struct {
+	gorm.Model
+
+	ChatID int64  `gorm:"uniqueIndex:idx_presets2"`
+	Name   string `gorm:"uniqueIndex:idx_presets2"`
+	Text   string // will be parsed when used
+
+	BotID int64 `gorm:"uniqueIndex:idx_presets2;default:0"` // id of the bot on which it was saved (when running multiple bots)
+}
+
+// Alias is a struct for phrases of times defined by each chat (eg. "lunch" => "12:30")
+type Alias struct {
+	gorm.Model
+
+	ChatID int64  `gorm:"uniqueIndex:idx_aliases2"`
+	Phrase string `gorm:"uniqueIndex:idx_aliases2"` // lowercased
+	Time   string // time of the day, eg. "12:30"
+
+	BotID int64 `gorm:"uniqueIndex:idx_aliases2;default:0"` // id of the bot on which it was saved (when running multiple bots)
+}
+
+// UserAPIKey is a struct for users' own Google AI API keys
+type UserAPIKey struct {
+	gorm.Model
+
+	UserID       int64  `gorm:"uniqueIndex"`
+	EncryptedKey string // encrypted with the key derived from `encryption_key` of config
+}
+
+// EncryptionSalt is a struct for the salt of deriving keys from `encryption_key` of config
+type EncryptionSalt struct {
+	gorm.Model
+
+	Salt string // base64-encoded
+}
+
+// UserActivity is a struct for the last interactions of users with the bot
+type UserActivity struct {
+	gorm.Model
+
+	UserID     int64  `gorm:"uniqueIndex"`
+	Username   string // telegram username (without '@'), empty if not set
+	FirstName  string
+	LastSeenOn time.Time `gorm:"index"`
 }
 
 // Database struct
@@ -95,22 +285,405 @@ func OpenDatabase(dbPath string) (database *Database, err error) {
 			&ParsedItem{},
 			&QueueItem{},
 			&TemporaryMessage{},
+			&ChatSetting{},
+			&DeliveryFeedback{},
+			&Preset{},
+			&Alias{},
+			&UserAPIKey{},
+			&ChannelDelivery{},
+			&UserActivity{},
+			&EncryptionSalt{},
 		); err != nil {
 			log.Printf("failed to migrate databases: %s", err)
 		}
 
+		// migrate existing rows
+		if version, err := migrateSchema(db); err == nil {
+			log.Printf("database schema version: %d", version)
+		} else {
+			log.Printf("failed to migrate database schema: %s", err)
+		}
+
+		// scope rows by bot (when running multiple bots)
+		if err := errors.Join(
+			db.Callback().Query().Before("gorm:query").Register("scope_by_bot:query", scopeByBot),
+			db.Callback().Update().Before("gorm:update").Register("scope_by_bot:update", scopeByBot),
+			db.Callback().Delete().Before("gorm:delete").Register("scope_by_bot:delete", scopeByBot),
+		); err != nil {
+			log.Printf("failed to register callbacks: %s", err)
+		}
+
 		return &Database{db: db}, nil
 	}
 
 	return nil, err
 }
 
+// context key for the id of the bot which uses the database
+type dbBotIDKey struct{}
+
+// ForBot returns a copy of the database whose rows (eg. queue items, chat settings) are scoped to given bot,
+// so that multiple bots can share a database.
+//
+// (should be called after `SetEncryption`)
+func (d *Database) ForBot(botID int64) *Database {
+	return &Database{db: d.db.WithContext(context.WithValue(d.db.Statement.Context, dbBotIDKey{}, botID))}
+}
+
+// tables whose rows are scoped by bot
+var _botScopedTables = []string{
+	"queue_items",
+	"channel_deliveries",
+	"prompts",
+	"temporary_messages",
+	"chat_settings",
+	"presets",
+	"aliases",
+}
+
+// ClaimUnscopedRows assigns rows which are not scoped to any bot (eg. created before running multiple bots) to given bot,
+// and returns the number of claimed queue items.
+func (d *Database) ClaimUnscopedRows(botID int64) (count int64, err error) {
+	err = d.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{
+			&QueueItem{},
+			&ChannelDelivery{},
+			&Prompt{},
+			&TemporaryMessage{},
+			&ChatSetting{},
+			&Preset{},
+			&Alias{},
+		} {
+			res := tx.Unscoped().Model(model).Where("bot_id = 0").UpdateColumn("bot_id", botID)
+			if res.Error != nil {
+				return res.Error
+			}
+			if _, ok := model.(*QueueItem); ok {
+				count = res.RowsAffected
+			}
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// callback for scoping queries of rows (eg. queue items, chat settings) to the bot in the context
+func scopeByBot(tx *gorm.DB) {
+	botID, ok := tx.Statement.Context.Value(dbBotIDKey{}).(int64)
+	if !ok || tx.Statement.Schema == nil || !slices.Contains(_botScopedTables, tx.Statement.Schema.Table) {
+		return
+	}
+
+	tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "bot_id"}, Value: botID},
+	}})
+}
+
+// encryption settings of the database, passed to the hooks of models through the context
+type dbEncryption struct {
+	keys    cipherKeys
+	encrypt bool // if false, new values are saved in plaintext (already-encrypted ones are still decrypted)
+}
+
+// context key for `dbEncryption`
+type dbEncryptionKey struct{}
+
+// encrypted columns of models (with `encrypt_messages`)
+var _encryptedColumns = []struct {
+	model  any
+	column string
+}{
+	{&QueueItem{}, "message"},
+	{&TemporaryMessage{}, "message"},
+	{&Prompt{}, "text"},
+}
+
+// SetEncryption sets the passphrase for encrypting/decrypting messages of queue items, temporary messages, and texts of prompts at rest.
+//
+// Values encrypted with the legacy key (sha256 of the passphrase) are encrypted again with the key derived with scrypt.
+// If `enable` is true, existing plaintext values will also be encrypted. The number of encrypted values will be returned.
+func (d *Database) SetEncryption(passphrase string, enable bool) (migrated int64, err error) {
+	salt, err := d.encryptionSalt()
+	if err != nil {
+		return 0, err
+	}
+	keys, err := newCipherKeys(passphrase, salt)
+	if err != nil {
+		return 0, err
+	}
+
+	d.db = d.db.WithContext(context.WithValue(d.db.Statement.Context, dbEncryptionKey{}, dbEncryption{
+		keys:    keys,
+		encrypt: enable,
+	}))
+
+	// encrypt existing values (including soft-deleted ones)
+	err = d.db.Transaction(func(tx *gorm.DB) error {
+		for _, c := range _encryptedColumns {
+			// (legacy ones, and plaintext ones if enabled)
+			where := fmt.Sprintf("(%[1]s like @encrypted and %[1]s not like @current)", c.column)
+			if enable {
+				where += fmt.Sprintf(" or (%[1]s != '' and %[1]s not like @encrypted)", c.column)
+			}
+			args := map[string]any{
+				"encrypted": encryptedPrefix + "%",
+				"current":   encryptedPrefix + cipherVersionPrefix + "%",
+			}
+
+			var rows []struct {
+				ID    int64
+				Value string
+			}
+			if res := tx.Unscoped().Model(c.model).Select("id, "+c.column+" as value").Where(where, args).Find(&rows); res.Error != nil {
+				return res.Error
+			}
+
+			for _, row := range rows {
+				value := row.Value
+				if encrypted, found := strings.CutPrefix(value, encryptedPrefix); found {
+					if !isLegacyCiphertext(encrypted) {
+						continue
+					}
+					if value, err = keys.decrypt(encrypted); err != nil {
+						return err
+					}
+				}
+
+				encrypted, err := keys.encrypt(value)
+				if err != nil {
+					return err
+				}
+
+				// (not to run hooks again)
+				if res := tx.Unscoped().Model(c.model).Where("id = ?", row.ID).UpdateColumn(c.column, encryptedPrefix+encrypted); res.Error != nil {
+					return res.Error
+				}
+				migrated++
+			}
+		}
+
+		// (tags are not saved with encrypted messages, so remove the ones saved before)
+		if enable {
+			if res := tx.Unscoped().Model(&QueueItem{}).Where("tags != ''").UpdateColumn("tags", ""); res.Error != nil {
+				return res.Error
+			}
+		}
+
+		// users' API keys which were encrypted with the legacy key
+		var apiKeys []UserAPIKey
+		if res := tx.Unscoped().Where("encrypted_key != '' and encrypted_key not like ?", cipherVersionPrefix+"%").Find(&apiKeys); res.Error != nil {
+			return res.Error
+		}
+		for _, apiKey := range apiKeys {
+			decrypted, err := keys.decrypt(apiKey.EncryptedKey)
+			if err != nil {
+				return err
+			}
+			encrypted, err := keys.encrypt(decrypted)
+			if err != nil {
+				return err
+			}
+
+			if res := tx.Unscoped().Model(&UserAPIKey{}).Where("id = ?", apiKey.ID).UpdateColumn("encrypted_key", encrypted); res.Error != nil {
+				return res.Error
+			}
+			migrated++
+		}
+
+		return nil
+	})
+
+	return migrated, err
+}
+
+// get the salt for deriving keys, or generate and save a new one if there is none yet
+func (d *Database) encryptionSalt() (salt []byte, err error) {
+	var saved EncryptionSalt
+	if res := d.db.Order("id").Limit(1).Find(&saved); res.Error != nil {
+		return nil, res.Error
+	} else if res.RowsAffected > 0 {
+		return base64.StdEncoding.DecodeString(saved.Salt)
+	}
+
+	if salt, err = newSalt(); err != nil {
+		return nil, err
+	}
+	if res := d.db.Create(&EncryptionSalt{Salt: base64.StdEncoding.EncodeToString(salt)}); res.Error != nil {
+		return nil, res.Error
+	}
+
+	return salt, nil
+}
+
+// Encrypt encrypts given plaintext with the keys of the database (eg. users' API keys).
+func (d *Database) Encrypt(plaintext string) (string, error) {
+	enc, ok := d.db.Statement.Context.Value(dbEncryptionKey{}).(dbEncryption)
+	if !ok {
+		return "", fmt.Errorf("failed to encrypt: encryption key is not set")
+	}
+
+	return enc.keys.encrypt(plaintext)
+}
+
+// Decrypt decrypts given ciphertext (generated by `Encrypt`) with the keys of the database.
+func (d *Database) Decrypt(ciphertext string) (string, error) {
+	enc, ok := d.db.Statement.Context.Value(dbEncryptionKey{}).(dbEncryption)
+	if !ok {
+		return "", fmt.Errorf("failed to decrypt: encryption key is not set")
+	}
+
+	return enc.keys.decrypt(ciphertext)
+}
+
+// check if fields are encrypted on save
+func encryptsFields(tx *gorm.DB) bool {
+	enc, ok := tx.Statement.Context.Value(dbEncryptionKey{}).(dbEncryption)
+	return ok && enc.encrypt
+}
+
+// encrypt given field in place, if encryption is enabled
+func encryptField(tx *gorm.DB, field *string) error {
+	enc, ok := tx.Statement.Context.Value(dbEncryptionKey{}).(dbEncryption)
+	if !ok || !enc.encrypt || *field == "" || strings.HasPrefix(*field, encryptedPrefix) {
+		return nil
+	}
+
+	encrypted, err := enc.keys.encrypt(*field)
+	if err != nil {
+		return err
+	}
+	*field = encryptedPrefix + encrypted
+
+	return nil
+}
+
+// decrypt given field in place, if it was encrypted
+func decryptField(tx *gorm.DB, field *string) error {
+	if !strings.HasPrefix(*field, encryptedPrefix) {
+		return nil
+	}
+
+	enc, ok := tx.Statement.Context.Value(dbEncryptionKey{}).(dbEncryption)
+	if !ok {
+		return fmt.Errorf("failed to decrypt: encryption key is not set")
+	}
+
+	decrypted, err := enc.keys.decrypt(strings.TrimPrefix(*field, encryptedPrefix))
+	if err != nil {
+		return err
+	}
+	*field = decrypted
+
+	return nil
+}
+
+// set given bot id of a row to the bot in the context, if it is not set yet
+func scopeToBot(tx *gorm.DB, botID *int64) {
+	if id, ok := tx.Statement.Context.Value(dbBotIDKey{}).(int64); ok && *botID == 0 {
+		*botID = id
+	}
+}
+
+// BeforeSave is a hook for scoping a queue item to the bot in the context, extracting tags from its message, and encrypting its message.
+func (q *QueueItem) BeforeSave(tx *gorm.DB) error {
+	scopeToBot(tx, &q.BotID)
+	if q.Tags == "" && !strings.HasPrefix(q.Message, encryptedPrefix) && !encryptsFields(tx) { // (not to leak tags of encrypted messages)
+		q.Tags = joinTags(extractTags(q.Message))
+	}
+
+	return encryptField(tx, &q.Message)
+}
+
+// AfterSave is a hook for decrypting the message of a saved queue item back.
+func (q *QueueItem) AfterSave(tx *gorm.DB) error {
+	return decryptField(tx, &q.Message)
+}
+
+// AfterFind is a hook for decrypting the message of a queue item.
+func (q *QueueItem) AfterFind(tx *gorm.DB) error {
+	return decryptField(tx, &q.Message)
+}
+
+// BeforeSave is a hook for scoping a channel delivery to the bot in the context.
+func (c *ChannelDelivery) BeforeSave(tx *gorm.DB) error {
+	scopeToBot(tx, &c.BotID)
+
+	return nil
+}
+
+// BeforeSave is a hook for scoping a temporary message to the bot in the context, and encrypting its message.
+func (t *TemporaryMessage) BeforeSave(tx *gorm.DB) error {
+	scopeToBot(tx, &t.BotID)
+
+	return encryptField(tx, &t.Message)
+}
+
+// AfterSave is a hook for decrypting the message of a saved temporary message back.
+func (t *TemporaryMessage) AfterSave(tx *gorm.DB) error {
+	return decryptField(tx, &t.Message)
+}
+
+// AfterFind is a hook for decrypting the message of a temporary message.
+func (t *TemporaryMessage) AfterFind(tx *gorm.DB) error {
+	return decryptField(tx, &t.Message)
+}
+
+// BeforeSave is a hook for scoping a prompt to the bot in the context, and encrypting its text.
+func (p *Prompt) BeforeSave(tx *gorm.DB) error {
+	scopeToBot(tx, &p.BotID)
+
+	return encryptField(tx, &p.Text)
+}
+
+// AfterSave is a hook for decrypting the text of a saved prompt back.
+func (p *Prompt) AfterSave(tx *gorm.DB) error {
+	return decryptField(tx, &p.Text)
+}
+
+// AfterFind is a hook for decrypting the text of a prompt.
+func (p *Prompt) AfterFind(tx *gorm.DB) error {
+	return decryptField(tx, &p.Text)
+}
+
+// BeforeSave is a hook for scoping chat settings to the bot in the context.
+func (s *ChatSetting) BeforeSave(tx *gorm.DB) error {
+	scopeToBot(tx, &s.BotID)
+
+	return nil
+}
+
+// BeforeSave is a hook for scoping a preset to the bot in the context.
+func (p *Preset) BeforeSave(tx *gorm.DB) error {
+	scopeToBot(tx, &p.BotID)
+
+	return nil
+}
+
+// BeforeSave is a hook for scoping an alias to the bot in the context.
+func (a *Alias) BeforeSave(tx *gorm.DB) error {
+	scopeToBot(tx, &a.BotID)
+
+	return nil
+}
+
 // SavePrompt saves `prompt`.
 func (d *Database) SavePrompt(prompt Prompt) (err error) {
 	tx := d.db.Save(&prompt)
 	return tx.Error
 }
 
+// RecentFailedParses fetches `latestN` number of latest prompts which failed to be parsed, with their results
+func (d *Database) RecentFailedParses(latestN int) (prompts []Prompt, err error) {
+	tx := d.db.Joins("Result").
+		Where("Result.successful = ?", false).
+		Order("prompts.id desc").
+		Limit(latestN).
+		Find(&prompts)
+
+	return prompts, tx.Error
+}
+
 // save log for given type and message
 func (d *Database) saveLog(typ, msg string) (err error) {
 	tx := d.db.Create(&Log{
@@ -139,6 +712,13 @@ func (d *Database) LogError(format string, v ...any) {
 	}
 }
 
+// PurgeLogs deletes logs which were saved before given time
+func (d *Database) PurgeLogs(before time.Time) (count int64, err error) {
+	res := d.db.Unscoped().Where("created_at < ?", before).Delete(&Log{}) // (not soft-deleted, for actually freeing up the space)
+
+	return res.RowsAffected, res.Error
+}
+
 // GetLogs fetches `latestN` number of latest logs
 func (d *Database) GetLogs(latestN int) (logs []Log, err error) {
 	tx := d.db.Order("id desc").Limit(latestN).Find(&logs)
@@ -147,13 +727,20 @@ func (d *Database) GetLogs(latestN int) (logs []Log, err error) {
 }
 
 // SaveTemporaryMessage saves a temporary message
-func (d *Database) SaveTemporaryMessage(chatID int64, messageID int64, message string) (result bool, err error) {
-	res := d.db.Create(&TemporaryMessage{
+func (d *Database) SaveTemporaryMessage(chatID int64, messageID int64, message string, silent bool) (result bool, err error) {
+	return d.SaveTemporaryItem(TemporaryMessage{
 		ChatID:    chatID,
 		MessageID: messageID,
 		Message:   message,
-		SavedOn:   time.Now(),
+		Silent:    silent,
 	})
+}
+
+// SaveTemporaryItem saves given temporary message (with its recurrence, if any)
+func (d *Database) SaveTemporaryItem(item TemporaryMessage) (result bool, err error) {
+	item.SavedOn = time.Now()
+
+	res := d.db.Create(&item)
 
 	return res.RowsAffected > 0, res.Error
 }
@@ -174,13 +761,56 @@ func (d *Database) DeleteTemporaryMessage(chatID int64, messageID int64) (result
 
 // Enqueue enques given message
 func (d *Database) Enqueue(chatID int64, messageID int64, message string, fireOn time.Time) (result bool, err error) {
-	res := d.db.Save(&QueueItem{
+	id, err := d.EnqueueItem(QueueItem{
 		ChatID:    chatID,
 		MessageID: messageID,
 		Message:   message,
 		FireOn:    fireOn,
 	})
 
+	return id > 0, err
+}
+
+// EnqueueItem enqueues given queue item, and returns its id
+func (d *Database) EnqueueItem(item QueueItem) (id int64, err error) {
+	res := d.db.Save(&item)
+
+	return item.ID, res.Error
+}
+
+// EnqueueItemIdempotently enqueues given item and returns it, or returns the existing one if an item with the same idempotency key
+// was already enqueued in the chat (including canceled ones)
+func (d *Database) EnqueueItemIdempotently(item QueueItem) (result QueueItem, existed bool, err error) {
+	if item.IdempotencyKey == nil {
+		item.ID, err = d.EnqueueItem(item)
+		return item, false, err
+	}
+
+	res := d.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&item)
+	if res.Error != nil {
+		return item, false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return item, false, nil
+	}
+
+	res = d.db.Unscoped().Where("chat_id = ? and idempotency_key = ?", item.ChatID, *item.IdempotencyKey).First(&result)
+
+	return result, true, res.Error
+}
+
+// EnqueueUndated enqueues given message without datetime, which will not be delivered until scheduled
+func (d *Database) EnqueueUndated(chatID int64, messageID int64, messageThreadID int64, message string, createdBy int64) (result bool, err error) {
+	res := d.db.Omit("fire_on").Create(&QueueItem{
+		ChatID:          chatID,
+		MessageID:       messageID,
+		MessageThreadID: messageThreadID,
+		Message:         message,
+		Undated:         true,
+		Source:          sourceMessage,
+		CreatedBy:       createdBy,
+	})
+
 	return res.RowsAffected > 0, res.Error
 }
 
@@ -190,18 +820,205 @@ func (d *Database) DeliverableQueueItems(maxNumTries int) (result []QueueItem, e
 		maxNumTries = DefaultMaxNumTries
 	}
 
-	res := d.db.Order("enqueued_on desc").Where("delivered_on is null and num_tries < ? and fire_on <= ?", maxNumTries, time.Now()).Find(&result)
+	res := d.db.Order("enqueued_on desc").
+		Where("delivered_on is null and failed_on is null and num_tries < ? and fire_on <= ?", maxNumTries, time.Now()).
+		Where("chat_id not in (?)", d.suspendedChatIDs()).
+		Find(&result)
 
 	return result, res.Error
 }
 
+// ExhaustedQueueItems fetches all undelivered items from the queue which reached the maximum number of tries.
+func (d *Database) ExhaustedQueueItems(maxNumTries int) (result []QueueItem, err error) {
+	if maxNumTries <= 0 {
+		maxNumTries = DefaultMaxNumTries
+	}
+
+	res := d.db.Order("id asc").
+		Where("delivered_on is null and failed_on is null and num_tries >= ?", maxNumTries).
+		Find(&result)
+
+	return result, res.Error
+}
+
+// MissedQueueItems fetches all undelivered items from the queue which were due before given time: `before`.
+func (d *Database) MissedQueueItems(maxNumTries int, before time.Time) (result []QueueItem, err error) {
+	if maxNumTries <= 0 {
+		maxNumTries = DefaultMaxNumTries
+	}
+
+	res := d.db.Order("fire_on asc").
+		Where("delivered_on is null and failed_on is null and num_tries < ? and fire_on < ?", maxNumTries, before).
+		Where("chat_id not in (?)", d.suspendedChatIDs()).
+		Find(&result)
+
+	return result, res.Error
+}
+
+// subquery for ids of suspended (paused or blocked) chats
+func (d *Database) suspendedChatIDs() *gorm.DB {
+	return d.db.Model(&ChatSetting{}).Select("chat_id").Where("paused = ? or blocked = ?", true, true)
+}
+
+// UnblockChat resets the blocked state of given chat, and returns if it was blocked.
+func (d *Database) UnblockChat(chatID int64) (result bool, err error) {
+	res := d.db.Model(&ChatSetting{}).Where("chat_id = ? and blocked = ?", chatID, true).Update("blocked", false)
+
+	return res.RowsAffected > 0, res.Error
+}
+
 // UndeliveredQueueItems fetches all undelivered items from the queue.
 func (d *Database) UndeliveredQueueItems(chatID int64) (result []QueueItem, err error) {
-	res := d.db.Order("fire_on asc").Where("chat_id = ? and delivered_on is null", chatID).Find(&result)
+	return d.SortedUndeliveredQueueItems(chatID, "fire_on asc")
+}
+
+// DeliveredQueueItems fetches delivered items of given chat from the queue, from the latest one (skipping `offset` ones, at most `limit` ones).
+func (d *Database) DeliveredQueueItems(chatID int64, limit, offset int) (result []QueueItem, err error) {
+	res := d.db.Order("delivered_on desc").Order("id desc").
+		Where("chat_id = ? and delivered_on is not null and milestone_of = 0", chatID).
+		Offset(offset).
+		Limit(limit).
+		Find(&result)
+
+	return result, res.Error
+}
+
+// CancelableQueueItems fetches all undelivered items of given chat from the queue, including undated ones (after the dated ones).
+func (d *Database) CancelableQueueItems(chatID int64) (result []QueueItem, err error) {
+	if result, err = d.UndeliveredQueueItems(chatID); err != nil {
+		return nil, err
+	}
+
+	undated, err := d.UndatedQueueItems(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(result, undated...), nil
+}
+
+// UndeliveredQueueItemsMatching fetches all undelivered items (including undated ones) from the queue whose messages contain given filter
+// (case-insensitive, all if empty).
+func (d *Database) UndeliveredQueueItemsMatching(chatID int64, filter string) (result []QueueItem, err error) {
+	items, err := d.CancelableQueueItems(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	// (encrypted messages cannot be matched in the database)
+	filter = strings.ToLower(filter)
+	result = []QueueItem{}
+	for _, item := range items {
+		if strings.Contains(strings.ToLower(item.Message), filter) {
+			result = append(result, item)
+		}
+	}
+
+	return result, nil
+}
+
+// QueueItemsByTag fetches all undelivered items of given chat from the queue which have given tag (eg. "work"), sorted in given order.
+func (d *Database) QueueItemsByTag(chatID int64, tag string, order string) (result []QueueItem, err error) {
+	items, err := d.SortedUndeliveredQueueItems(chatID, order)
+	if err != nil {
+		return nil, err
+	}
+
+	tag = normalizeTag(tag)
+	result = []QueueItem{}
+	for _, item := range items {
+		// (tags are not saved with encrypted messages, so extract them from the decrypted ones)
+		tags := strings.Split(item.Tags, ",")
+		if item.Tags == "" {
+			tags = extractTags(item.Message)
+		}
+
+		if slices.Contains(tags, tag) {
+			result = append(result, item)
+		}
+	}
+
+	return result, nil
+}
+
+// DeleteQueueItemsMatching deletes all undelivered queue items (and their milestones) whose messages contain given filter
+// (case-insensitive, all if empty), and returns the number of deleted ones.
+func (d *Database) DeleteQueueItemsMatching(chatID int64, filter string) (count int64, err error) {
+	items, err := d.UndeliveredQueueItemsMatching(chatID, filter)
+	if err != nil || len(items) <= 0 {
+		return 0, err
+	}
+
+	ids := []int64{}
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+
+	if res := d.db.Where("chat_id = ? and milestone_of in ?", chatID, ids).Delete(&QueueItem{}); res.Error != nil {
+		return 0, res.Error
+	}
+	res := d.db.Where("chat_id = ? and id in ?", chatID, ids).Delete(&QueueItem{})
+
+	return res.RowsAffected, res.Error
+}
+
+// SortedUndeliveredQueueItems fetches all undelivered items from the queue, in given order (eg. "fire_on asc").
+func (d *Database) SortedUndeliveredQueueItems(chatID int64, order string) (result []QueueItem, err error) {
+	res := d.db.Order(order).Where("chat_id = ? and delivered_on is null and failed_on is null and undated = ? and milestone_of = 0", chatID, false).Find(&result)
+
+	// encrypted messages cannot be sorted in the database
+	if res.Error == nil && strings.HasPrefix(order, "message ") {
+		desc := strings.HasSuffix(order, " desc")
+		sort.SliceStable(result, func(i, j int) bool {
+			if desc {
+				return result[i].Message > result[j].Message
+			}
+			return result[i].Message < result[j].Message
+		})
+	}
 
 	return result, res.Error
 }
 
+// UndatedQueueItems fetches all undated (not scheduled yet) items of given chat from the queue.
+func (d *Database) UndatedQueueItems(chatID int64) (result []QueueItem, err error) {
+	res := d.db.Order("id asc").Where("chat_id = ? and delivered_on is null and failed_on is null and undated = ?", chatID, true).Find(&result)
+
+	return result, res.Error
+}
+
+// ScheduleQueueItem sets the datetime of a queue item, and moves its undelivered milestones to the new time (with their offsets).
+func (d *Database) ScheduleQueueItem(chatID, queueID int64, fireOn time.Time) (result bool, err error) {
+	err = d.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&QueueItem{}).Where("id = ? and chat_id = ?", queueID, chatID).Updates(map[string]any{
+			"fire_on": fireOn,
+			"undated": false,
+		})
+		if res.Error != nil || res.RowsAffected <= 0 {
+			return res.Error
+		}
+		result = true
+
+		var milestones []QueueItem
+		if res := tx.Where("milestone_of = ? and chat_id = ? and delivered_on is null", queueID, chatID).Find(&milestones); res.Error != nil {
+			return res.Error
+		}
+		if len(milestones) <= 0 {
+			return nil
+		}
+
+		offsets := []time.Duration{}
+		for _, m := range milestones {
+			offsets = append(offsets, time.Duration(m.MilestoneOffsetSeconds)*time.Second)
+		}
+
+		_, err := setMilestones(tx, chatID, queueID, offsets)
+		return err
+	})
+
+	return result, err
+}
+
 // GetQueueItem fetches a queue item
 func (d *Database) GetQueueItem(chatID, queueID int64) (result QueueItem, err error) {
 	res := d.db.Where("id = ? and chat_id = ?", queueID, chatID).First(&result)
@@ -209,13 +1026,93 @@ func (d *Database) GetQueueItem(chatID, queueID int64) (result QueueItem, err er
 	return result, res.Error
 }
 
-// DeleteQueueItem deletes a queue item
+// GetDeliveredQueueItem fetches a delivered queue item with the id of its delivered message
+func (d *Database) GetDeliveredQueueItem(chatID, deliveredMessageID int64) (result QueueItem, err error) {
+	res := d.db.Where("chat_id = ? and delivered_message_id = ? and delivered_on is not null", chatID, deliveredMessageID).First(&result)
+
+	return result, res.Error
+}
+
+// DeleteQueueItem deletes a queue item (and its milestones)
 func (d *Database) DeleteQueueItem(chatID, queueID int64) (result bool, err error) {
-	res := d.db.Where("id = ? and chat_id = ?", queueID, chatID).Delete(&QueueItem{})
+	res := d.db.Where("(id = ? or milestone_of = ?) and chat_id = ?", queueID, queueID, chatID).Delete(&QueueItem{})
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// SetMilestones replaces undelivered milestones of a queue item with new ones at given offsets,
+// and returns the number of milestones created (past ones are not created)
+func (d *Database) SetMilestones(chatID, queueID int64, offsets []time.Duration) (created int, err error) {
+	err = d.db.Transaction(func(tx *gorm.DB) error {
+		created, err = setMilestones(tx, chatID, queueID, offsets)
+		return err
+	})
+
+	return created, err
+}
+
+// SetEscalation sets the interval of re-notifications of a queue item (0 for not escalating it).
+func (d *Database) SetEscalation(chatID, queueID int64, minutes int) (result bool, err error) {
+	res := d.db.Model(&QueueItem{}).Where("id = ? and chat_id = ?", queueID, chatID).Update("escalate_minutes", minutes)
 
 	return res.RowsAffected > 0, res.Error
 }
 
+// AcknowledgeQueueItem deletes undelivered re-notifications of a queue item (or of its original one, if it is a re-notification),
+// and returns the number of deleted ones.
+func (d *Database) AcknowledgeQueueItem(chatID, queueID int64) (count int64, err error) {
+	var item QueueItem
+	if res := d.db.Where("id = ? and chat_id = ?", queueID, chatID).First(&item); res.Error != nil {
+		return 0, res.Error
+	}
+
+	escalationOf := item.EscalationOf
+	if escalationOf == 0 {
+		escalationOf = item.ID
+	}
+
+	res := d.db.Where("chat_id = ? and escalation_of = ? and delivered_on is null", chatID, escalationOf).Delete(&QueueItem{})
+
+	return res.RowsAffected, res.Error
+}
+
+// replace undelivered milestones of given queue item with new ones of given offsets (in a transaction)
+func setMilestones(tx *gorm.DB, chatID, queueID int64, offsets []time.Duration) (created int, err error) {
+	var item QueueItem
+	if res := tx.Where("id = ? and chat_id = ?", queueID, chatID).First(&item); res.Error != nil {
+		return 0, res.Error
+	}
+
+	if res := tx.Where("milestone_of = ? and chat_id = ? and delivered_on is null", queueID, chatID).Delete(&QueueItem{}); res.Error != nil {
+		return 0, res.Error
+	}
+
+	now := time.Now()
+	for _, offset := range offsets {
+		fireOn := item.FireOn.Add(-offset)
+		if fireOn.Before(now) {
+			continue
+		}
+
+		if res := tx.Create(&QueueItem{
+			ChatID:                 item.ChatID,
+			MessageID:              item.MessageID,
+			MessageThreadID:        item.MessageThreadID,
+			Message:                item.Message,
+			FireOn:                 fireOn,
+			MilestoneOf:            item.ID,
+			MilestoneOffsetSeconds: int64(offset.Seconds()),
+			Source:                 sourceMilestone,
+			CreatedBy:              item.CreatedBy,
+		}); res.Error != nil {
+			return created, res.Error
+		}
+		created++
+	}
+
+	return created, nil
+}
+
 // IncreaseNumTries increases the number of tries of a queue item
 func (d *Database) IncreaseNumTries(chatID, queueID int64) (result bool, err error) {
 	res := d.db.Model(&QueueItem{}).Where("id = ? and chat_id = ?", queueID, chatID).Update("num_tries", gorm.Expr("num_tries + 1"))
@@ -223,9 +1120,322 @@ func (d *Database) IncreaseNumTries(chatID, queueID int64) (result bool, err err
 	return res.RowsAffected > 0, res.Error
 }
 
-// MarkQueueItemAsDelivered makes a queue item as delivered
-func (d *Database) MarkQueueItemAsDelivered(chatID, queueID int64) (result bool, err error) {
-	res := d.db.Model(&QueueItem{}).Where("id = ? and chat_id = ?", queueID, chatID).Update("delivered_on", time.Now())
+// MarkQueueItemAsDelivered makes a queue item as delivered with the id of delivered message
+func (d *Database) MarkQueueItemAsDelivered(chatID, queueID, deliveredMessageID int64) (result bool, err error) {
+	res := d.db.Model(&QueueItem{}).Where("id = ? and chat_id = ?", queueID, chatID).Updates(map[string]any{
+		"delivered_on":         time.Now(),
+		"delivered_message_id": deliveredMessageID,
+	})
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// EnqueueChannelDeliveries enqueues deliveries of given queue item to given channels (existing ones are ignored)
+func (d *Database) EnqueueChannelDeliveries(chatID, queueID int64, channels []string) (err error) {
+	for _, channel := range channels {
+		if res := d.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&ChannelDelivery{
+			ChatID:      chatID,
+			QueueItemID: queueID,
+			Channel:     channel,
+		}); res.Error != nil {
+			err = errors.Join(err, res.Error)
+		}
+	}
+
+	return err
+}
+
+// PendingChannelDeliveries fetches channel deliveries which need to be (re)tried
+func (d *Database) PendingChannelDeliveries(maxNumTries int) (result []ChannelDelivery, err error) {
+	if maxNumTries <= 0 {
+		maxNumTries = DefaultMaxNumTries
+	}
+
+	res := d.db.Order("id").
+		Where("delivered_on is null and failed_on is null and num_tries < ?", maxNumTries).
+		Find(&result)
+
+	return result, res.Error
+}
+
+// MarkChannelDeliveryAsDelivered marks a channel delivery as delivered
+func (d *Database) MarkChannelDeliveryAsDelivered(id int64) (result bool, err error) {
+	res := d.db.Model(&ChannelDelivery{}).Where("id = ?", id).Update("delivered_on", time.Now())
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// IncreaseChannelDeliveryNumTries increases the number of tries of a channel delivery, with the reason of its failure
+func (d *Database) IncreaseChannelDeliveryNumTries(id int64, reason string) (result bool, err error) {
+	res := d.db.Model(&ChannelDelivery{}).Where("id = ?", id).Updates(map[string]any{
+		"num_tries":   gorm.Expr("num_tries + 1"),
+		"fail_reason": reason,
+	})
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// MarkChannelDeliveryAsFailed marks a channel delivery as failed, so that it will not be tried anymore
+func (d *Database) MarkChannelDeliveryAsFailed(id int64, reason string) (result bool, err error) {
+	res := d.db.Model(&ChannelDelivery{}).Where("id = ?", id).Updates(map[string]any{
+		"failed_on":   time.Now(),
+		"fail_reason": reason,
+	})
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// MarkQueueItemAsEmailed marks a queue item as delivered by email fallback
+func (d *Database) MarkQueueItemAsEmailed(chatID, queueID int64) (result bool, err error) {
+	res := d.db.Model(&QueueItem{}).Where("id = ? and chat_id = ?", queueID, chatID).Update("emailed_on", time.Now())
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// MarkQueueItemAsFailed marks a queue item as failed, so that it will not be delivered anymore
+func (d *Database) MarkQueueItemAsFailed(chatID, queueID int64, reason string) (result bool, err error) {
+	res := d.db.Model(&QueueItem{}).Where("id = ? and chat_id = ?", queueID, chatID).Updates(map[string]any{
+		"failed_on":   time.Now(),
+		"fail_reason": reason,
+	})
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// MarkUndeliveredQueueItemsAsFailed marks all undelivered queue items of given chat as failed
+func (d *Database) MarkUndeliveredQueueItemsAsFailed(chatID int64, reason string) (result bool, err error) {
+	res := d.db.Model(&QueueItem{}).Where("chat_id = ? and delivered_on is null and failed_on is null", chatID).Updates(map[string]any{
+		"failed_on":   time.Now(),
+		"fail_reason": reason,
+	})
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// DeleteDeliveredItems (soft-)deletes all delivered items of given chat, and returns the number of deleted ones.
+func (d *Database) DeleteDeliveredItems(chatID int64) (count int64, err error) {
+	res := d.db.Where("chat_id = ? and delivered_on is not null", chatID).Delete(&QueueItem{})
+
+	return res.RowsAffected, res.Error
+}
+
+// DeleteAllUserData deletes (not soft-deletes) all data of given chat: reminders, temporary messages, prompts (with their results),
+// settings, presets, aliases, and feedbacks, in a transaction, and returns the number of deleted rows.
+//
+// Data of given user (API key and activity) are also deleted, if `userID` is not 0.
+//
+// (when scoped to a bot, only the chat's data on the bot are deleted)
+func (d *Database) DeleteAllUserData(chatID, userID int64) (count int64, err error) {
+	err = d.db.Transaction(func(tx *gorm.DB) error {
+		// (results of prompts and feedbacks of reminders, before the prompts and reminders)
+		prompts := tx.Unscoped().Model(&Prompt{}).Select("id").Where("chat_id = ?", chatID)
+		res := tx.Unscoped().Where("prompt_id in (?)", prompts).Delete(&ParsedItem{})
+		if res.Error != nil {
+			return res.Error
+		}
+		count += res.RowsAffected
+
+		items := tx.Unscoped().Model(&QueueItem{}).Select("id").Where("chat_id = ?", chatID)
+		res = tx.Unscoped().Where("queue_item_id in (?)", items).Delete(&DeliveryFeedback{})
+		if res.Error != nil {
+			return res.Error
+		}
+		count += res.RowsAffected
+
+		for _, model := range []any{
+			&ChannelDelivery{},
+			&QueueItem{},
+			&TemporaryMessage{},
+			&Prompt{},
+			&Preset{},
+			&Alias{},
+			&ChatSetting{},
+		} {
+			res := tx.Unscoped().Where("chat_id = ?", chatID).Delete(model)
+			if res.Error != nil {
+				return res.Error
+			}
+			count += res.RowsAffected
+		}
+
+		if userID != 0 {
+			for _, model := range []any{
+				&UserAPIKey{},
+				&UserActivity{},
+			} {
+				res := tx.Unscoped().Where("user_id = ?", userID).Delete(model)
+				if res.Error != nil {
+					return res.Error
+				}
+				count += res.RowsAffected
+			}
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// SavePreset saves (or replaces) a preset of given chat.
+func (d *Database) SavePreset(chatID int64, name, text string) (result bool, err error) {
+	var preset Preset
+	if res := d.db.Where(Preset{ChatID: chatID, Name: name}).FirstOrCreate(&preset); res.Error != nil {
+		return false, res.Error
+	}
+
+	res := d.db.Model(&preset).Update("text", text)
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// GetPreset fetches a preset of given chat with its name.
+func (d *Database) GetPreset(chatID int64, name string) (result Preset, err error) {
+	res := d.db.Where("chat_id = ? and name = ?", chatID, name).First(&result)
+
+	return result, res.Error
+}
+
+// ListPresets fetches all presets of given chat.
+func (d *Database) ListPresets(chatID int64) (result []Preset, err error) {
+	res := d.db.Order("name asc").Where("chat_id = ?", chatID).Find(&result)
+
+	return result, res.Error
+}
+
+// DeletePreset deletes a preset of given chat with its name.
+func (d *Database) DeletePreset(chatID int64, name string) (result bool, err error) {
+	res := d.db.Unscoped().Where("chat_id = ? and name = ?", chatID, name).Delete(&Preset{}) // (not soft-deleted, for saving one with the same name again)
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// SaveAlias saves (or replaces) an alias of given chat.
+func (d *Database) SaveAlias(chatID int64, phrase, tm string) (result bool, err error) {
+	var alias Alias
+	if res := d.db.Where(Alias{ChatID: chatID, Phrase: phrase}).FirstOrCreate(&alias); res.Error != nil {
+		return false, res.Error
+	}
+
+	res := d.db.Model(&alias).Update("time", tm)
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// ListAliases fetches all aliases of given chat.
+func (d *Database) ListAliases(chatID int64) (result []Alias, err error) {
+	res := d.db.Order("phrase asc").Where("chat_id = ?", chatID).Find(&result)
+
+	return result, res.Error
+}
+
+// DeleteAlias deletes an alias of given chat with its phrase.
+func (d *Database) DeleteAlias(chatID int64, phrase string) (result bool, err error) {
+	res := d.db.Unscoped().Where("chat_id = ? and phrase = ?", chatID, phrase).Delete(&Alias{}) // (not soft-deleted, for saving one with the same phrase again)
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// SaveUserAPIKey saves (or replaces) the encrypted API key of given user.
+func (d *Database) SaveUserAPIKey(userID int64, encryptedKey string) (result bool, err error) {
+	var key UserAPIKey
+	if res := d.db.Where(UserAPIKey{UserID: userID}).FirstOrCreate(&key); res.Error != nil {
+		return false, res.Error
+	}
+
+	res := d.db.Model(&key).Update("encrypted_key", encryptedKey)
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// GetUserAPIKey fetches the encrypted API key of given user.
+func (d *Database) GetUserAPIKey(userID int64) (result UserAPIKey, err error) {
+	res := d.db.Where("user_id = ?", userID).First(&result)
+
+	return result, res.Error
+}
+
+// DeleteUserAPIKey deletes the API key of given user.
+func (d *Database) DeleteUserAPIKey(userID int64) (result bool, err error) {
+	res := d.db.Unscoped().Where("user_id = ?", userID).Delete(&UserAPIKey{}) // (not soft-deleted, for not leaving the key behind)
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// TouchUserActivity saves (or updates) the last interaction time of given user.
+func (d *Database) TouchUserActivity(userID int64, username, firstName string, seenOn time.Time) (result bool, err error) {
+	var activity UserActivity
+	if res := d.db.Where(UserActivity{UserID: userID}).FirstOrCreate(&activity); res.Error != nil {
+		return false, res.Error
+	}
+
+	res := d.db.Model(&activity).Updates(map[string]any{
+		"username":     username,
+		"first_name":   firstName,
+		"last_seen_on": seenOn,
+	})
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// UserActivities fetches the last interactions of all users, the most recent first.
+func (d *Database) UserActivities() (result []UserActivity, err error) {
+	res := d.db.Order("last_seen_on desc").Find(&result)
+
+	return result, res.Error
+}
+
+// IsNewChat checks if there is no row of given chat yet (settings, prompts, or reminders), eg. on its first message.
+func (d *Database) IsNewChat(chatID int64) (result bool, err error) {
+	for _, model := range []any{&ChatSetting{}, &Prompt{}, &QueueItem{}} {
+		var count int64
+		if res := d.db.Unscoped().Model(model).Where("chat_id = ?", chatID).Count(&count); res.Error != nil {
+			return false, res.Error
+		} else if count > 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// GetChatSetting fetches settings of given chat, or a default one if there is none yet.
+func (d *Database) GetChatSetting(chatID int64) (result ChatSetting, err error) {
+	res := d.db.Where(ChatSetting{ChatID: chatID}).FirstOrInit(&result)
+
+	return result, res.Error
+}
+
+// ChatSettingByICalToken fetches settings of the chat which has given token of its iCalendar feed.
+func (d *Database) ChatSettingByICalToken(token string) (result ChatSetting, err error) {
+	res := d.db.Where("ical_token = ? and ical_token <> ''", token).First(&result)
+
+	return result, res.Error
+}
+
+// UpdateChatSetting updates a column of given chat's settings, creating the settings row if needed.
+func (d *Database) UpdateChatSetting(chatID int64, column string, value any) (result bool, err error) {
+	var setting ChatSetting
+	if res := d.db.Where(ChatSetting{ChatID: chatID}).FirstOrCreate(&setting); res.Error != nil {
+		return false, res.Error
+	}
+
+	res := d.db.Model(&setting).Update(column, value)
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// SaveDeliveryFeedback saves (or replaces) the feedback on a delivered queue item.
+func (d *Database) SaveDeliveryFeedback(chatID, queueID, userID int64, helpful bool) (result bool, err error) {
+	var feedback DeliveryFeedback
+	if res := d.db.Where(DeliveryFeedback{QueueItemID: queueID}).Attrs(DeliveryFeedback{ChatID: chatID}).FirstOrCreate(&feedback); res.Error != nil {
+		return false, res.Error
+	}
+
+	res := d.db.Model(&feedback).Updates(map[string]any{
+		"user_id": userID,
+		"helpful": helpful,
+	})
 
 	return res.RowsAffected > 0, res.Error
 }
@@ -251,7 +1461,7 @@ func (d *Database) Stats() string {
 		Sum   int64
 		Count int64
 	}
-	if tx := d.db.Table("prompts").Select("sum(tokens) as sum, count(id) as count").Where("tokens > 0").Scan(&sumAndCount); tx.Error == nil {
+	if tx := d.db.Table("prompts").Select("coalesce(sum(tokens), 0) as sum, count(id) as count").Scan(&sumAndCount); tx.Error == nil {
 		lines = append(lines, fmt.Sprintf("* Prompts: <b>%s</b> (Total tokens: <b>%s</b>)", printer.Sprintf("%d", sumAndCount.Count), printer.Sprintf("%d", sumAndCount.Sum)))
 	}
 	if tx := d.db.Table("parsed_items").Select("sum(tokens) as sum, count(id) as count").Where("successful = 1").Scan(&sumAndCount); tx.Error == nil {
@@ -260,6 +1470,30 @@ func (d *Database) Stats() string {
 	if tx := d.db.Table("parsed_items").Select("count(id) as count").Where("successful = 0").Scan(&count); tx.Error == nil {
 		lines = append(lines, fmt.Sprintf("* Errors: <b>%s</b>", printer.Sprintf("%d", count)))
 	}
+	if tx := d.db.Table("parsed_items").Select("sum(retries) as sum, count(id) as count").Where("retries > 0").Scan(&sumAndCount); tx.Error == nil && sumAndCount.Count > 0 {
+		lines = append(lines, fmt.Sprintf("* Retried: <b>%s</b> (Total retries: <b>%s</b>)", printer.Sprintf("%d", sumAndCount.Count), printer.Sprintf("%d", sumAndCount.Sum)))
+	}
+	if tx := d.db.Table("queue_items").Select("count(id) as count").Where("failed_on is not null and deleted_at is null").Scan(&count); tx.Error == nil && count > 0 {
+		lines = append(lines, fmt.Sprintf("* Failed deliveries: <b>%s</b>", printer.Sprintf("%d", count)))
+	}
+	var sources []struct {
+		Source string
+		Count  int64
+	}
+	if tx := d.db.Table("queue_items").Select("source, count(id) as count").Where("milestone_of = 0").Group("source").Order("count desc").Scan(&sources); tx.Error == nil && len(sources) > 0 {
+		counts := []string{}
+		for _, s := range sources {
+			source := s.Source
+			if source == "" {
+				source = "unknown"
+			}
+			counts = append(counts, fmt.Sprintf("%s <b>%s</b>", source, printer.Sprintf("%d", s.Count)))
+		}
+		lines = append(lines, fmt.Sprintf("* Reminders by source: %s", strings.Join(counts, ", ")))
+	}
+	if tx := d.db.Table("delivery_feedbacks").Select("sum(helpful) as sum, count(id) as count").Where("deleted_at is null").Scan(&sumAndCount); tx.Error == nil && sumAndCount.Count > 0 {
+		lines = append(lines, fmt.Sprintf("* Feedbacks: <b>%s</b> (Helpful: <b>%.1f%%</b>)", printer.Sprintf("%d", sumAndCount.Count), float64(sumAndCount.Sum)*100/float64(sumAndCount.Count)))
+	}
 
 	if len(lines) > 0 {
 		return strings.Join(lines, "\n")
@@ -267,3 +1501,30 @@ func (d *Database) Stats() string {
 
 	return msgDatabaseEmpty
 }
+
+// DailyCount is a struct for the number of things on a day
+type DailyCount struct {
+	Day   string // yyyy-mm-dd
+	Count int64
+}
+
+// DailyReminderCounts retrieves the number of reminders created on each day, for the last `days` days including today,
+// of given chat (or of all chats if `chatID` is 0). Milestones are not counted, and days without any are omitted.
+func (d *Database) DailyReminderCounts(chatID int64, days int) (counts []DailyCount, err error) {
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day()-days+1, 0, 0, 0, 0, now.Location())
+
+	// (timestamps are saved with local time offsets, eg. '2024-12-25 15:00:00+09:00', so the first 10 characters are the local date)
+	tx := d.db.Model(&QueueItem{}).
+		Unscoped().
+		Select("substr(created_at, 1, 10) as day, count(id) as count").
+		Where("milestone_of = 0 and created_at >= ?", since)
+	if chatID != 0 {
+		tx = tx.Where("chat_id = ?", chatID)
+	}
+	tx = tx.Group("day").
+		Order("day").
+		Scan(&counts)
+
+	return counts, tx.Error
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"crypto/sha256"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// open a new database for testing
+func openTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+
+	return db
+}
+
+func TestSortedUndeliveredQueueItems(t *testing.T) {
+	db := openTestDatabase(t)
+
+	fireOn := time.Now().Add(time.Hour)
+	for _, item := range []QueueItem{
+		{ChatID: 10, Message: "b: created first, fired last", FireOn: fireOn.Add(time.Hour)},
+		{ChatID: 10, Message: "c: created second", FireOn: fireOn},
+		{ChatID: 10, Message: "a: created last", FireOn: fireOn.Add(time.Minute)},
+	} {
+		if _, err := db.EnqueueItem(item); err != nil {
+			t.Fatalf("failed to enqueue item: %s", err)
+		}
+	}
+
+	tests := []struct {
+		sortKey  string
+		expected []string
+	}{
+		{listSortFireOn, []string{"c: created second", "a: created last", "b: created first, fired last"}},
+		{listSortCreated, []string{"a: created last", "c: created second", "b: created first, fired last"}},
+		{listSortMessage, []string{"a: created last", "b: created first, fired last", "c: created second"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sortKey, func(t *testing.T) {
+			items, err := db.SortedUndeliveredQueueItems(10, listSortOrders[test.sortKey])
+			if err != nil {
+				t.Fatalf("failed to list items: %s", err)
+			}
+
+			messages := []string{}
+			for _, item := range items {
+				messages = append(messages, item.Message)
+			}
+			if !slices.Equal(messages, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, messages)
+			}
+		})
+	}
+}
+
+func TestScheduleQueueItemWithMilestones(t *testing.T) {
+	db := openTestDatabase(t)
+
+	fireOn := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+	id, err := db.EnqueueItem(QueueItem{ChatID: 10, Message: "exam", FireOn: fireOn})
+	if err != nil {
+		t.Fatalf("failed to enqueue item: %s", err)
+	}
+	if created, err := db.SetMilestones(10, id, []time.Duration{24 * time.Hour, time.Hour}); err != nil || created != 2 {
+		t.Fatalf("failed to set milestones: %d, %v", created, err)
+	}
+
+	// move it a day later
+	moved := fireOn.Add(24 * time.Hour)
+	if scheduled, err := db.ScheduleQueueItem(10, id, moved); err != nil || !scheduled {
+		t.Fatalf("failed to schedule item: %t, %v", scheduled, err)
+	}
+
+	if item, _ := db.GetQueueItem(10, id); !item.FireOn.Equal(moved) {
+		t.Errorf("expected the item on %s, got %s", moved, item.FireOn)
+	}
+
+	var milestones []QueueItem
+	if res := db.db.Where("milestone_of = ?", id).Order("fire_on asc").Find(&milestones); res.Error != nil {
+		t.Fatalf("failed to list milestones: %s", res.Error)
+	}
+	expected := []time.Time{moved.Add(-24 * time.Hour), moved.Add(-time.Hour)}
+	if len(milestones) != len(expected) {
+		t.Fatalf("expected %d milestones, got %d", len(expected), len(milestones))
+	}
+	for i, m := range milestones {
+		if !m.FireOn.Equal(expected[i]) {
+			t.Errorf("expected milestone on %s, got %s", expected[i], m.FireOn)
+		}
+	}
+
+	// (no such item)
+	if scheduled, err := db.ScheduleQueueItem(10, id+100, moved); err != nil || scheduled {
+		t.Errorf("expected nothing to be scheduled, got %t, %v", scheduled, err)
+	}
+}
+
+func TestSetEncryption(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+
+	const passphrase = "not so secret"
+
+	// (encrypted with the legacy key, before scrypt)
+	legacyKey := sha256.Sum256([]byte(passphrase))
+	legacyEncrypt := func(plaintext string) string {
+		encrypted, err := cipherKeys{key: legacyKey[:]}.encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("failed to encrypt: %s", err)
+		}
+		return strings.TrimPrefix(encrypted, cipherVersionPrefix)
+	}
+	legacy, legacyAPIKey := legacyEncrypt("legacy message"), legacyEncrypt("api key")
+
+	fireOn := time.Now().Add(time.Hour)
+	plainID, _ := db.EnqueueItem(QueueItem{ChatID: 10, Message: "plain message", FireOn: fireOn})
+	legacyItem := QueueItem{ChatID: 10, Message: encryptedPrefix + legacy, FireOn: fireOn}
+	if res := db.db.Session(&gorm.Session{SkipHooks: true}).Create(&legacyItem); res.Error != nil { // (not decryptable without the key yet)
+		t.Fatalf("failed to enqueue item: %s", res.Error)
+	}
+	legacyID := legacyItem.ID
+	if err := db.SavePrompt(Prompt{ChatID: 10, Text: "plain prompt"}); err != nil {
+		t.Fatalf("failed to save prompt: %s", err)
+	}
+	if _, err := db.SaveUserAPIKey(1, legacyAPIKey); err != nil {
+		t.Fatalf("failed to save api key: %s", err)
+	}
+
+	if migrated, err := db.SetEncryption(passphrase, true); err != nil {
+		t.Fatalf("failed to set encryption: %s", err)
+	} else if migrated != 4 {
+		t.Errorf("expected 4 values to be encrypted, got %d", migrated)
+	}
+
+	// new ones are encrypted too
+	if err := db.SavePrompt(Prompt{ChatID: 10, Text: "new prompt"}); err != nil {
+		t.Fatalf("failed to save prompt: %s", err)
+	}
+
+	// (encrypted at rest with the current key)
+	var values []string
+	db.db.Unscoped().Model(&QueueItem{}).Pluck("message", &values)
+	var texts []string
+	db.db.Unscoped().Model(&Prompt{}).Pluck("text", &texts)
+	for _, value := range append(values, texts...) {
+		if !strings.HasPrefix(value, encryptedPrefix+cipherVersionPrefix) {
+			t.Errorf("expected an encrypted value, got '%s'", value)
+		}
+	}
+	if saved, _ := db.GetUserAPIKey(1); !strings.HasPrefix(saved.EncryptedKey, cipherVersionPrefix) {
+		t.Errorf("expected the api key to be encrypted again, got '%s'", saved.EncryptedKey)
+	}
+
+	// (decrypted with the salt saved in the database, after reopened)
+	reopened, err := OpenDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	if migrated, err := reopened.SetEncryption(passphrase, true); err != nil {
+		t.Fatalf("failed to set encryption: %s", err)
+	} else if migrated != 0 {
+		t.Errorf("expected nothing to be encrypted again, got %d", migrated)
+	}
+
+	for id, expected := range map[int64]string{plainID: "plain message", legacyID: "legacy message"} {
+		if item, err := reopened.GetQueueItem(10, id); err != nil {
+			t.Errorf("failed to get item: %s", err)
+		} else if item.Message != expected {
+			t.Errorf("expected '%s', got '%s'", expected, item.Message)
+		}
+	}
+	var prompts []Prompt
+	reopened.db.Order("id").Find(&prompts)
+	if len(prompts) != 2 || prompts[0].Text != "plain prompt" || prompts[1].Text != "new prompt" {
+		t.Errorf("expected decrypted prompts, got %+v", prompts)
+	}
+	saved, _ := reopened.GetUserAPIKey(1)
+	if apiKey, err := reopened.Decrypt(saved.EncryptedKey); err != nil || apiKey != "api key" {
+		t.Errorf("expected the decrypted api key, got '%s' (%v)", apiKey, err)
+	}
+}
+
+func TestQueueItemsByTagWithEncryption(t *testing.T) {
+	db := openTestDatabase(t)
+
+	// (saved before encryption is enabled)
+	if _, err := db.EnqueueItem(QueueItem{ChatID: 10, Message: "water the plants #home", FireOn: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("failed to enqueue item: %s", err)
+	}
+
+	if _, err := db.SetEncryption("not so secret", true); err != nil {
+		t.Fatalf("failed to set encryption: %s", err)
+	}
+
+	for _, message := range []string{"call mom #home", "write a report #work"} {
+		if _, err := db.EnqueueItem(QueueItem{ChatID: 10, Message: message, FireOn: time.Now().Add(2 * time.Hour)}); err != nil {
+			t.Fatalf("failed to enqueue item: %s", err)
+		}
+	}
+
+	// (tags are not saved in plaintext)
+	var tags []string
+	db.db.Unscoped().Model(&QueueItem{}).Where("tags != ''").Pluck("tags", &tags)
+	if len(tags) > 0 {
+		t.Errorf("expected no saved tags, got %q", tags)
+	}
+
+	items, err := db.QueueItemsByTag(10, "#home", listSortOrders[listSortFireOn])
+	if err != nil {
+		t.Fatalf("failed to list items: %s", err)
+	}
+	messages := []string{}
+	for _, item := range items {
+		messages = append(messages, item.Message)
+	}
+	if expected := []string{"water the plants #home", "call mom #home"}; !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestDailyReminderCounts(t *testing.T) {
+	db := openTestDatabase(t)
+
+	fireOn := time.Now().Add(48 * time.Hour)
+	for _, chatID := range []int64{10, 10, 20} {
+		id, err := db.EnqueueItem(QueueItem{ChatID: chatID, Message: "exam", FireOn: fireOn})
+		if err != nil {
+			t.Fatalf("failed to enqueue item: %s", err)
+		}
+		if _, err := db.SetMilestones(chatID, id, []time.Duration{24 * time.Hour}); err != nil { // (not counted)
+			t.Fatalf("failed to set milestones: %s", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		chatID   int64
+		expected int64
+	}{
+		{"of a chat", 10, 2},
+		{"of another chat", 20, 1},
+		{"of all chats", 0, 3},
+		{"of a chat without any", 30, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counts, err := db.DailyReminderCounts(test.chatID, 7)
+			if err != nil {
+				t.Fatalf("failed to count reminders: %s", err)
+			}
+
+			var total int64
+			for _, count := range counts {
+				total += count.Count
+			}
+			if total != test.expected {
+				t.Errorf("expected %d, got %d (%+v)", test.expected, total, counts)
+			}
+			if test.expected > 0 && len(counts) != 1 {
+				t.Errorf("expected a day, got %+v", counts)
+			}
+		})
+	}
+}
+
+func TestUndatedQueueItems(t *testing.T) {
+	db := openTestDatabase(t)
+
+	if _, err := db.EnqueueItem(QueueItem{ChatID: 10, Message: "dated", FireOn: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("failed to enqueue item: %s", err)
+	}
+	for _, message := range []string{"undated", "another undated"} {
+		if _, err := db.EnqueueUndated(10, 0, 0, message, 1); err != nil {
+			t.Fatalf("failed to enqueue undated item: %s", err)
+		}
+	}
+
+	messagesOf := func(items []QueueItem) (messages []string) {
+		messages = []string{}
+		for _, item := range items {
+			messages = append(messages, item.Message)
+		}
+		return messages
+	}
+
+	// (not listed with dated ones)
+	if items, err := db.UndeliveredQueueItems(10); err != nil {
+		t.Fatalf("failed to list items: %s", err)
+	} else if messages := messagesOf(items); !slices.Equal(messages, []string{"dated"}) {
+		t.Errorf("expected only the dated one, got %q", messages)
+	}
+
+	// (but can be canceled)
+	if items, err := db.CancelableQueueItems(10); err != nil {
+		t.Fatalf("failed to list items: %s", err)
+	} else if messages := messagesOf(items); !slices.Equal(messages, []string{"dated", "undated", "another undated"}) {
+		t.Errorf("expected all of them, got %q", messages)
+	}
+	if count, err := db.DeleteQueueItemsMatching(10, "another"); err != nil || count != 1 {
+		t.Errorf("expected 1 undated item to be canceled, got %d (%v)", count, err)
+	}
+
+	// (scheduled ones are not undated anymore)
+	undated, err := db.UndatedQueueItems(10)
+	if err != nil || len(undated) != 1 || !undated[0].Undated {
+		t.Fatalf("expected 1 undated item, got %+v (%v)", undated, err)
+	}
+	if _, err := db.ScheduleQueueItem(10, undated[0].ID, time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatalf("failed to schedule item: %s", err)
+	}
+	if items, err := db.UndeliveredQueueItems(10); err != nil {
+		t.Fatalf("failed to list items: %s", err)
+	} else if messages := messagesOf(items); !slices.Equal(messages, []string{"dated", "undated"}) {
+		t.Errorf("expected the scheduled one to be listed, got %q", messages)
+	}
+	if items, err := db.UndatedQueueItems(10); err != nil || len(items) != 0 {
+		t.Errorf("expected no undated item, got %d (%v)", len(items), err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+// errors.go
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errors of parsing messages, which are shown to users as actionable messages (with `parseFailedMessage`)
+var (
+	ErrNoDatetime       = errors.New("no datetime in message")          // the model could not find when to notify
+	ErrAmbiguous        = errors.New("message could not be understood") // the model did not return a usable result
+	ErrModelUnavailable = errors.New("model is not available")          // the model could not be reached (eg. busy, or out of quota)
+)
+
+// generate a user-friendly message for given errors of parsing
+//
+// (when there are many of them, the one which is the most actionable for the user is chosen)
+func parseFailedMessage(errs []error) string {
+	err := errors.Join(errs...)
+
+	switch {
+	case errors.Is(err, ErrModelUnavailable):
+		return msgParseFailedModelUnavailable
+	case errors.Is(err, ErrNoDatetime):
+		return msgParseFailedNoDatetime
+	case errors.Is(err, ErrAmbiguous):
+		return msgParseFailedAmbiguous
+	default:
+		return fmt.Sprintf(msgParseFailedFormat, err)
+	}
+}
+
+// check if given errors of parsing are only because the model could not find when to notify
+// (not because the model was not available, eg. for saving the message as an undated reminder)
+func isNoDatetime(errs []error) bool {
+	err := errors.Join(errs...)
+
+	return errors.Is(err, ErrNoDatetime) && !errors.Is(err, ErrModelUnavailable)
+}
@@ -0,0 +1,155 @@
+package main
+
+// escalation.go
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// re-notifications of reminders until they are acknowledged (`/escalate`),
+// only within the active hours of their chats (`/activehours`)
+//
+// precedence rules:
+//
+//  1. the first delivery of a reminder is always on its time, even out of the active hours (the time was given explicitly)
+//  2. re-notifications out of the active hours are postponed to the start of the next active hours,
+//     and the ones missed in the meantime are not repeated (only one re-notification on the start)
+//  3. acknowledging (or snoozing) a reminder cancels its pending re-notifications, including the postponed ones
+//  4. re-notifications stop after `maxEscalations` of them, even if not acknowledged
+
+// maximum number of re-notifications of a reminder
+const maxEscalations = 12
+
+// minimum interval of re-notifications
+const minEscalationInterval = 5 * time.Minute
+
+// activeHours is a window of the day in which reminders are re-notified, in minutes of the day
+//
+// (the window is over midnight if `from` is after `until`, eg. 22:00-06:00 for night shifts)
+type activeHours struct {
+	from, until int
+}
+
+// parse given active hours (eg. "09:00-18:00")
+func parseActiveHours(str string) (hours activeHours, err error) {
+	from, until, found := strings.Cut(str, "-")
+	if !found {
+		return hours, fmt.Errorf("not in the form of 'HH:MM-HH:MM': '%s'", str)
+	}
+
+	if hours.from, err = parseMinutesOfDay(from); err != nil {
+		return hours, fmt.Errorf("invalid start of active hours: '%s'", from)
+	}
+	if hours.until, err = parseMinutesOfDay(until); err != nil {
+		return hours, fmt.Errorf("invalid end of active hours: '%s'", until)
+	}
+	if hours.from == hours.until {
+		return hours, fmt.Errorf("empty active hours: '%s'", str)
+	}
+
+	return hours, nil
+}
+
+// format active hours (eg. "09:00-18:00")
+func (h activeHours) String() string {
+	return minutesOfDayToStr(h.from) + "-" + minutesOfDayToStr(h.until)
+}
+
+// check if given time is within the active hours (in the location of the time)
+func (h activeHours) contains(t time.Time) bool {
+	minutes := t.Hour()*60 + t.Minute()
+
+	if h.from < h.until {
+		return minutes >= h.from && minutes < h.until
+	}
+	return minutes >= h.from || minutes < h.until // (over midnight)
+}
+
+// get given time if it is within the active hours, or the start of the next active hours
+func (h activeHours) next(t time.Time) time.Time {
+	if h.contains(t) {
+		return t
+	}
+
+	start := time.Date(t.Year(), t.Month(), t.Day(), h.from/60, h.from%60, 0, 0, t.Location())
+	if !start.After(t) {
+		start = time.Date(t.Year(), t.Month(), t.Day()+1, h.from/60, h.from%60, 0, 0, t.Location())
+	}
+	return start
+}
+
+// get the active hours of given chat (nil if not set)
+func chatActiveHours(db *Database, chatID int64) *activeHours {
+	if setting, err := db.GetChatSetting(chatID); err == nil && setting.ActiveHours != "" {
+		if hours, err := parseActiveHours(setting.ActiveHours); err == nil {
+			return &hours
+		}
+	}
+
+	return nil
+}
+
+// get the time of the next re-notification of a reminder delivered on `delivered`,
+// within given active hours (if any)
+func nextEscalationTime(delivered time.Time, interval time.Duration, hours *activeHours) time.Time {
+	next := delivered.Add(interval)
+	if hours != nil {
+		next = hours.next(next)
+	}
+
+	return next
+}
+
+// get the time to which given re-notification should be postponed, if it is out of the active hours of its chat on `now`
+func postponedEscalation(db *Database, q QueueItem, now time.Time) (postponed time.Time, ok bool) {
+	if q.EscalationOf == 0 {
+		return now, false
+	}
+
+	hours := chatActiveHours(db, q.ChatID)
+	if hours == nil {
+		return now, false
+	}
+
+	now = now.In(chatLocation(db, q.ChatID))
+	if hours.contains(now) {
+		return now, false
+	}
+	return hours.next(now), true
+}
+
+// enqueue the next re-notification of given (delivered) queue item, if it is escalated and not acknowledged yet
+func enqueueEscalation(db *Database, q QueueItem) {
+	if q.EscalateMinutes <= 0 || q.MilestoneOf != 0 {
+		return
+	}
+	if q.EscalationCount >= maxEscalations {
+		logInfo("re-notifications of chat id: %d, queue id: %d reached the maximum", q.ChatID, q.ID)
+		return
+	}
+
+	escalationOf := q.EscalationOf
+	if escalationOf == 0 {
+		escalationOf = q.ID
+	}
+
+	now := time.Now().In(chatLocation(db, q.ChatID))
+	if _, err := db.EnqueueItem(QueueItem{
+		ChatID:          q.ChatID,
+		MessageID:       q.MessageID,
+		MessageThreadID: q.MessageThreadID,
+		Message:         q.Message,
+		FireOn:          nextEscalationTime(now, time.Duration(q.EscalateMinutes)*time.Minute, chatActiveHours(db, q.ChatID)),
+		ModelName:       q.ModelName,
+		Silent:          q.Silent,
+		Source:          sourceEscalation,
+		CreatedBy:       q.CreatedBy,
+		EscalateMinutes: q.EscalateMinutes,
+		EscalationOf:    escalationOf,
+		EscalationCount: q.EscalationCount + 1,
+	}); err != nil {
+		logError(db, "failed to enqueue the re-notification of chat id: %d, queue id: %d (%s)", q.ChatID, q.ID, err)
+	}
+}
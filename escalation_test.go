@@ -0,0 +1,265 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActiveHours(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, time.January, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name             string
+		hours            string
+		t                time.Time
+		expectedContains bool
+		expectedNext     time.Time
+	}{
+		{
+			name:             "within the day",
+			hours:            "09:00-18:00",
+			t:                at(15, 12, 0),
+			expectedContains: true,
+			expectedNext:     at(15, 12, 0),
+		},
+		{
+			name:             "at the start",
+			hours:            "09:00-18:00",
+			t:                at(15, 9, 0),
+			expectedContains: true,
+			expectedNext:     at(15, 9, 0),
+		},
+		{
+			name:             "at the end (exclusive)",
+			hours:            "09:00-18:00",
+			t:                at(15, 18, 0),
+			expectedContains: false,
+			expectedNext:     at(16, 9, 0),
+		},
+		{
+			name:             "before midnight, after the end",
+			hours:            "09:00-18:00",
+			t:                at(15, 23, 59),
+			expectedContains: false,
+			expectedNext:     at(16, 9, 0),
+		},
+		{
+			name:             "after midnight, before the start",
+			hours:            "09:00-18:00",
+			t:                at(16, 0, 0),
+			expectedContains: false,
+			expectedNext:     at(16, 9, 0),
+		},
+		{
+			name:             "over midnight, before midnight",
+			hours:            "22:00-06:00",
+			t:                at(15, 23, 30),
+			expectedContains: true,
+			expectedNext:     at(15, 23, 30),
+		},
+		{
+			name:             "over midnight, at midnight",
+			hours:            "22:00-06:00",
+			t:                at(16, 0, 0),
+			expectedContains: true,
+			expectedNext:     at(16, 0, 0),
+		},
+		{
+			name:             "over midnight, at the end",
+			hours:            "22:00-06:00",
+			t:                at(16, 6, 0),
+			expectedContains: false,
+			expectedNext:     at(16, 22, 0),
+		},
+		{
+			name:             "over midnight, in the daytime",
+			hours:            "22:00-06:00",
+			t:                at(16, 12, 0),
+			expectedContains: false,
+			expectedNext:     at(16, 22, 0),
+		},
+		{
+			name:             "until midnight",
+			hours:            "18:00-00:00",
+			t:                at(15, 23, 59),
+			expectedContains: true,
+			expectedNext:     at(15, 23, 59),
+		},
+		{
+			name:             "until midnight, at midnight",
+			hours:            "18:00-00:00",
+			t:                at(16, 0, 0),
+			expectedContains: false,
+			expectedNext:     at(16, 18, 0),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hours, err := parseActiveHours(test.hours)
+			if err != nil {
+				t.Fatalf("failed to parse active hours: %s", err)
+			}
+
+			if contains := hours.contains(test.t); contains != test.expectedContains {
+				t.Errorf("expected contains to be %t, got %t", test.expectedContains, contains)
+			}
+			if next := hours.next(test.t); !next.Equal(test.expectedNext) {
+				t.Errorf("expected %s, got %s", test.expectedNext.Format(time.RFC1123), next.Format(time.RFC1123))
+			}
+		})
+	}
+}
+
+func TestParseActiveHours(t *testing.T) {
+	for _, str := range []string{"", "09:00", "09:00-", "9am-6pm", "25:00-06:00", "09:00-09:00"} {
+		if hours, err := parseActiveHours(str); err == nil {
+			t.Errorf("expected an error for '%s', got %s", str, hours)
+		}
+	}
+
+	if hours, err := parseActiveHours("9:00-18:30"); err != nil {
+		t.Errorf("failed to parse active hours: %s", err)
+	} else if hours.String() != "09:00-18:30" {
+		t.Errorf("expected '09:00-18:30', got '%s'", hours)
+	}
+}
+
+func TestNextEscalationTime(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, time.January, day, hour, minute, 0, 0, time.UTC)
+	}
+	daytime := activeHours{from: 9 * 60, until: 18 * 60}
+	overnight := activeHours{from: 22 * 60, until: 6 * 60}
+
+	tests := []struct {
+		name      string
+		delivered time.Time
+		interval  time.Duration
+		hours     *activeHours
+		expected  time.Time
+	}{
+		{
+			name:      "without active hours",
+			delivered: at(15, 23, 40),
+			interval:  30 * time.Minute,
+			hours:     nil,
+			expected:  at(16, 0, 10),
+		},
+		{
+			name:      "within active hours",
+			delivered: at(15, 17, 0),
+			interval:  30 * time.Minute,
+			hours:     &daytime,
+			expected:  at(15, 17, 30),
+		},
+		{
+			name:      "paused overnight",
+			delivered: at(15, 17, 45),
+			interval:  30 * time.Minute,
+			hours:     &daytime,
+			expected:  at(16, 9, 0),
+		},
+		{
+			name:      "delivered in quiet hours, paused until the morning",
+			delivered: at(15, 23, 40),
+			interval:  30 * time.Minute,
+			hours:     &daytime,
+			expected:  at(16, 9, 0),
+		},
+		{
+			name:      "over midnight within active hours",
+			delivered: at(15, 23, 40),
+			interval:  30 * time.Minute,
+			hours:     &overnight,
+			expected:  at(16, 0, 10),
+		},
+		{
+			name:      "over midnight, paused in the daytime",
+			delivered: at(16, 5, 45),
+			interval:  30 * time.Minute,
+			hours:     &overnight,
+			expected:  at(16, 22, 0),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if next := nextEscalationTime(test.delivered, test.interval, test.hours); !next.Equal(test.expected) {
+				t.Errorf("expected %s, got %s", test.expected.Format(time.RFC1123), next.Format(time.RFC1123))
+			}
+		})
+	}
+}
+
+func TestPostponedEscalation(t *testing.T) {
+	db := openTestDatabase(t)
+
+	const chatID = 10
+	if _, err := db.UpdateChatSetting(chatID, "active_hours", "09:00-18:00"); err != nil {
+		t.Fatalf("failed to save active hours: %s", err)
+	}
+
+	night := time.Date(2025, time.January, 15, 23, 30, 0, 0, time.UTC)
+	morning := time.Date(2025, time.January, 16, 9, 0, 0, 0, time.UTC)
+
+	// (first deliveries are not postponed)
+	if _, ok := postponedEscalation(db, QueueItem{ChatID: chatID, ID: 1, EscalateMinutes: 30}, night); ok {
+		t.Errorf("expected the original reminder not to be postponed")
+	}
+
+	// (re-notifications are postponed out of active hours)
+	if postponed, ok := postponedEscalation(db, QueueItem{ChatID: chatID, ID: 2, EscalateMinutes: 30, EscalationOf: 1}, night); !ok {
+		t.Errorf("expected the re-notification to be postponed")
+	} else if !postponed.Equal(morning) {
+		t.Errorf("expected %s, got %s", morning.Format(time.RFC1123), postponed.Format(time.RFC1123))
+	}
+	if _, ok := postponedEscalation(db, QueueItem{ChatID: chatID, ID: 2, EscalateMinutes: 30, EscalationOf: 1}, morning); ok {
+		t.Errorf("expected the re-notification not to be postponed within active hours")
+	}
+
+	// (not postponed in chats without active hours)
+	if _, ok := postponedEscalation(db, QueueItem{ChatID: chatID + 1, ID: 3, EscalateMinutes: 30, EscalationOf: 1}, night); ok {
+		t.Errorf("expected the re-notification not to be postponed without active hours")
+	}
+}
+
+func TestAcknowledgeQueueItem(t *testing.T) {
+	db := openTestDatabase(t)
+
+	const chatID = 10
+	fireOn := time.Now().Add(time.Hour)
+
+	originalID, err := db.EnqueueItem(QueueItem{ChatID: chatID, Message: "take pills", FireOn: fireOn, EscalateMinutes: 30})
+	if err != nil {
+		t.Fatalf("failed to enqueue item: %s", err)
+	}
+	renotifiedID, err := db.EnqueueItem(QueueItem{ChatID: chatID, Message: "take pills", FireOn: fireOn, EscalateMinutes: 30, EscalationOf: originalID, EscalationCount: 1})
+	if err != nil {
+		t.Fatalf("failed to enqueue item: %s", err)
+	}
+	if _, err := db.MarkQueueItemAsDelivered(chatID, renotifiedID, 100); err != nil {
+		t.Fatalf("failed to mark item as delivered: %s", err)
+	}
+	if _, err := db.EnqueueItem(QueueItem{ChatID: chatID, Message: "take pills", FireOn: fireOn.Add(30 * time.Minute), EscalateMinutes: 30, EscalationOf: originalID, EscalationCount: 2}); err != nil {
+		t.Fatalf("failed to enqueue item: %s", err)
+	}
+	if _, err := db.EnqueueItem(QueueItem{ChatID: chatID, Message: "other", FireOn: fireOn}); err != nil {
+		t.Fatalf("failed to enqueue item: %s", err)
+	}
+
+	// (acknowledged with the delivered re-notification)
+	if count, err := db.AcknowledgeQueueItem(chatID, renotifiedID); err != nil {
+		t.Fatalf("failed to acknowledge: %s", err)
+	} else if count != 1 {
+		t.Errorf("expected 1 pending re-notification to be deleted, got %d", count)
+	}
+
+	if items, err := db.UndeliveredQueueItems(chatID); err != nil {
+		t.Fatalf("failed to get undelivered items: %s", err)
+	} else if len(items) != 2 {
+		t.Errorf("expected the original and the other one to be kept, got %d item(s)", len(items))
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+// feed.go
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// icalFeedConfig is a struct for configuring the HTTP server of iCalendar feeds
+type icalFeedConfig struct {
+	ListenAddr string `json:"listen_addr"` // eg. "127.0.0.1:8081"
+	BaseURL    string `json:"base_url"`    // public url of the server, for building urls of feeds (eg. "https://reminders.example.com")
+}
+
+// length of tokens of iCalendar feeds (in bytes, before hex-encoding)
+const icalFeedTokenLength = 32
+
+// serve iCalendar feeds of chats with given config (blocks until it fails)
+func serveICalFeed(feedConf icalFeedConfig, db *Database) error {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /ical/{file}", icalFeedHandler(db))
+
+	logInfo("serving iCalendar feeds on: %s", feedConf.ListenAddr)
+
+	return http.ListenAndServe(feedConf.ListenAddr, mux)
+}
+
+// GET /ical/{token}.ics
+func icalFeedHandler(db *Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer recoverAndLog(db, fmt.Sprintf("iCalendar feed: %s %s", r.Method, r.URL.Path))
+
+		token, found := strings.CutSuffix(r.PathValue("file"), ".ics")
+		if !found || token == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		setting, err := db.ChatSettingByICalToken(token)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// (reminders of the bot on which the feed was created, when running multiple bots)
+		scoped := db
+		if setting.BotID != 0 {
+			scoped = db.ForBot(setting.BotID)
+		}
+
+		if items, err := scoped.UndeliveredQueueItems(setting.ChatID); err == nil {
+			w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, icsFilename))
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusOK)
+
+			_, _ = w.Write(generateICalendar(items, chatLocation(scoped, setting.ChatID), time.Now()))
+		} else {
+			logError(db, "iCalendar feed failed to list reminders: %s", err)
+
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}
+}
+
+// generate a new (random) token for an iCalendar feed
+func newICalFeedToken() (string, error) {
+	bytes := make([]byte, icalFeedTokenLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(bytes), nil
+}
+
+// get the url of an iCalendar feed with given token
+func icalFeedURL(feedConf icalFeedConfig, token string) string {
+	return fmt.Sprintf("%s/ical/%s.ics", strings.TrimSuffix(feedConf.BaseURL, "/"), token)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestICalFeedHandlerOfMultipleBots(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+
+	// feeds of the same chat on different bots
+	for botID, token := range map[int64]string{1: "token-of-bot1", 2: "token-of-bot2"} {
+		scoped := db.ForBot(botID)
+		if _, err := scoped.UpdateChatSetting(10, "ical_token", token); err != nil {
+			t.Fatalf("failed to save token: %s", err)
+		}
+		if _, err := scoped.EnqueueItem(QueueItem{ChatID: 10, Message: token + " reminder", FireOn: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatalf("failed to enqueue item: %s", err)
+		}
+	}
+
+	handler := icalFeedHandler(db)
+
+	// (requests should not affect each other's scopes)
+	for _, token := range []string{"token-of-bot1", "token-of-bot2", "token-of-bot1"} {
+		r := httptest.NewRequest(http.MethodGet, "/ical/"+token+".ics", nil)
+		r.SetPathValue("file", token+".ics")
+		w := httptest.NewRecorder()
+
+		handler(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d for %s, got %d", http.StatusOK, token, w.Code)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, token+" reminder") {
+			t.Errorf("expected the reminder of %s in the feed, got: %s", token, body)
+		}
+		if strings.Count(body, "BEGIN:VEVENT") != 1 {
+			t.Errorf("expected only the reminder of %s in the feed, got: %s", token, body)
+		}
+	}
+}
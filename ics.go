@@ -0,0 +1,276 @@
+package main
+
+// ics.go
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// iCalendar (RFC 5545) exports of reminders
+
+const (
+	icsProductID     = "-//meinside//telegram-reminder-bot//EN"
+	icsFilename      = "reminders.ics"
+	icsMaxLineLength = 75 // in octets, longer lines are folded
+
+	icsDatetimeFormat    = "20060102T150405"
+	icsDatetimeFormatUTC = "20060102T150405Z"
+)
+
+// generate an iCalendar of given queue items, in given timezone
+func generateICalendar(items []QueueItem, loc *time.Location, now time.Time) []byte {
+	// (use utc times, if the timezone has no usable name)
+	tzid := loc.String()
+	if tzid == "" || tzid == "Local" || tzid == "UTC" {
+		tzid, loc = "", time.UTC
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + icsProductID,
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+	}
+	if tzid != "" {
+		lines = append(lines, icsTimezone(tzid, loc, now)...)
+	}
+
+	for _, item := range items {
+		summary := icsEscape(item.Message)
+
+		// (events are after the lead offsets, and alarms are on the fire times)
+		lead := time.Duration(item.LeadOffsetSeconds) * time.Second
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:%d-%d@telegram-reminder-bot", item.ChatID, item.ID),
+			"DTSTAMP:"+now.UTC().Format(icsDatetimeFormatUTC),
+			icsDatetime("DTSTART", item.FireOn.Add(lead), tzid, loc),
+			"SUMMARY:"+summary,
+		)
+		if item.Recurrence != "" && item.IntervalMinutes > 0 { // (not expressible with RRULE of the cron expression)
+			lines = append(lines, "DESCRIPTION:"+icsEscape(fmt.Sprintf("repeated with: %s, every %d minute(s) until %s", item.Recurrence, item.IntervalMinutes, windowEndStr(item.WindowEndMinutes))))
+		} else if item.Recurrence != "" {
+			if rrule, ok := cronToRRule(item.Recurrence, item.UntilOn); ok {
+				lines = append(lines, "RRULE:"+rrule)
+			} else { // (not expressible with RRULE)
+				lines = append(lines, "DESCRIPTION:"+icsEscape(fmt.Sprintf("repeated with: %s", item.Recurrence)))
+			}
+		}
+		lines = append(lines,
+			"BEGIN:VALARM",
+			"ACTION:DISPLAY",
+			"DESCRIPTION:"+summary,
+			fmt.Sprintf("TRIGGER:-PT%dS", int64(lead.Seconds())),
+			"END:VALARM",
+			"END:VEVENT",
+		)
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	var sb strings.Builder
+	for _, line := range lines {
+		sb.WriteString(icsFold(line))
+		sb.WriteString("\r\n")
+	}
+
+	return []byte(sb.String())
+}
+
+// generate a datetime property (eg. "DTSTART;TZID=Asia/Seoul:20241225T150000")
+func icsDatetime(name string, t time.Time, tzid string, loc *time.Location) string {
+	if tzid == "" {
+		return fmt.Sprintf("%s:%s", name, t.UTC().Format(icsDatetimeFormatUTC))
+	}
+
+	return fmt.Sprintf("%s;TZID=%s:%s", name, tzid, t.In(loc).Format(icsDatetimeFormat))
+}
+
+// generate a VTIMEZONE of given timezone, with its offsets (and transitions) in the year of `now`
+func icsTimezone(tzid string, loc *time.Location, now time.Time) (lines []string) {
+	lines = []string{"BEGIN:VTIMEZONE", "TZID:" + tzid}
+
+	year := now.In(loc).Year()
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+	transitions := timezoneTransitions(loc, start, start.AddDate(1, 0, 0))
+
+	if len(transitions) <= 0 { // no daylight saving time
+		_, offset := start.Zone()
+		name, _ := start.Zone()
+		lines = append(lines, icsTimezoneComponent("STANDARD", name, offset, offset, time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC))...)
+	} else {
+		for _, transition := range transitions {
+			name, offset := transition.Zone()
+			_, prevOffset := transition.Add(-time.Second).Zone()
+
+			component := "STANDARD"
+			if transition.IsDST() {
+				component = "DAYLIGHT"
+			}
+
+			// (local time before the transition)
+			local := transition.UTC().Add(time.Duration(prevOffset) * time.Second)
+			lines = append(lines, icsTimezoneComponent(component, name, prevOffset, offset, local)...)
+		}
+	}
+
+	return append(lines, "END:VTIMEZONE")
+}
+
+// generate a STANDARD or DAYLIGHT component of VTIMEZONE
+func icsTimezoneComponent(component, name string, offsetFrom, offsetTo int, start time.Time) []string {
+	return []string{
+		"BEGIN:" + component,
+		"DTSTART:" + start.Format(icsDatetimeFormat),
+		"TZOFFSETFROM:" + icsOffset(offsetFrom),
+		"TZOFFSETTO:" + icsOffset(offsetTo),
+		"TZNAME:" + icsEscape(name),
+		"END:" + component,
+	}
+}
+
+// find times when the offset of given timezone changes between `from` and `to`
+func timezoneTransitions(loc *time.Location, from, to time.Time) (transitions []time.Time) {
+	transitions = []time.Time{}
+
+	_, offset := from.Zone()
+	for t := from; t.Before(to); t = t.Add(time.Hour) {
+		if _, o := t.In(loc).Zone(); o != offset {
+			// (find the exact minute of the transition)
+			transition := t.Add(-time.Hour)
+			for transition.Before(t) {
+				if _, o := transition.In(loc).Zone(); o != offset {
+					break
+				}
+				transition = transition.Add(time.Minute)
+			}
+
+			transitions = append(transitions, transition.In(loc))
+			offset = o
+		}
+	}
+
+	return transitions
+}
+
+// format given offset in seconds (eg. 32400 => "+0900")
+func icsOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, (seconds%3600)/60)
+}
+
+// escape given text for iCalendar
+func icsEscape(text string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(text)
+}
+
+// fold given line with CRLF + space, if it is longer than the limit (without breaking utf-8 characters)
+func icsFold(line string) string {
+	var sb strings.Builder
+
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > icsMaxLineLength {
+			sb.WriteString("\r\n ")
+			length = 1
+		}
+		sb.WriteRune(r)
+		length += size
+	}
+
+	return sb.String()
+}
+
+// convert given cron expression to a RRULE (eg. "0 9 * * 1-5" => "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR;BYHOUR=9;BYMINUTE=0"),
+// or return false if it cannot be expressed with a RRULE
+func cronToRRule(expr string, until *time.Time) (rrule string, ok bool) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(_cronFields) {
+		return "", false
+	}
+	minute, hour, dom, month, dow := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	// (only for fixed times)
+	if _, err := strconv.Atoi(minute); err != nil {
+		return "", false
+	}
+	if _, err := strconv.Atoi(hour); err != nil {
+		return "", false
+	}
+
+	var parts []string
+	switch {
+	case dom == "*" && month == "*" && dow == "*":
+		parts = []string{"FREQ=DAILY"}
+	case dom == "*" && month == "*":
+		days, ok := cronWeekdaysToRRule(dow)
+		if !ok {
+			return "", false
+		}
+		parts = []string{"FREQ=WEEKLY", "BYDAY=" + days}
+	case dow == "*" && month == "*" && isCronNumbers(dom):
+		parts = []string{"FREQ=MONTHLY", "BYMONTHDAY=" + dom}
+	case dow == "*" && isCronNumbers(month) && isCronNumbers(dom):
+		parts = []string{"FREQ=YEARLY", "BYMONTH=" + month, "BYMONTHDAY=" + dom}
+	default:
+		return "", false
+	}
+	parts = append(parts, "BYHOUR="+hour, "BYMINUTE="+minute)
+
+	if until != nil {
+		parts = append(parts, "UNTIL="+until.UTC().Format(icsDatetimeFormatUTC))
+	}
+
+	return strings.Join(parts, ";"), true
+}
+
+// weekdays in RRULEs
+var _rruleWeekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// convert given day-of-week field of cron expressions to BYDAY of RRULEs (eg. "1-5" => "MO,TU,WE,TH,FR")
+func cronWeekdaysToRRule(field string) (days string, ok bool) {
+	bits, err := parseCronField(field, _cronFields[4])
+	if err != nil {
+		return "", false
+	}
+	if bits&(1<<7) != 0 { // 7 => 0 (sunday)
+		bits = bits&^(1<<7) | 1
+	}
+
+	weekdays := []string{}
+	for i, weekday := range _rruleWeekdays {
+		if bits&(1<<i) != 0 {
+			weekdays = append(weekdays, weekday)
+		}
+	}
+
+	return strings.Join(weekdays, ","), len(weekdays) > 0
+}
+
+// check if given cron field is a list of numbers (eg. "1", "1,15")
+func isCronNumbers(field string) bool {
+	for _, part := range strings.Split(field, ",") {
+		if _, err := strconv.Atoi(part); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,74 @@
+package main
+
+// mail.go
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smtpConfig is a struct for configuring the SMTP server for email fallback
+type smtpConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"` // eg. 587
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from"` // eg. "Reminder Bot <bot@example.com>"
+}
+
+// send an email with given subject and body through the configured SMTP server
+func sendEmail(conf smtpConfig, to, subject, body string) error {
+	from, err := mail.ParseAddress(conf.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address '%s': %w", conf.From, err)
+	}
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address '%s': %w", to, err)
+	}
+
+	var auth smtp.Auth
+	if conf.Username != "" {
+		auth = smtp.PlainAuth("", conf.Username, conf.Password, conf.Host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + from.String(),
+		"To: " + rcpt.String(),
+		"Subject: " + mimeEncodeHeader(subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(
+		net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port)),
+		auth,
+		from.Address,
+		[]string{rcpt.Address},
+		[]byte(msg),
+	)
+}
+
+// encode given header value for non-ascii characters (RFC 2047)
+func mimeEncodeHeader(value string) string {
+	// (remove line breaks for preventing header injections)
+	value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+
+	return mime.QEncoding.Encode("UTF-8", value)
+}
+
+// check if given string is a valid email address
+func isValidEmail(address string) bool {
+	parsed, err := mail.ParseAddress(address)
+
+	return err == nil && parsed.Address == address
+}
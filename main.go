@@ -15,7 +15,7 @@ func main() {
 		confFilepath := os.Args[1]
 
 		if conf, err := loadConfig(confFilepath); err == nil {
-			runBot(conf)
+			runBot(conf, confFilepath)
 		} else {
 			log.Printf("failed to load config: %s", err)
 		}
@@ -0,0 +1,154 @@
+package main
+
+// migrations.go
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// SchemaVersion struct is for the applied migrations of the database schema
+type SchemaVersion struct {
+	gorm.Model
+
+	Version     int `gorm:"uniqueIndex"`
+	Description string
+}
+
+// schemaMigration is a step of migrating existing rows, which cannot be done with `AutoMigrate`
+// (eg. backfilling newly-added columns with sane defaults)
+//
+// (versions should be increased one by one, and applied steps should not be changed)
+type schemaMigration struct {
+	version     int
+	description string
+	migrate     func(tx *gorm.DB) error
+}
+
+// migration steps, in the order of versions
+var _schemaMigrations = []schemaMigration{
+	{
+		version:     1,
+		description: "backfill recurrences, silences, and fail reasons of queue items",
+		migrate: func(tx *gorm.DB) error {
+			// (columns added by `AutoMigrate` are null for existing rows)
+			for column, value := range map[string]any{
+				"recurrence":  "",
+				"silent":      false,
+				"fail_reason": "",
+			} {
+				if res := tx.Exec(fmt.Sprintf("update queue_items set %[1]s = ? where %[1]s is null", column), value); res.Error != nil {
+					return res.Error
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version:     2,
+		description: "backfill sources and creators of queue items",
+		migrate: func(tx *gorm.DB) error {
+			if res := tx.Exec("update queue_items set source = ? where milestone_of > 0 and (source is null or source = '')", sourceMilestone); res.Error != nil {
+				return res.Error
+			}
+			if res := tx.Exec("update queue_items set source = '' where source is null"); res.Error != nil {
+				return res.Error
+			}
+			if res := tx.Exec("update queue_items set created_by = 0 where created_by is null"); res.Error != nil {
+				return res.Error
+			}
+			return nil
+		},
+	},
+	{
+		version:     3,
+		description: "backfill lead offsets of queue items and temporary messages",
+		migrate: func(tx *gorm.DB) error {
+			for _, table := range []string{"queue_items", "temporary_messages"} {
+				if res := tx.Exec(fmt.Sprintf("update %s set lead_offset_seconds = 0 where lead_offset_seconds is null", table)); res.Error != nil {
+					return res.Error
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version:     4,
+		description: "backfill intervals and windows of queue items and temporary messages",
+		migrate: func(tx *gorm.DB) error {
+			for _, table := range []string{"queue_items", "temporary_messages"} {
+				for _, column := range []string{"interval_minutes", "window_end_minutes"} {
+					if res := tx.Exec(fmt.Sprintf("update %[1]s set %[2]s = 0 where %[2]s is null", table, column)); res.Error != nil {
+						return res.Error
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version:     5,
+		description: "drop unique indexes of chat settings, presets, and aliases which are not scoped by bot",
+		migrate: func(tx *gorm.DB) error {
+			// (replaced with the ones including `bot_id` by `AutoMigrate`)
+			for model, index := range map[any]string{
+				&ChatSetting{}: "idx_chat_settings_chat_id",
+				&Preset{}:      "idx_presets1",
+				&Alias{}:       "idx_aliases1",
+			} {
+				if tx.Migrator().HasIndex(model, index) {
+					if err := tx.Migrator().DropIndex(model, index); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version:     6,
+		description: "mark queue items without fire times as undated",
+		migrate: func(tx *gorm.DB) error {
+			return tx.Unscoped().Model(&QueueItem{}).Where("fire_on is null").UpdateColumn("undated", true).Error
+		},
+	},
+}
+
+// apply migration steps which were not applied yet (should be called after `AutoMigrate`),
+// and return the current schema version
+func migrateSchema(db *gorm.DB) (version int, err error) {
+	if err := db.AutoMigrate(&SchemaVersion{}); err != nil {
+		return 0, fmt.Errorf("failed to migrate schema versions: %w", err)
+	}
+
+	if res := db.Model(&SchemaVersion{}).Select("coalesce(max(version), 0)").Scan(&version); res.Error != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", res.Error)
+	}
+
+	for _, m := range _schemaMigrations {
+		if m.version <= version {
+			continue
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.migrate(tx); err != nil {
+				return err
+			}
+
+			return tx.Create(&SchemaVersion{
+				Version:     m.version,
+				Description: m.description,
+			}).Error
+		}); err != nil {
+			return version, fmt.Errorf("failed to migrate schema to version %d (%s): %w", m.version, m.description, err)
+		}
+
+		log.Printf("migrated database schema to version %d: %s", m.version, m.description)
+
+		version = m.version
+	}
+
+	return version, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+// solar.go
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// solar events which can be used as times of reminders (eg. "remind me at sunset")
+const (
+	solarSunrise = "sunrise"
+	solarSunset  = "sunset"
+	solarDawn    = "dawn" // civil dawn
+	solarDusk    = "dusk" // civil dusk
+)
+
+// altitudes of the sun's center at solar events (in degrees)
+const (
+	solarAltitudeHorizon = -0.833 // sunrise and sunset (with atmospheric refraction and the sun's radius)
+	solarAltitudeCivil   = -6.0   // civil dawn and dusk
+)
+
+// expression of a solar event with an optional day (eg. "at sunset", "tomorrow at dawn", "at sunrise tomorrow"),
+// or the whole text of it (eg. "sunset", "dawn tomorrow")
+//
+// (a preposition is needed in sentences, for not mistaking other words for times, eg. "watch Sunset Boulevard at 9pm")
+var _solarExpression = regexp.MustCompile(`(?i)\s*\b(?:(today|tomorrow)\s+)?(?:at|around|by|before)\s+(?:the\s+)?(sunrise|sunset|dawn|dusk)\b(?:\s+(today|tomorrow)\b)?\s*`)
+var _solarOnlyExpression = regexp.MustCompile(`(?i)^(?:(today|tomorrow)\s+)?(sunrise|sunset|dawn|dusk)(?:\s+(today|tomorrow))?$`)
+
+// prefix of requests (eg. "remind me to ...")
+var _remindMePrefix = regexp.MustCompile(`(?i)^(?:remind|notify)\s+me(?:\s+to)?(?:\s+|$)`)
+
+// parse given text which has a solar event as its time (eg. "water the plants at sunset", "tomorrow at dawn go fishing"),
+// with the location of given chat (false if the chat has no location)
+func parseSolarDatetimeOfChat(db *Database, chatID int64, text string) (item parsedItem, ok bool) {
+	setting, err := db.GetChatSetting(chatID)
+	if err != nil || setting.Latitude == nil || setting.Longitude == nil {
+		return item, false
+	}
+
+	return parseSolarDatetime(text, *setting.Latitude, *setting.Longitude, chatLocation(db, chatID), time.Now())
+}
+
+// parse given text which has a solar event as its time, at given location
+//
+// (if no day is given, the next one from `now` is used)
+func parseSolarDatetime(text string, lat, lon float64, loc *time.Location, now time.Time) (item parsedItem, ok bool) {
+	text = strings.TrimSpace(text)
+
+	matched := _solarExpression.FindStringSubmatchIndex(text)
+	if matched == nil {
+		if matched = _solarOnlyExpression.FindStringSubmatchIndex(text); matched == nil {
+			return item, false
+		}
+	}
+
+	submatch := func(i int) string {
+		if matched[2*i] < 0 {
+			return ""
+		}
+		return strings.ToLower(text[matched[2*i]:matched[2*i+1]])
+	}
+	event, day := submatch(2), submatch(1)
+	if day == "" {
+		day = submatch(3)
+	}
+
+	date := now.In(loc)
+	if day == "tomorrow" {
+		date = date.AddDate(0, 0, 1)
+	}
+	when, happens := solarEventTime(event, date, lat, lon)
+	if day == "" && (!happens || !when.After(now)) { // already passed today: the next one
+		when, happens = solarEventTime(event, date.AddDate(0, 0, 1), lat, lon)
+	}
+	if !happens { // eg. polar day/night
+		return item, false
+	}
+
+	// the rest is the message
+	message := strings.TrimSpace(text[:matched[0]] + " " + text[matched[1]:])
+	message = strings.TrimSpace(_remindMePrefix.ReplaceAllString(message, ""))
+	if message == "" {
+		message = text
+	}
+
+	return parsedItem{
+		Message: message,
+		When:    when.In(loc),
+		Exact:   true,
+	}, true
+}
+
+// calculate the time of given solar event on the day of given date, at given location,
+// with the sunrise equation (false if it does not happen on the day, eg. polar day/night)
+func solarEventTime(event string, date time.Time, lat, lon float64) (when time.Time, happens bool) {
+	var altitude float64
+	var rising bool
+	switch event {
+	case solarSunrise:
+		altitude, rising = solarAltitudeHorizon, true
+	case solarSunset:
+		altitude, rising = solarAltitudeHorizon, false
+	case solarDawn:
+		altitude, rising = solarAltitudeCivil, true
+	case solarDusk:
+		altitude, rising = solarAltitudeCivil, false
+	default:
+		return when, false
+	}
+
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+	toDegrees := func(rad float64) float64 { return rad * 180 / math.Pi }
+
+	// days since J2000.0 (2000-01-01 12:00 UTC), and the mean solar time at the longitude
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, time.UTC)
+	n := math.Round(noon.Sub(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)).Hours() / 24)
+	meanSolarTime := n - lon/360
+
+	// solar mean anomaly, equation of the center, and ecliptic longitude
+	m := math.Mod(357.5291+0.98560028*meanSolarTime, 360)
+	c := 1.9148*math.Sin(toRadians(m)) + 0.0200*math.Sin(toRadians(2*m)) + 0.0003*math.Sin(toRadians(3*m))
+	lambda := math.Mod(m+c+180+102.9372, 360)
+
+	// solar transit (in julian days) and declination of the sun
+	transit := 2451545.0 + meanSolarTime + 0.0053*math.Sin(toRadians(m)) - 0.0069*math.Sin(toRadians(2*lambda))
+	declination := math.Asin(math.Sin(toRadians(lambda)) * math.Sin(toRadians(23.4397)))
+
+	// hour angle
+	cosHourAngle := (math.Sin(toRadians(altitude)) - math.Sin(toRadians(lat))*math.Sin(declination)) /
+		(math.Cos(toRadians(lat)) * math.Cos(declination))
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return when, false
+	}
+	hourAngle := toDegrees(math.Acos(cosHourAngle))
+
+	julian := transit + hourAngle/360
+	if rising {
+		julian = transit - hourAngle/360
+	}
+
+	// julian days => unix time
+	seconds := (julian - 2440587.5) * 86400
+
+	return time.Unix(int64(seconds), 0).In(date.Location()), true
+}
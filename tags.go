@@ -0,0 +1,65 @@
+package main
+
+// tags.go
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// expression of tags in messages (eg. "#work", "#home")
+var _tagExpression = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_]+)`)
+
+// extract tags from given text (lowercased, without '#', in the order of appearance)
+func extractTags(text string) (tags []string) {
+	tags = []string{}
+	for _, matched := range _tagExpression.FindAllStringSubmatch(text, -1) {
+		if tag := strings.ToLower(matched[1]); !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// remove tags from given text (eg. "call mom #home" => "call mom"), keeping its line breaks
+func stripTags(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		stripped := strings.Join(strings.Fields(_tagExpression.ReplaceAllString(line, " ")), " ")
+		if stripped == "" && strings.TrimSpace(line) != "" { // (line of tags only)
+			continue
+		}
+		lines = append(lines, stripped)
+	}
+
+	stripped := strings.TrimSpace(strings.Join(lines, "\n"))
+	if stripped == "" { // (only tags)
+		return text
+	}
+
+	return stripped
+}
+
+// append tags of `original` which are missing in given text (eg. dropped by the model)
+func keepTags(text, original string) string {
+	existing := extractTags(text)
+	for _, tag := range extractTags(original) {
+		if !slices.Contains(existing, tag) {
+			text += " #" + tag
+		}
+	}
+
+	return text
+}
+
+// join given tags for saving them in the database (eg. "work,home")
+func joinTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+// normalize given tag (eg. "#Work" => "work")
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestStripTags(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"call mom #home", "call mom"},
+		{"#work send the report", "send the report"},
+		{"buy milk #home\nand eggs #shopping", "buy milk\nand eggs"},
+		{"buy milk\n#home #shopping\nand eggs", "buy milk\nand eggs"}, // (lines of tags only are removed)
+		{"buy milk\n\nand eggs #home", "buy milk\n\nand eggs"},        // (empty lines are kept)
+		{"  buy   milk  #home  ", "buy milk"},
+		{"fix issue#42 today", "fix issue#42 today"}, // (not a tag)
+		{"#home #work", "#home #work"},               // (only tags)
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if stripped := stripTags(test.text); stripped != test.expected {
+			t.Errorf("expected %q for %q, got %q", test.expected, test.text, stripped)
+		}
+	}
+}
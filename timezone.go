@@ -0,0 +1,121 @@
+package main
+
+// timezone.go
+
+import (
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // embed timezone database for environments without one (eg. containers)
+
+	// others
+	"github.com/ringsaturn/tzf"
+)
+
+// finder of timezones with their boundaries (loaded lazily, as it takes some time and memory)
+var (
+	_timezoneFinder     tzf.F
+	_timezoneFinderErr  error
+	_timezoneFinderOnce sync.Once
+)
+
+// common timezones, for asking new users
+var _commonTimezones = []string{
+	"America/Los_Angeles",
+	"America/New_York",
+	"Europe/London",
+	"Europe/Berlin",
+	"Asia/Kolkata",
+	"Asia/Shanghai",
+	"Asia/Seoul",
+	"Australia/Sydney",
+}
+
+// likely timezones of language codes (with or without regions) of telegram users
+var _languageTimezones = map[string]string{
+	"ko":    "Asia/Seoul",
+	"ja":    "Asia/Tokyo",
+	"zh":    "Asia/Shanghai",
+	"zh-tw": "Asia/Taipei",
+	"zh-hk": "Asia/Hong_Kong",
+	"th":    "Asia/Bangkok",
+	"vi":    "Asia/Ho_Chi_Minh",
+	"id":    "Asia/Jakarta",
+	"ms":    "Asia/Kuala_Lumpur",
+	"hi":    "Asia/Kolkata",
+	"fa":    "Asia/Tehran",
+	"ar":    "Asia/Riyadh",
+	"he":    "Asia/Jerusalem",
+	"tr":    "Europe/Istanbul",
+	"ru":    "Europe/Moscow",
+	"uk":    "Europe/Kyiv",
+	"pl":    "Europe/Warsaw",
+	"de":    "Europe/Berlin",
+	"fr":    "Europe/Paris",
+	"it":    "Europe/Rome",
+	"es":    "Europe/Madrid",
+	"pt":    "Europe/Lisbon",
+	"pt-br": "America/Sao_Paulo",
+	"nl":    "Europe/Amsterdam",
+	"sv":    "Europe/Stockholm",
+	"en-gb": "Europe/London",
+	"en-au": "Australia/Sydney",
+	"en-us": "America/New_York",
+	"en":    "America/New_York",
+}
+
+// guess the timezone from given language code (eg. "ko", "pt-br"), or return an empty string if unknown
+func timezoneFromLanguageCode(code string) string {
+	code = strings.ToLower(code)
+	if zone, exists := _languageTimezones[code]; exists {
+		return zone
+	}
+
+	base, _, _ := strings.Cut(code, "-")
+	return _languageTimezones[base]
+}
+
+// timezones for asking the user to select one: the guessed one (if any) first, and then common ones
+func timezoneCandidates(guessed string) (zones []string) {
+	zones = []string{}
+	if guessed != "" {
+		zones = append(zones, guessed)
+	}
+	for _, zone := range _commonTimezones {
+		if zone != guessed {
+			zones = append(zones, zone)
+		}
+	}
+
+	return zones
+}
+
+// find (at most) `n` timezones which contain given location with their boundaries, the most specific one first
+func timezonesAt(lat, lon float64, n int) (zones []string, err error) {
+	_timezoneFinderOnce.Do(func() {
+		_timezoneFinder, _timezoneFinderErr = tzf.NewDefaultFinder()
+	})
+	if _timezoneFinderErr != nil {
+		return nil, _timezoneFinderErr
+	}
+
+	if zones, err = _timezoneFinder.GetTimezoneNames(lon, lat); err != nil {
+		return nil, err
+	}
+	if len(zones) > n {
+		zones = zones[:n]
+	}
+
+	return zones, nil
+}
+
+// get the location of given chat's timezone, or the default one
+func chatLocation(db *Database, chatID int64) *time.Location {
+	if setting, err := db.GetChatSetting(chatID); err == nil && setting.Timezone != "" {
+		if loc, err := time.LoadLocation(setting.Timezone); err == nil {
+			return loc
+		}
+	}
+
+	return _location
+}
@@ -0,0 +1,96 @@
+package main
+
+// week.go
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// first days of weeks which can be set for each chat (`/weekstart`)
+var _weekStarts = map[string]time.Weekday{
+	"sunday": time.Sunday,
+	"monday": time.Monday,
+}
+
+// default first day of weeks
+const defaultWeekStart = time.Monday
+
+// expression of week-relative days (eg. "this friday", "next monday", "next week")
+var _weekRelativeExpression = regexp.MustCompile(`(?i)\b(this|next)\s+(week|sunday|monday|tuesday|wednesday|thursday|friday|saturday)\b`)
+
+// weekdays by their names
+var _weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// get the first day of weeks of given chat (or the default one)
+func chatWeekStart(db *Database, chatID int64) time.Weekday {
+	if setting, err := db.GetChatSetting(chatID); err == nil {
+		if weekStart, exists := _weekStarts[setting.WeekStart]; exists {
+			return weekStart
+		}
+	}
+
+	return defaultWeekStart
+}
+
+// get the name of given first day of weeks
+func weekStartName(weekStart time.Weekday) string {
+	return strings.ToLower(weekStart.String())
+}
+
+// adjust the days of given (parsed) items to the week-relative expression in given text (eg. "next monday"),
+// with given first day of weeks, keeping their times
+//
+// (models resolve them differently, eg. "next monday" on a sunday can be either tomorrow or 8 days later,
+// so they are calculated here for being consistent with the chat's week)
+func anchorToWeekStart(parsed []parsedItem, text string, weekStart time.Weekday, now time.Time) (anchored []parsedItem) {
+	matched := _weekRelativeExpression.FindAllStringSubmatch(text, -1)
+	if len(matched) != 1 { // (none, or ambiguous)
+		return parsed
+	}
+	relative, unit := strings.ToLower(matched[0][1]), strings.ToLower(matched[0][2])
+
+	// first day of this week
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	startOfWeek := today.AddDate(0, 0, -daysSinceWeekStart(today.Weekday(), weekStart))
+	if relative == "next" {
+		startOfWeek = startOfWeek.AddDate(0, 0, 7)
+	}
+
+	anchored = []parsedItem{}
+	for _, p := range parsed {
+		// (not for exact datetimes, or recurring ones which have their own times)
+		if !p.Exact && p.Recurrence == "" {
+			when := p.When.In(now.Location())
+
+			weekday := when.Weekday() // "this week", "next week": keep the weekday of the parsed one
+			if unit != "week" {
+				weekday = _weekdays[unit]
+			}
+
+			day := startOfWeek.AddDate(0, 0, daysSinceWeekStart(weekday, weekStart))
+			if relative == "this" && day.Before(today) { // (eg. "this sunday" on a saturday, when weeks start on sunday)
+				day = day.AddDate(0, 0, 7)
+			}
+			p.When = time.Date(day.Year(), day.Month(), day.Day(), when.Hour(), when.Minute(), when.Second(), 0, now.Location())
+		}
+
+		anchored = append(anchored, p)
+	}
+
+	return anchored
+}
+
+// get the number of days from given first day of weeks to given weekday
+func daysSinceWeekStart(weekday, weekStart time.Weekday) int {
+	return (int(weekday) - int(weekStart) + 7) % 7
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnchorToWeekStart(t *testing.T) {
+	saturday := time.Date(2025, 1, 18, 10, 0, 0, 0, time.UTC)
+	sunday := time.Date(2025, 1, 19, 10, 0, 0, 0, time.UTC)
+
+	// (times of the day should be kept)
+	at := func(month time.Month, day int) time.Time {
+		return time.Date(2025, month, day, 9, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		text      string
+		weekStart time.Weekday
+		now       time.Time
+		parsed    parsedItem
+		expected  time.Time
+	}{
+		{
+			name:      "this sunday on saturday (weeks start on sunday)",
+			text:      "this sunday 9:30 call mom",
+			weekStart: time.Sunday,
+			now:       saturday,
+			parsed:    parsedItem{When: at(time.January, 12)},
+			expected:  at(time.January, 19), // (rolled over, not the past sunday of this week)
+		},
+		{
+			name:      "this sunday on saturday (weeks start on monday)",
+			text:      "this sunday 9:30 call mom",
+			weekStart: time.Monday,
+			now:       saturday,
+			parsed:    parsedItem{When: at(time.January, 26)},
+			expected:  at(time.January, 19),
+		},
+		{
+			name:      "this friday on saturday",
+			text:      "This Friday 9:30 call mom",
+			weekStart: time.Monday,
+			now:       saturday,
+			parsed:    parsedItem{When: at(time.January, 17)},
+			expected:  at(time.January, 24),
+		},
+		{
+			name:      "next sunday on saturday (weeks start on sunday)",
+			text:      "next sunday 9:30 call mom",
+			weekStart: time.Sunday,
+			now:       saturday,
+			parsed:    parsedItem{When: at(time.January, 26)},
+			expected:  at(time.January, 19),
+		},
+		{
+			name:      "next sunday on saturday (weeks start on monday)",
+			text:      "next sunday 9:30 call mom",
+			weekStart: time.Monday,
+			now:       saturday,
+			parsed:    parsedItem{When: at(time.January, 19)},
+			expected:  at(time.January, 26),
+		},
+		{
+			name:      "next monday on sunday (weeks start on sunday)",
+			text:      "next monday 9:30 call mom",
+			weekStart: time.Sunday,
+			now:       sunday,
+			parsed:    parsedItem{When: at(time.January, 20)},
+			expected:  at(time.January, 27),
+		},
+		{
+			name:      "next monday on sunday (weeks start on monday)",
+			text:      "next monday 9:30 call mom",
+			weekStart: time.Monday,
+			now:       sunday,
+			parsed:    parsedItem{When: at(time.January, 27)},
+			expected:  at(time.January, 20),
+		},
+		{
+			name:      "this week keeps the weekday",
+			text:      "wednesday this week 9:30 call mom",
+			weekStart: time.Sunday,
+			now:       sunday,
+			parsed:    parsedItem{When: at(time.January, 29)},
+			expected:  at(time.January, 22),
+		},
+		{
+			name:      "next week keeps the weekday",
+			text:      "wednesday next week 9:30 call mom",
+			weekStart: time.Monday,
+			now:       saturday,
+			parsed:    parsedItem{When: at(time.January, 29)},
+			expected:  at(time.January, 22),
+		},
+		{
+			name:      "no week-relative expression",
+			text:      "tomorrow 9:30 call mom",
+			weekStart: time.Monday,
+			now:       saturday,
+			parsed:    parsedItem{When: at(time.January, 19)},
+			expected:  at(time.January, 19),
+		},
+		{
+			name:      "ambiguous expressions",
+			text:      "this friday or next monday 9:30 call mom",
+			weekStart: time.Monday,
+			now:       saturday,
+			parsed:    parsedItem{When: at(time.January, 17)},
+			expected:  at(time.January, 17),
+		},
+		{
+			name:      "exact datetimes",
+			text:      "next monday 2025-01-27 09:30 call mom",
+			weekStart: time.Monday,
+			now:       sunday,
+			parsed:    parsedItem{When: at(time.January, 27), Exact: true},
+			expected:  at(time.January, 27),
+		},
+		{
+			name:      "recurring ones",
+			text:      "every monday from next monday 9:30 call mom",
+			weekStart: time.Monday,
+			now:       sunday,
+			parsed:    parsedItem{When: at(time.January, 27), Recurrence: "30 9 * * 1"},
+			expected:  at(time.January, 27),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			anchored := anchorToWeekStart([]parsedItem{test.parsed}, test.text, test.weekStart, test.now)
+
+			if len(anchored) != 1 {
+				t.Fatalf("expected 1 item, got %d", len(anchored))
+			}
+			if !anchored[0].When.Equal(test.expected) {
+				t.Errorf("expected %s, got %s", test.expected.Format(time.RFC1123), anchored[0].When.Format(time.RFC1123))
+			}
+		})
+	}
+}